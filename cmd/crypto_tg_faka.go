@@ -20,8 +20,18 @@ func main() {
 		&models.Transfer{},
 		&models.Wallet{},
 		&models.User{},
+		&models.Category{},
 		&models.Product{},
+		&models.ProductVariant{},
+		&models.ProductMedia{},
+		&models.ProductTranslation{},
+		&models.TemplateVersion{},
 		&models.ProductItem{},
+		&models.BalanceLog{},
+		&models.OrderEvent{},
+		&models.DeliveryOutbox{},
+		&models.RestockSubscription{},
+		&models.Refund{},
 	); err != nil {
 		panic(err)
 	}
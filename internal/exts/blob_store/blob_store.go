@@ -0,0 +1,77 @@
+package blob_store
+
+import (
+	"errors"
+	"gopay/internal/exts/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 文件存储,默认保存在本地磁盘,需要时可替换为其他实现(如对象存储)
+type BlobStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+var Store BlobStore
+
+func InitBlobStore() {
+	Store = NewLocalStore(config.BlobStoreDir)
+}
+
+// 本地磁盘存储,key为相对BaseDir的路径
+type LocalStore struct {
+	BaseDir string
+}
+
+func NewLocalStore(baseDir string) *LocalStore {
+	return &LocalStore{BaseDir: baseDir}
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "" || strings.Contains(key, "..") || filepath.IsAbs(key) {
+		return "", errors.New("文件key错误")
+	}
+	return filepath.Join(s.BaseDir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名,防止中途失败留下不完整的文件
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (s *LocalStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
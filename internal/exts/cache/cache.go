@@ -65,6 +65,26 @@ func (c *CacheStruct) Set(key string, value interface{}, duration time.Duration)
 	}
 }
 
+// 不存在或已过期才写入,返回是否写入成功,用于限流等需要原子判断的场景
+func (c *CacheStruct) Add(key string, value interface{}, duration time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, found := c.items[key]; found && (item.Expiration == 0 || time.Now().Unix() <= item.Expiration) {
+		return false
+	}
+
+	expiration := time.Now().Add(duration).Unix()
+	if duration == time.Duration(0) {
+		expiration = 0
+	}
+	c.items[key] = ItemStruct{
+		Value:      value,
+		Expiration: expiration,
+	}
+	return true
+}
+
 func (c *CacheStruct) Get(key string) interface{} {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
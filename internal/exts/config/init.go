@@ -18,6 +18,7 @@ var SiteConfigPath = configBaseDir + "/config.ini"
 var LoginUrlSessionPath = configBaseDir + "/.urlsession"
 var LoginTokenSessionPath = configBaseDir + "/.tokensession"
 var ExchangeRateDataPath = configBaseDir + "/.exchangerate"
+var BlobStoreDir = configBaseDir + "/blobs" // 文件商品项目
 
 type Headers map[string]string
 
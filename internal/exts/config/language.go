@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 基础语言,templates目录下的模板和代码中的文字使用该语言
+const BaseLanguage = "zh"
+const baseLanguageName = "中文"
+
+// 语言目录下的文字翻译文件,以基础语言的原文为键
+const languageMessagesFileName = "messages.json"
+
+// 翻译文件中该键的值为语言的显示名称
+const languageNameKey = "_name"
+
+type Language struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// 可用的语言,第一个为基础语言
+var languages []Language
+
+var languageMessages = make(map[string]map[string]string)
+
+func loadLanguageMessages(languageDir string) (map[string]string, error) {
+	messages := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(languageDir, languageMessagesFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return messages, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func GetLanguages() []Language {
+	templateLock.RLock()
+	defer templateLock.RUnlock()
+	return languages
+}
+
+func IsLanguageAvailable(language string) bool {
+	for _, v := range GetLanguages() {
+		if v.Code == language {
+			return true
+		}
+	}
+	return false
+}
+
+// 把Telegram的语言代码匹配到可用的语言,如en-US匹配en,没有匹配的返回空
+func MatchLanguage(languageCode string) string {
+	languageCode = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(languageCode)), "_", "-")
+	if languageCode == "" {
+		return ""
+	}
+	if IsLanguageAvailable(languageCode) {
+		return languageCode
+	}
+	if i := strings.Index(languageCode, "-"); i > 0 && IsLanguageAvailable(languageCode[:i]) {
+		return languageCode[:i]
+	}
+	return ""
+}
+
+// 用户没有选择语言且Telegram语言不可用时使用的语言
+func GetDefaultLanguage() string {
+	if language := MatchLanguage(GetSiteConfig().DefaultLanguage); language != "" {
+		return language
+	}
+	return BaseLanguage
+}
+
+// 翻译代码中的文字,没有翻译时返回原文
+func T(language string, text string) string {
+	templateLock.RLock()
+	defer templateLock.RUnlock()
+	if translated := languageMessages[language][text]; translated != "" {
+		return translated
+	}
+	return text
+}
+
+// 翻译格式化字符串后再格式化
+func Tf(language string, format string, args ...interface{}) string {
+	return fmt.Sprintf(T(language, format), args...)
+}
@@ -32,6 +32,12 @@ var NetworkCurrencies = map[Network][]Currency{
 }
 var Fiats = []string{string(CNY)}
 
+// 用户余额统一以CNY记账,余额支付的订单network记为BALANCE
+const (
+	BalanceCurrency      = CNY
+	BalancePaymentMethod = "BALANCE"
+)
+
 type ExchangeRateStruct struct {
 	ExchangeRate map[Currency]decimal.Decimal `json:"exchange_rate"`
 	UpdateTime   string                       `json:"update_time"`
@@ -244,3 +250,24 @@ func IsPaymentEnable(input string) bool {
 	}
 	return true
 }
+
+// 获取余额充值金额选项
+func GetDepositAmounts() []decimal.Decimal {
+	var result []decimal.Decimal
+	for _, part := range strings.Split(SiteConfig.DepositAmounts, ",") {
+		amount, err := decimal.NewFromString(strings.TrimSpace(part))
+		if err != nil || !amount.GreaterThan(decimal.Zero) {
+			continue
+		}
+		result = append(result, amount)
+	}
+	return result
+}
+
+// 获取每个用户的待支付订单上限
+func GetMaxPendingOrders() int {
+	if SiteConfig.MaxPendingOrders < 1 {
+		return 1
+	}
+	return SiteConfig.MaxPendingOrders
+}
@@ -12,20 +12,29 @@ import (
 
 type SiteConfigStruct struct {
 	//EnableReg           bool   `desc:"是否开启注册"`
-	TgBotToken            string        `json:"tg_bot_token" desc:"Telegram Bot Token, 在@BotFather申请(重启生效)"`
-	AdminTGID             int64         `json:"admin_tg_id" desc:"管理员Telegram Chat ID,可以在@userinfobot获取,管理员可直接登录后台,请勿乱填(重启生效)"`
-	Host                  string        `json:"host" desc:"域名，用于生成登录链接和重定向等操作"`
-	OrderExpireDuration   time.Duration `json:"order_expire_duration" desc:"订单过期时间,用户支付和链上交易需要时间,不要设置太短"`
-	TronGridApiKey        string        `json:"tron_grid_api_key" desc:"TronGrid API密钥,用于监听交易,在此获取:https://www.trongrid.io/dashboard/keys"`
-	EnableFixExchangeRate bool          `json:"enable_fix_exchange_rate" desc:"启用固定汇率"`
-	FixedExchangeRate     string        `json:"fixed_exchange_rate" desc:"固定汇率(參照首頁實時匯率填寫，測試後再上綫)"`
+	TgBotToken              string        `json:"tg_bot_token" desc:"Telegram Bot Token, 在@BotFather申请(重启生效)"`
+	AdminTGID               int64         `json:"admin_tg_id" desc:"管理员Telegram Chat ID,可以在@userinfobot获取,管理员可直接登录后台,请勿乱填(重启生效)"`
+	Host                    string        `json:"host" desc:"域名，用于生成登录链接和重定向等操作"`
+	OrderExpireDuration     time.Duration `json:"order_expire_duration" desc:"订单过期时间,用户支付和链上交易需要时间,不要设置太短"`
+	OrderRemindBeforeExpire time.Duration `json:"order_remind_before_expire" desc:"订单过期前多久提醒用户,如5m,为0则不提醒"`
+	TronGridApiKey          string        `json:"tron_grid_api_key" desc:"TronGrid API密钥,用于监听交易,在此获取:https://www.trongrid.io/dashboard/keys"`
+	EnableFixExchangeRate   bool          `json:"enable_fix_exchange_rate" desc:"启用固定汇率"`
+	FixedExchangeRate       string        `json:"fixed_exchange_rate" desc:"固定汇率(參照首頁實時匯率填寫，測試後再上綫)"`
 	//DecimalWalletUnit         string        `validate:"numeric" json:"decimal_wallet_unit" desc:"小数点钱包单位步长,同时也是最小保留小数位数,如0.0001"`
 	//DecimalWalletMaxIncrement string        `validate:"numeric" json:"decimal_wallet_max_increment" desc:"小数点钱包最大增量,如0.01,确保在使用小数点尾数钱包的时候,用户多支付的费用不超过该数"`
 	//WalletDecimalPlace        int            `validate:"numeric" json:"wallet_decimal_place" desc:"钱包小数点位数,如3则为0.001,4则为0.0001,不要太大,超过货币最大位数会导致用户无法正好付到这个金额"`
 	//WalletMaxDecimalIncrement int            `validate:"numeric" json:"WalletMaxDecimalIncrement" desc:"该值乘以钱包小数点最小位数,则为订单最大增量. 如该值为100,小数点最小位数为0.0001,则订单价格不会超过原有价格加上0.01"`
 
+	StockAlertInterval time.Duration `json:"stock_alert_interval" desc:"同一商品库存不足或售罄提醒的最短间隔,如1h,为0则为1小时"`
+	StockSummaryTime   string        `json:"stock_summary_time" desc:"每天发送库存汇总给管理员的时间,如09:00,为空则不发送"`
+
+	DefaultLanguage string `json:"default_language" desc:"默认语言,用户没有选择语言且Telegram客户端语言不可用时使用,如zh、en,为空则为zh"`
+
 	PaymentMethods   string `json:"payment_methods" desc:"启用的支付方式"`
 	WalletType       int    `json:"wallet_type" desc:"收款类型: 1.任意金额钱包 2.小数点尾数钱包"`
+	DepositAmounts   string `json:"deposit_amounts" desc:"余额充值金额选项(CNY),用逗号分隔,如50,100,200"`
+	MaxPendingOrders int    `json:"max_pending_orders" desc:"每个用户同时存在的待支付订单数量上限,小于1则为1"`
+	WebhookSecret    string `json:"webhook_secret" desc:"发货接口签名密钥,请求头X-Signature为HMAC-SHA256(密钥, X-Timestamp.请求体)的hex"`
 	Proxy            Proxy  `json:"proxy" desc:"网络代理，如果要用代理则取消注释并填写"`
 	LogLevel         int    `json:"log_level" desc:"日志记录级别,0为Debug"`
 	EnableDBDebug    bool   `json:"enable_db_debug" desc:"开启数据库Debug输出(重启生效)"`
@@ -221,3 +230,20 @@ var SiteConfig *SiteConfigStruct
 var SiteConfigLock = &sync.RWMutex{}
 
 var SendAdminLimit = time.NewTicker(5 * time.Second)
+
+// 获取库存提醒的最短间隔
+func GetStockAlertInterval() time.Duration {
+	if SiteConfig.StockAlertInterval <= 0 {
+		return time.Hour
+	}
+	return SiteConfig.StockAlertInterval
+}
+
+// 获取今天发送库存汇总的时间,未设置或格式错误返回false
+func GetStockSummaryTime(now time.Time) (time.Time, bool) {
+	summaryTime, err := time.ParseInLocation("15:04", strings.TrimSpace(SiteConfig.StockSummaryTime), now.Location())
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), summaryTime.Hour(), summaryTime.Minute(), 0, 0, now.Location()), true
+}
@@ -4,76 +4,267 @@ import (
 	"bytes"
 	"fmt"
 	"gopay/internal/utils/functions"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"text/template"
 	"time"
 )
 
+// 基础语言的模板,其他语言缺少的模板使用基础语言的
 var templates *template.Template
 
+// 其他语言的模板,在templates/<语言>目录下
+var languageTemplates = make(map[string]*template.Template)
+
+// 后台修改模板后会重新加载,读写模板、语言和翻译时加锁
+var templateLock sync.RWMutex
+
 const (
-	welcomeTplName       = "welcome.tpl"
-	productListTplName   = "product_list.tpl"
-	productDetailTplName = "product_detail.tpl"
-	payOrderTplName      = "pay_order.tpl"
-	orderCallbackTplName = "order_callback.tpl"
-	paidOrderListTplName = "paid_order_list.tpl"
+	welcomeTplName           = "welcome.tpl"
+	productListTplName       = "product_list.tpl"
+	productDetailTplName     = "product_detail.tpl"
+	payOrderTplName          = "pay_order.tpl"
+	orderCallbackTplName     = "order_callback.tpl"
+	paidOrderListTplName     = "paid_order_list.tpl"
+	balanceTplName           = "balance.tpl"
+	depositCallbackTplName   = "deposit_callback.tpl"
+	orderExpiredTplName      = "order_expired.tpl"
+	orderRemindTplName       = "order_remind.tpl"
+	pendingOrderListTplName  = "pending_order_list.tpl"
+	preOrderCallbackTplName  = "pre_order_callback.tpl"
+	restockNotifyTplName     = "restock_notify.tpl"
+	refundNotifyTplName      = "refund_notify.tpl"
+	inputFieldPromptTplName  = "input_field_prompt.tpl"
+	inputFieldConfirmTplName = "input_field_confirm.tpl"
+	productShareTplName      = "product_share.tpl"
+	productSearchTplName     = "product_search.tpl"
 )
 
+// 机器人使用的模板,基础语言必须包含全部
+var templateNames = []string{
+	welcomeTplName,
+	productListTplName,
+	productDetailTplName,
+	payOrderTplName,
+	orderCallbackTplName,
+	paidOrderListTplName,
+	balanceTplName,
+	depositCallbackTplName,
+	orderExpiredTplName,
+	orderRemindTplName,
+	pendingOrderListTplName,
+	preOrderCallbackTplName,
+	restockNotifyTplName,
+	refundNotifyTplName,
+	inputFieldPromptTplName,
+	inputFieldConfirmTplName,
+	productShareTplName,
+	productSearchTplName,
+}
+
+var templateFuncMap = template.FuncMap{
+	"TimestampToDatetime": timestampToDatetime,
+}
+
 func timestampToDatetime(timestamp int64) string {
 	t := time.Unix(timestamp, 0)           // Converts Unix timestamp to time.Time
 	return t.Format("2006-01-02 15:04:05") // Formats the time in a human-readable form
 }
 
 func LoadTemplates() {
-	funcMap := template.FuncMap{
-		"TimestampToDatetime": timestampToDatetime,
+	if err := ReloadTemplates(); err != nil {
+		panic(err)
 	}
+}
 
-	var err error
-	templates, err = template.New("base").Funcs(funcMap).ParseGlob(functions.GetExecutableDir() + "/templates/*.tpl")
+// 重新读取模板目录,有错误时保留当前使用的模板
+func ReloadTemplates() error {
+	templateDir := GetTemplateDir()
+	baseTemplates, err := template.New("base").Funcs(templateFuncMap).ParseGlob(templateDir + "/*.tpl")
 	if err != nil {
-		panic(err)
-	}
-	templateNames := []string{
-		welcomeTplName,
-		productListTplName,
-		productDetailTplName,
-		payOrderTplName,
-		orderCallbackTplName,
-		paidOrderListTplName,
+		return err
 	}
 	for _, name := range templateNames {
-		if templates.Lookup(name) == nil {
-			panic(fmt.Sprintf("Template %s not found", name))
+		if baseTemplates.Lookup(name) == nil {
+			return fmt.Errorf("Template %s not found", name)
+		}
+	}
+
+	newLanguageTemplates, newLanguageMessages, newLanguages, err := loadLanguageTemplates(templateDir, baseTemplates)
+	if err != nil {
+		return err
+	}
+
+	templateLock.Lock()
+	defer templateLock.Unlock()
+	templates = baseTemplates
+	languageTemplates = newLanguageTemplates
+	languageMessages = newLanguageMessages
+	languages = newLanguages
+	return nil
+}
+
+// 每个子目录为一种语言,目录名为语言代码,如templates/en
+func loadLanguageTemplates(templateDir string, baseTemplates *template.Template) (map[string]*template.Template, map[string]map[string]string, []Language, error) {
+	entries, err := os.ReadDir(templateDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	newLanguageTemplates := make(map[string]*template.Template)
+	newLanguageMessages := make(map[string]map[string]string)
+	newLanguages := []Language{{Code: BaseLanguage, Name: baseLanguageName}}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		language := strings.ToLower(entry.Name())
+		languageDir := filepath.Join(templateDir, entry.Name())
+
+		// 在基础语言模板的副本上覆盖该语言的模板
+		languageTemplate, err := baseTemplates.Clone()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if files, _ := filepath.Glob(languageDir + "/*.tpl"); len(files) > 0 {
+			if _, err := languageTemplate.ParseFiles(files...); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		messages, err := loadLanguageMessages(languageDir)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Language %s messages error: %v", language, err)
+		}
+
+		newLanguageTemplates[language] = languageTemplate
+		newLanguageMessages[language] = messages
+		name := messages[languageNameKey]
+		if name == "" {
+			name = language
+		}
+		newLanguages = append(newLanguages, Language{Code: language, Name: name})
+	}
+	sort.Slice(newLanguages[1:], func(i, j int) bool {
+		return newLanguages[i+1].Code < newLanguages[j+1].Code
+	})
+	return newLanguageTemplates, newLanguageMessages, newLanguages, nil
+}
+
+func GetTemplateDir() string {
+	return functions.GetExecutableDir() + "/templates"
+}
+
+func GetTemplateNames() []string {
+	return templateNames
+}
+
+func IsTemplateName(name string) bool {
+	for _, v := range templateNames {
+		if v == name {
+			return true
 		}
 	}
+	return false
+}
+
+// 模板文件路径,基础语言在templates目录下,其他语言在templates/<语言>目录下
+func GetTemplatePath(language string, templateName string) string {
+	if language == BaseLanguage {
+		return filepath.Join(GetTemplateDir(), templateName)
+	}
+	return filepath.Join(GetTemplateDir(), language, templateName)
+}
+
+func getLanguageTemplate(language string) *template.Template {
+	templateLock.RLock()
+	defer templateLock.RUnlock()
+	if languageTemplate, ok := languageTemplates[language]; ok {
+		return languageTemplate
+	}
+	return templates
+}
+
+// 用content替换指定语言的模板后渲染,不影响正在使用的模板,用于保存前校验和预览
+func RenderTemplate(language string, templateName string, content string, data interface{}) (string, error) {
+	languageTemplate, err := getLanguageTemplate(language).Clone()
+	if err != nil {
+		return "", err
+	}
+	if _, err := languageTemplate.New(templateName).Parse(content); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := languageTemplate.ExecuteTemplate(&buf, templateName, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
 
-func ExecuteTemplate(templateName string, data interface{}) string {
+// 使用指定语言的模板,该语言不存在时使用基础语言
+func ExecuteTemplate(language string, templateName string, data interface{}) string {
 	var buf bytes.Buffer
-	err := templates.ExecuteTemplate(&buf, templateName, data)
+	err := getLanguageTemplate(language).ExecuteTemplate(&buf, templateName, data)
 	if err != nil {
 		return "execute tpl err"
 	}
 	return buf.String()
 }
 
-func WelcomeMsg(data interface{}) string {
-	return ExecuteTemplate(welcomeTplName, data)
+func WelcomeMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, welcomeTplName, data)
 }
-func ProductListMsg(data interface{}) string {
-	return ExecuteTemplate(productListTplName, data)
+func ProductListMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, productListTplName, data)
 }
 
-func ProductDetailMsg(data interface{}) string {
-	return ExecuteTemplate(productDetailTplName, data)
+func ProductDetailMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, productDetailTplName, data)
+}
+func PayOrderMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, payOrderTplName, data)
+}
+func OrderCallbackMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, orderCallbackTplName, data)
+}
+func PaidOrderListMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, paidOrderListTplName, data)
+}
+func BalanceMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, balanceTplName, data)
+}
+func DepositCallbackMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, depositCallbackTplName, data)
+}
+func OrderExpiredMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, orderExpiredTplName, data)
+}
+func OrderRemindMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, orderRemindTplName, data)
+}
+func PendingOrderListMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, pendingOrderListTplName, data)
+}
+func PreOrderCallbackMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, preOrderCallbackTplName, data)
+}
+func RestockNotifyMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, restockNotifyTplName, data)
+}
+func RefundNotifyMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, refundNotifyTplName, data)
+}
+func InputFieldPromptMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, inputFieldPromptTplName, data)
 }
-func PayOrderMsg(data interface{}) string {
-	return ExecuteTemplate(payOrderTplName, data)
+func InputFieldConfirmMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, inputFieldConfirmTplName, data)
 }
-func OrderCallbackMsg(data interface{}) string {
-	return ExecuteTemplate(orderCallbackTplName, data)
+func ProductShareMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, productShareTplName, data)
 }
-func PaidOrderListMsg(data interface{}) string {
-	return ExecuteTemplate(paidOrderListTplName, data)
+func ProductSearchMsg(language string, data interface{}) string {
+	return ExecuteTemplate(language, productSearchTplName, data)
 }
@@ -0,0 +1,139 @@
+package admin_handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"gopay/internal/models"
+	"gopay/internal/services"
+	"gopay/internal/utils/functions"
+	"gopay/internal/utils/restful"
+)
+
+// 可选的分类ID参数,空字符串表示没有分类(顶级)
+func parseOptionalID(idString string) (*uuid.UUID, error) {
+	if idString == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func CreateCategory(c *gin.Context) {
+	var requestData struct {
+		Name     string `json:"name" binding:"required"`
+		Icon     string `json:"icon"`
+		Priority int64  `json:"priority"`
+		ParentID string `json:"parent_id"` // 为空则为顶级分类
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	parentID, err := parseOptionalID(requestData.ParentID)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+
+	category := models.NewCategory(requestData.Name, requestData.Icon, requestData.Priority, parentID)
+	if err := services.CreateCategory(category); err != nil {
+		restful.ParamErr(c, "创建失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "创建成功", functions.StructToMap(*category, functions.StructToMapExcludeMode))
+}
+
+func EditCategory(c *gin.Context) {
+	var requestData struct {
+		ID       *uuid.UUID `json:"id" binding:"required"`
+		Name     *string    `json:"name"`
+		Icon     *string    `json:"icon"`
+		Status   *int       `json:"status"`
+		Priority *int64     `json:"priority"`
+	}
+	if err := c.ShouldBindBodyWith(&requestData, binding.JSON); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	// parent_id单独解析,空字符串表示移到顶级,不传则不修改
+	var parentData struct {
+		ParentID *string `json:"parent_id"`
+	}
+	if err := c.ShouldBindBodyWith(&parentData, binding.JSON); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	var parentID *uuid.UUID
+	if parentData.ParentID != nil {
+		var err error
+		if parentID, err = parseOptionalID(*parentData.ParentID); err != nil {
+			restful.ParamErr(c, "id格式错误")
+			return
+		}
+	}
+
+	updateMap := functions.StructToMap(requestData, functions.StructToMapExcludeMode, "id")
+	if err := services.UpdateCategory(*requestData.ID, updateMap, parentData.ParentID != nil, parentID); err != nil {
+		restful.ParamErr(c, "编辑失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "编辑成功")
+}
+
+// 删除分类,子分类和商品移到上一级
+func DeleteCategories(c *gin.Context) {
+	var requestData struct {
+		IDsString string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	ids, err := functions.ParseIDsString(requestData.IDsString)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+
+	if err := services.DeleteCategories(ids); err != nil {
+		restful.ParamErr(c, "删除失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "删除成功")
+}
+
+// 批量设置商品分类,category_id为空则移到商品列表首页
+func AssignProductsCategory(c *gin.Context) {
+	var requestData struct {
+		IDsString  string `json:"ids"`
+		CategoryID string `json:"category_id"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	ids, err := functions.ParseIDsString(requestData.IDsString)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+	categoryID, err := parseOptionalID(requestData.CategoryID)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+
+	if err := services.AssignProductsCategory(ids, categoryID); err != nil {
+		restful.ParamErr(c, "设置失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "设置成功")
+}
@@ -101,6 +101,32 @@ func Dashboard(c *gin.Context) {
 	}
 	restful.Ok(c, respData)
 }
+
+// 库存汇总,send为true时同时发送给管理员Telegram
+func StockSummary(c *gin.Context) {
+	var requestData struct {
+		Send bool `json:"send"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	stockEntries, err := services.GetStockSummary()
+	if err != nil {
+		restful.ParamErr(c, "获取失败")
+		return
+	}
+	if requestData.Send {
+		go services.SendStockSummary()
+	}
+
+	restful.Ok(c, map[string]interface{}{
+		"items": stockEntries,
+		"text":  services.StockSummaryText(stockEntries),
+	})
+}
+
 func DashboardChart(c *gin.Context) {
 	var filterParams map[string]interface{}
 	if err := c.ShouldBindBodyWith(&filterParams, binding.JSON); err != nil {
@@ -130,7 +156,7 @@ func DashboardChart(c *gin.Context) {
 	filterParams["timestamp_range"] = fmt.Sprintf("%d,%d", startTimestamp, endTimestamp)
 
 	var orders []models.Order
-	query := models.ApplyFilters(db.DB, filterParams).Where("status=1")
+	query := models.ApplyFilters(db.DB, filterParams).Where("status in (1,3) and network <> ?", config.BalancePaymentMethod)
 	if result := query.Find(&orders); result.Error != nil {
 		restful.ParamErr(c, "获取订单错误")
 		return
@@ -159,7 +185,7 @@ func DashboardChart(c *gin.Context) {
 		orderPriceSumTemp := decimal.Zero
 		for _, order := range orders {
 			if order.CreateTime > startTimestampTemp && order.CreateTime < endTimestampTemp {
-				convertedPrice, err := config.ConvertCurrencyPrice(order.Price, config.Currency(order.Currency), config.CNY)
+				convertedPrice, err := config.ConvertCurrencyPrice(order.Price.Sub(order.RefundedPrice), config.Currency(order.Currency), config.CNY)
 				if err != nil {
 					restful.ParamErr(c, "获取汇率失败")
 					return
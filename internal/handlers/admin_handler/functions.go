@@ -23,6 +23,11 @@ func (pr PaginationRequest) ToPagination() services.Pagination {
 }
 
 func FetchList[T models.MyModel](c *gin.Context) {
+	fetchListWithFilters[T](c, nil)
+}
+
+// 固定的筛选条件会覆盖请求中的同名条件
+func fetchListWithFilters[T models.MyModel](c *gin.Context, fixedFilterParams map[string]interface{}) {
 	var paginationRequest PaginationRequest
 	if err := c.ShouldBindBodyWith(&paginationRequest, binding.JSON); err != nil {
 		restful.ParamErr(c)
@@ -34,6 +39,9 @@ func FetchList[T models.MyModel](c *gin.Context) {
 		restful.ParamErr(c, "参数错误2")
 		return
 	}
+	for key, value := range fixedFilterParams {
+		filterParams[key] = value
+	}
 	pagination := paginationRequest.ToPagination()
 
 	query := db.DB
@@ -2,6 +2,8 @@ package admin_handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gopay/internal/models"
 	"gopay/internal/services"
 	"gopay/internal/utils/functions"
 	"gopay/internal/utils/restful"
@@ -21,7 +23,7 @@ func ReleaseOrders(c *gin.Context) {
 		return
 	}
 
-	err = services.ReleaseOrders(ids)
+	err = services.ReleaseOrders(ids, models.OrderEventActorAdmin)
 	if err != nil {
 		restful.ParamErr(c, "释放失败")
 		return
@@ -29,3 +31,99 @@ func ReleaseOrders(c *gin.Context) {
 
 	restful.Ok(c, "释放成功")
 }
+
+// 订单详情,包括交易记录和状态变更记录
+func OrderDetail(c *gin.Context) {
+	var requestData struct {
+		ID uuid.UUID `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	order, transfers, orderEvents, err := services.GetOrderDetail(requestData.ID)
+	if err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
+
+	var transferItems []interface{}
+	for _, transfer := range transfers {
+		transferItems = append(transferItems, functions.StructToMap(transfer, functions.StructToMapExcludeMode))
+	}
+	var eventItems []interface{}
+	for _, orderEvent := range orderEvents {
+		eventItems = append(eventItems, functions.StructToMap(orderEvent, functions.StructToMapExcludeMode))
+	}
+
+	respData := map[string]interface{}{
+		"item":      functions.StructToMap(order, functions.StructToMapExcludeMode),
+		"transfers": transferItems,
+		"events":    eventItems,
+	}
+	restful.Ok(c, respData)
+}
+
+// 重新发送多次失败的发货消息
+func RetryDeliveries(c *gin.Context) {
+	var requestData struct {
+		IDsString string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	ids, err := functions.ParseIDsString(requestData.IDsString)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+
+	if err := services.RetryDeliveries(ids); err != nil {
+		restful.ParamErr(c, "重发失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "已重新发送")
+}
+
+// 发货接口多次失败,等待人工处理的订单
+func WebhookResolutionQueue(c *gin.Context) {
+	deliveryOutboxes, err := services.GetWebhookResolutionQueue()
+	if err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
+
+	var items []interface{}
+	for _, deliveryOutbox := range deliveryOutboxes {
+		item := functions.StructToMap(deliveryOutbox, functions.StructToMapExcludeMode)
+		item["order"] = functions.StructToMap(deliveryOutbox.Order, functions.StructToMapExcludeMode)
+		item["product_name"] = deliveryOutbox.Order.Product.Name
+		items = append(items, item)
+	}
+	restful.Ok(c, map[string]interface{}{
+		"items": items,
+		"total": len(items),
+	})
+}
+
+// 手动填写发货接口订单的发货内容并重新发货,接口恢复后也可直接调用重新发送
+func ResolveWebhookDelivery(c *gin.Context) {
+	var requestData struct {
+		OrderID uuid.UUID `json:"order_id" binding:"required"`
+		Content string    `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	if err := services.ResolveWebhookDelivery(requestData.OrderID, requestData.Content); err != nil {
+		restful.ParamErr(c, "处理失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "已填写发货内容并重新发货")
+}
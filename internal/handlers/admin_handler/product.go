@@ -12,18 +12,58 @@ import (
 
 func CreateProduct(c *gin.Context) {
 	var requestData struct {
-		Name        string          `json:"name" binding:"required"`
-		Description string          `json:"description"`
-		Currency    string          `json:"currency" binding:"required"`
-		Price       decimal.Decimal `json:"price" binding:"required"`
+		Name           string                `json:"name" binding:"required"`
+		Description    string                `json:"description"`
+		Currency       string                `json:"currency" binding:"required"`
+		Price          decimal.Decimal       `json:"price" binding:"required"`
+		EnablePreOrder bool                  `json:"enable_pre_order"`
+		LowStock       uint                  `json:"low_stock_threshold"`
+		InputFields    models.InputFieldList `json:"input_fields"`
+		DeliveryType   int                   `json:"delivery_type"`
+		WebhookURL     string                `json:"webhook_url"`
+		CategoryID     string                `json:"category_id"`
+
+		UserPurchaseLimit       uint `json:"user_purchase_limit"`
+		UserPurchaseLimitPeriod int  `json:"user_purchase_limit_period"`
+		DailyPurchaseLimit      uint `json:"daily_purchase_limit"`
 	}
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		restful.ParamErr(c, "参数错误")
 		return
 	}
+	if err := services.ValidateInputFields(requestData.InputFields); err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
+	if err := services.ValidateProductDelivery(requestData.DeliveryType, requestData.WebhookURL); err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
+	if err := services.ValidatePurchaseLimitPeriod(requestData.UserPurchaseLimitPeriod); err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
+	categoryID, err := parseOptionalID(requestData.CategoryID)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+	if err := services.CheckProductCategory(categoryID); err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
 	product := models.NewProduct(requestData.Name, requestData.Description, requestData.Currency, requestData.Price)
+	product.CategoryID = categoryID
+	product.EnablePreOrder = requestData.EnablePreOrder
+	product.LowStockThreshold = requestData.LowStock
+	product.InputFields = requestData.InputFields
+	product.DeliveryType = requestData.DeliveryType
+	product.WebhookURL = requestData.WebhookURL
+	product.UserPurchaseLimit = requestData.UserPurchaseLimit
+	product.UserPurchaseLimitPeriod = requestData.UserPurchaseLimitPeriod
+	product.DailyPurchaseLimit = requestData.DailyPurchaseLimit
 
-	err := services.CreateProduct(product)
+	err = services.CreateProduct(product)
 	if err != nil {
 		restful.ParamErr(c, "创建失败")
 		return
@@ -34,20 +74,62 @@ func CreateProduct(c *gin.Context) {
 
 func EditProduct(c *gin.Context) {
 	var requestData struct {
-		ID          *uuid.UUID       `json:"id" binding:"required"`
-		Status      *uint            `json:"status" `
-		Priority    *int64           `json:"priority" `
-		Name        *string          `json:"name"`
-		Description *string          `json:"description"`
-		Currency    *string          `json:"currency"`
-		Price       *decimal.Decimal `json:"price"`
+		ID             *uuid.UUID             `json:"id" binding:"required"`
+		Status         *uint                  `json:"status" `
+		Priority       *int64                 `json:"priority" `
+		Name           *string                `json:"name"`
+		Description    *string                `json:"description"`
+		Currency       *string                `json:"currency"`
+		Price          *decimal.Decimal       `json:"price"`
+		EnablePreOrder *bool                  `json:"enable_pre_order"`
+		LowStock       *uint                  `json:"low_stock_threshold"`
+		InputFields    *models.InputFieldList `json:"input_fields"`
+		DeliveryType   *int                   `json:"delivery_type"`
+		WebhookURL     *string                `json:"webhook_url"`
+
+		UserPurchaseLimit       *uint `json:"user_purchase_limit"`
+		UserPurchaseLimitPeriod *int  `json:"user_purchase_limit_period"`
+		DailyPurchaseLimit      *uint `json:"daily_purchase_limit"`
 	}
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		restful.ParamErr(c, "参数错误")
 		return
 	}
 
+	if requestData.UserPurchaseLimitPeriod != nil {
+		if err := services.ValidatePurchaseLimitPeriod(*requestData.UserPurchaseLimitPeriod); err != nil {
+			restful.ParamErr(c, err.Error())
+			return
+		}
+	}
+
 	updateMap := functions.StructToMap(requestData, functions.StructToMapExcludeMode, "id")
+	if requestData.InputFields != nil {
+		if err := services.ValidateInputFields(*requestData.InputFields); err != nil {
+			restful.ParamErr(c, err.Error())
+			return
+		}
+		// 空列表表示清除输入字段
+		updateMap["input_fields"] = *requestData.InputFields
+	}
+	if requestData.DeliveryType != nil || requestData.WebhookURL != nil {
+		// 只修改其中一项时与原有的值合并校验
+		product, err := services.GetProductByID(*requestData.ID)
+		if err != nil {
+			restful.ParamErr(c, err.Error())
+			return
+		}
+		if requestData.DeliveryType != nil {
+			product.DeliveryType = *requestData.DeliveryType
+		}
+		if requestData.WebhookURL != nil {
+			product.WebhookURL = *requestData.WebhookURL
+		}
+		if err := services.ValidateProductDelivery(product.DeliveryType, product.WebhookURL); err != nil {
+			restful.ParamErr(c, err.Error())
+			return
+		}
+	}
 	err := services.UpdateProduct(*requestData.ID, updateMap)
 	if err != nil {
 		restful.ParamErr(c, "编辑失败")
@@ -57,6 +139,38 @@ func EditProduct(c *gin.Context) {
 	restful.Ok(c, "编辑成功")
 }
 
+// 设置定时上下架和限时特价,未传的项目会被清除
+func SetProductSchedule(c *gin.Context) {
+	var requestData struct {
+		ID            uuid.UUID        `json:"id" binding:"required"`
+		PublishTime   *int64           `json:"publish_time"`
+		UnpublishTime *int64           `json:"unpublish_time"`
+		SalePrice     *decimal.Decimal `json:"sale_price"`
+		SaleStartTime int64            `json:"sale_start_time"`
+		SaleEndTime   int64            `json:"sale_end_time"`
+		SaleLimit     uint             `json:"sale_limit"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	err := services.SetProductSchedule(requestData.ID, services.ProductSchedule{
+		PublishTime:   requestData.PublishTime,
+		UnpublishTime: requestData.UnpublishTime,
+		SalePrice:     requestData.SalePrice,
+		SaleStartTime: requestData.SaleStartTime,
+		SaleEndTime:   requestData.SaleEndTime,
+		SaleLimit:     requestData.SaleLimit,
+	})
+	if err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
+
+	restful.Ok(c, "设置成功")
+}
+
 //func DeleteProducts(c *gin.Context) {
 //	var requestData struct {
 //		IDsString string `json:"ids"`
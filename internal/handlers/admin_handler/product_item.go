@@ -1,40 +1,207 @@
 package admin_handler
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"gopay/internal/models"
+	"gopay/internal/handlers/tg_handler"
 	"gopay/internal/services"
 	"gopay/internal/utils/functions"
 	"gopay/internal/utils/restful"
+	"net/http"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
+var uploadFileMaxSize int64 = 50 << 20
+var uploadZipMaxSize int64 = 200 << 20
+
 func CreateProductItems(c *gin.Context) {
 	var requestData struct {
-		ProductID uuid.UUID `json:"product_id"`
-		Content   string    `json:"content"`
+		ProductID uuid.UUID  `json:"product_id"`
+		VariantID *uuid.UUID `json:"variant_id"` // 有规格的商品必须指定规格
+		Content   string     `json:"content"`
+		DryRun    bool       `json:"dry_run"` // 只检查重复和错误,不写入
 	}
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		restful.ParamErr(c, "参数错误")
 		return
 	}
 
-	var productItems []models.ProductItem
-	lines := strings.Split(requestData.Content, "\n")
-	for _, line := range lines {
-		if !functions.IsWhitespace(line) {
-			productItems = append(productItems, *models.NewProductItem(line, requestData.ProductID))
+	// 每行一个商品项目,与已有的重复的跳过
+	result, err := services.ImportProductItems(services.NewTextRowReader(strings.NewReader(requestData.Content)), services.ProductItemImportOptions{
+		ProductID: requestData.ProductID,
+		VariantID: requestData.VariantID,
+		DryRun:    requestData.DryRun,
+	})
+	respondProductItemImport(c, requestData.ProductID, result, err)
+}
+
+// 从csv或xlsx导入商品项目,可按列映射为结构化字段
+func ImportProductItems(c *gin.Context) {
+	productID, err := uuid.Parse(c.PostForm("product_id"))
+	if err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	options := services.ProductItemImportOptions{
+		ProductID: productID,
+		HasHeader: c.PostForm("has_header") == "true",
+		DryRun:    c.PostForm("dry_run") == "true",
+	}
+	if variantIDString := c.PostForm("variant_id"); variantIDString != "" {
+		variantID, err := uuid.Parse(variantIDString)
+		if err != nil {
+			restful.ParamErr(c, "参数错误")
+			return
 		}
+		options.VariantID = &variantID
+	}
+	// 如[{"label":"账号","column":"A"},{"label":"密码","column":"2"}]
+	if columnsString := c.PostForm("columns"); columnsString != "" {
+		if err := json.Unmarshal([]byte(columnsString), &options.Columns); err != nil {
+			restful.ParamErr(c, "列映射格式错误")
+			return
+		}
+	}
+	var delimiter rune
+	if delimiterString := c.PostForm("delimiter"); delimiterString != "" {
+		if delimiterString == "\\t" {
+			delimiterString = "\t"
+		}
+		if utf8.RuneCountInString(delimiterString) != 1 {
+			restful.ParamErr(c, "分隔符只能是一个字符")
+			return
+		}
+		delimiter, _ = utf8.DecodeRuneInString(delimiterString)
 	}
 
-	err := services.CreateProductItems(productItems)
+	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		restful.ParamErr(c, "创建失败")
+		restful.ParamErr(c, "请选择文件")
+		return
+	}
+	if fileHeader.Size > uploadZipMaxSize {
+		restful.ParamErr(c, "文件过大")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		restful.ParamErr(c, "读取文件失败")
+		return
+	}
+	defer file.Close()
+
+	var rows services.ProductItemRowReader
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".xlsx":
+		if rows, err = services.NewXLSXRowReader(file, fileHeader.Size); err != nil {
+			restful.ParamErr(c, err.Error())
+			return
+		}
+	case ".csv":
+		rows = services.NewCSVRowReader(file, delimiter)
+	case ".txt":
+		rows = services.NewTextRowReader(file)
+	default:
+		restful.ParamErr(c, "只支持csv、xlsx或txt文件")
 		return
 	}
 
-	restful.Ok(c, "创建成功")
+	result, err := services.ImportProductItems(rows, options)
+	respondProductItemImport(c, productID, result, err)
+}
+
+func respondProductItemImport(c *gin.Context, productID uuid.UUID, result *services.ProductItemImportResult, err error) {
+	if result == nil {
+		restful.ParamErr(c, "导入失败: "+err.Error())
+		return
+	}
+	// 中途出错时已导入的部分同样有效
+	if !result.DryRun && result.Imported > 0 {
+		// 预订订单已在创建时发货,剩余库存通知到货订阅用户
+		go tg_handler.NotifyRestock(productID)
+	}
+
+	resultMap := functions.StructToMap(*result, functions.StructToMapExcludeMode)
+	if err != nil {
+		restful.ParamErr(c, fmt.Sprintf("导入失败: %s, 已导入%d个", err.Error(), result.Imported), resultMap)
+		return
+	}
+	msgText := fmt.Sprintf("成功导入%d个, 重复%d个, 错误%d个", result.Imported, result.Duplicated, result.Failed)
+	if result.DryRun {
+		msgText = fmt.Sprintf("预览: 可导入%d个, 重复%d个, 错误%d个", result.Imported, result.Duplicated, result.Failed)
+	}
+	restful.Ok(c, msgText, resultMap)
+}
+
+// 上传文件商品项目,multipart表单: product_id, variant_id(有规格时), files(可多个), unzip(为true时zip内每个文件作为一个商品项目)
+func UploadProductItems(c *gin.Context) {
+	productID, err := uuid.Parse(c.PostForm("product_id"))
+	if err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	var variantID *uuid.UUID
+	if variantIDString := c.PostForm("variant_id"); variantIDString != "" {
+		parsedVariantID, err := uuid.Parse(variantIDString)
+		if err != nil {
+			restful.ParamErr(c, "参数错误")
+			return
+		}
+		variantID = &parsedVariantID
+	}
+	if err := services.CheckProductItemVariant(productID, variantID); err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		restful.ParamErr(c, "请选择文件")
+		return
+	}
+	unzip := c.PostForm("unzip") == "true"
+
+	// 文件逐个保存,不在内存中保留全部文件
+	writer := services.NewFileProductItemWriter(productID, variantID)
+	for _, fileHeader := range form.File["files"] {
+		isZip := unzip && strings.HasSuffix(strings.ToLower(fileHeader.Filename), ".zip")
+		if (isZip && fileHeader.Size > uploadZipMaxSize) || (!isZip && fileHeader.Size > uploadFileMaxSize) {
+			writer.Abort()
+			restful.ParamErr(c, "文件过大: "+fileHeader.Filename)
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			writer.Abort()
+			restful.ParamErr(c, "读取文件失败")
+			return
+		}
+		if isZip {
+			err = writer.AddZip(file, fileHeader.Size)
+		} else {
+			err = writer.Add(filepath.Base(fileHeader.Filename), file)
+		}
+		file.Close()
+		if err != nil {
+			writer.Abort()
+			restful.ParamErr(c, fileHeader.Filename+": "+err.Error())
+			return
+		}
+	}
+
+	if err := writer.Commit(); err != nil {
+		restful.ParamErr(c, "创建失败: "+err.Error())
+		return
+	}
+
+	go tg_handler.NotifyRestock(productID)
+
+	restful.Ok(c, fmt.Sprintf("成功创建%d个文件商品项目", writer.Count()))
 }
 
 func DeleteProductItems(c *gin.Context) {
@@ -64,3 +231,144 @@ func DeleteProductItems(c *gin.Context) {
 
 	restful.Ok(c, "删除成功")
 }
+
+// 流式导出商品项目,format为csv或json,statuses可选unsold、locked、sold、refunded
+func ExportProductItems(c *gin.Context) {
+	var requestData struct {
+		ProductID *uuid.UUID `json:"product_id"`
+		VariantID *uuid.UUID `json:"variant_id"`
+		Statuses  []string   `json:"statuses"`
+		StartTime int64      `json:"start_time"`
+		EndTime   int64      `json:"end_time"`
+		Format    string     `json:"format"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	if requestData.Format == "" {
+		requestData.Format = "csv"
+	}
+	if requestData.Format != "csv" && requestData.Format != "json" {
+		restful.ParamErr(c, "导出格式错误")
+		return
+	}
+	filter := services.ProductItemExportFilter{
+		ProductID: requestData.ProductID,
+		VariantID: requestData.VariantID,
+		Statuses:  requestData.Statuses,
+		StartTime: requestData.StartTime,
+		EndTime:   requestData.EndTime,
+	}
+
+	// 第一行数据写出前出错仍可返回错误信息,之后只能中断输出
+	started := false
+	count := 0
+	csvWriter := csv.NewWriter(c.Writer)
+	start := func() {
+		started = true
+		c.Header("Content-Description", "File Transfer")
+		c.Header("Content-Disposition", "attachment; filename=product_items."+requestData.Format)
+		if requestData.Format == "json" {
+			c.Header("Content-Type", "application/json")
+			c.Writer.WriteHeader(http.StatusOK)
+			c.Writer.WriteString("[")
+			return
+		}
+		c.Header("Content-Type", "text/csv")
+		c.Writer.WriteHeader(http.StatusOK)
+		csvWriter.Write([]string{"id", "product_id", "product_name", "variant_id", "variant_name", "status", "create_time", "content", "is_file", "fields",
+			"order_id", "order_status", "sold_time", "price", "currency", "network", "tg_chat_id", "tg_username"})
+	}
+	err := services.ExportProductItems(filter, func(row services.ProductItemExportRow) error {
+		if !started {
+			start()
+		}
+		if requestData.Format == "json" {
+			data, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				c.Writer.WriteString(",")
+			}
+			if _, err := c.Writer.Write(data); err != nil {
+				return err
+			}
+		} else {
+			csvWriter.Write(productItemExportCSVRecord(row))
+		}
+		count++
+		// 每批数据及时发送,避免大量数据堆积在内存中
+		if count%1000 == 0 {
+			csvWriter.Flush()
+			c.Writer.Flush()
+		}
+		if requestData.Format == "json" {
+			return nil
+		}
+		return csvWriter.Error()
+	})
+	if err != nil && !started {
+		restful.ParamErr(c, "导出失败: "+err.Error())
+		return
+	}
+	if !started {
+		start()
+	}
+	if err != nil {
+		// 已开始输出时无法返回错误,中断输出使文件不完整
+		c.Abort()
+		return
+	}
+	if requestData.Format == "json" {
+		c.Writer.WriteString("]")
+	}
+	csvWriter.Flush()
+	c.Writer.Flush()
+}
+
+func productItemExportCSVRecord(row services.ProductItemExportRow) []string {
+	optionalID := func(id *uuid.UUID) string {
+		if id == nil {
+			return ""
+		}
+		return id.String()
+	}
+	fields := ""
+	if len(row.Fields) > 0 {
+		data, _ := json.Marshal(row.Fields)
+		fields = string(data)
+	}
+	orderStatus := ""
+	if row.OrderStatus != nil {
+		orderStatus = strconv.Itoa(*row.OrderStatus)
+	}
+	soldTime, tgChatID := "", ""
+	if row.SoldTime > 0 {
+		soldTime = strconv.FormatInt(row.SoldTime, 10)
+	}
+	if row.TGChatID != 0 {
+		tgChatID = strconv.FormatInt(row.TGChatID, 10)
+	}
+	return []string{
+		row.ID.String(),
+		row.ProductID.String(),
+		row.ProductName,
+		optionalID(row.VariantID),
+		row.VariantName,
+		row.Status,
+		strconv.FormatInt(row.CreateTime, 10),
+		row.Content,
+		strconv.FormatBool(row.IsFile),
+		fields,
+		optionalID(row.OrderID),
+		orderStatus,
+		soldTime,
+		row.Price,
+		row.Currency,
+		row.Network,
+		tgChatID,
+		row.TGUsername,
+	}
+}
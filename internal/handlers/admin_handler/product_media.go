@@ -0,0 +1,102 @@
+package admin_handler
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gopay/internal/services"
+	"gopay/internal/utils/functions"
+	"gopay/internal/utils/restful"
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+// 上传商品图片或视频,可一次上传多张图片
+func UploadProductMedia(c *gin.Context) {
+	productID, err := uuid.Parse(c.PostForm("product_id"))
+	if err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	var priority int64
+	if priorityString := c.PostForm("priority"); priorityString != "" {
+		if priority, err = strconv.ParseInt(priorityString, 10, 64); err != nil {
+			restful.ParamErr(c, "参数错误")
+			return
+		}
+	}
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		restful.ParamErr(c, "请选择文件")
+		return
+	}
+
+	var files []services.ProductItemFile
+	for _, fileHeader := range form.File["files"] {
+		if fileHeader.Size > uploadFileMaxSize {
+			restful.ParamErr(c, "文件过大: "+fileHeader.Filename)
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			restful.ParamErr(c, "读取文件失败")
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			restful.ParamErr(c, "读取文件失败")
+			return
+		}
+		files = append(files, services.ProductItemFile{Name: filepath.Base(fileHeader.Filename), Data: data})
+	}
+
+	if err := services.CreateProductMedia(productID, priority, files); err != nil {
+		restful.ParamErr(c, "上传失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, fmt.Sprintf("成功上传%d个文件", len(files)))
+}
+
+func EditProductMedia(c *gin.Context) {
+	var requestData struct {
+		ID       *uuid.UUID `json:"id" binding:"required"`
+		Priority *int64     `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	updateMap := functions.StructToMap(requestData, functions.StructToMapExcludeMode, "id")
+	if err := services.UpdateProductMedia(*requestData.ID, updateMap); err != nil {
+		restful.ParamErr(c, "编辑失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "编辑成功")
+}
+
+func DeleteProductMedia(c *gin.Context) {
+	var requestData struct {
+		IDsString string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	ids, err := functions.ParseIDsString(requestData.IDsString)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+
+	if err := services.DeleteProductMedia(ids); err != nil {
+		restful.ParamErr(c, "删除失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "删除成功")
+}
@@ -0,0 +1,65 @@
+package admin_handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gopay/internal/exts/config"
+	"gopay/internal/services"
+	"gopay/internal/utils/functions"
+	"gopay/internal/utils/restful"
+)
+
+// 可用的语言,由templates目录下的语言目录决定
+func Languages(c *gin.Context) {
+	restful.Ok(c, map[string]interface{}{
+		"languages": config.GetLanguages(),
+	})
+}
+
+// 设置商品某种语言的名称和描述,已有翻译时覆盖
+func SetProductTranslation(c *gin.Context) {
+	var requestData struct {
+		ProductID   uuid.UUID `json:"product_id" binding:"required"`
+		Language    string    `json:"language" binding:"required"`
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	if requestData.Name == "" && requestData.Description == "" {
+		restful.ParamErr(c, "名称和描述不能都为空")
+		return
+	}
+
+	productTranslation, err := services.SetProductTranslation(requestData.ProductID, requestData.Language, requestData.Name, requestData.Description)
+	if err != nil {
+		restful.ParamErr(c, "保存失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "保存成功", functions.StructToMap(*productTranslation, functions.StructToMapExcludeMode))
+}
+
+func DeleteProductTranslations(c *gin.Context) {
+	var requestData struct {
+		IDsString string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	ids, err := functions.ParseIDsString(requestData.IDsString)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+
+	if err := services.DeleteProductTranslations(ids); err != nil {
+		restful.ParamErr(c, "删除失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "删除成功")
+}
@@ -0,0 +1,91 @@
+package admin_handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/models"
+	"gopay/internal/services"
+	"gopay/internal/utils/functions"
+	"gopay/internal/utils/restful"
+)
+
+// 创建商品规格,商品第一次添加规格时已有库存归入该规格
+func CreateProductVariant(c *gin.Context) {
+	var requestData struct {
+		ProductID uuid.UUID        `json:"product_id" binding:"required"`
+		Name      string           `json:"name" binding:"required"`
+		Price     decimal.Decimal  `json:"price" binding:"required"`
+		SalePrice *decimal.Decimal `json:"sale_price"` // 限时特价,时间和数量在商品中设置
+		Priority  int64            `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	if !requestData.Price.IsPositive() || (requestData.SalePrice != nil && !requestData.SalePrice.IsPositive()) {
+		restful.ParamErr(c, "价格必须大于0")
+		return
+	}
+
+	productVariant := models.NewProductVariant(requestData.Name, requestData.Price, requestData.Priority, requestData.ProductID)
+	productVariant.SalePrice = requestData.SalePrice
+	if err := services.CreateProductVariant(productVariant); err != nil {
+		restful.ParamErr(c, "创建失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "创建成功", functions.StructToMap(*productVariant, functions.StructToMapExcludeMode))
+}
+
+func EditProductVariant(c *gin.Context) {
+	var requestData struct {
+		ID        *uuid.UUID       `json:"id" binding:"required"`
+		Name      *string          `json:"name"`
+		Price     *decimal.Decimal `json:"price"`
+		SalePrice *decimal.Decimal `json:"sale_price"` // 为0则取消特价
+		Priority  *int64           `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	if (requestData.Price != nil && !requestData.Price.IsPositive()) || (requestData.SalePrice != nil && requestData.SalePrice.IsNegative()) {
+		restful.ParamErr(c, "价格必须大于0")
+		return
+	}
+
+	updateMap := functions.StructToMap(requestData, functions.StructToMapExcludeMode, "id")
+	if requestData.SalePrice != nil && requestData.SalePrice.IsZero() {
+		updateMap["sale_price"] = nil
+	}
+	if err := services.UpdateProductVariant(*requestData.ID, updateMap); err != nil {
+		restful.ParamErr(c, "编辑失败")
+		return
+	}
+
+	restful.Ok(c, "编辑成功")
+}
+
+// 删除规格,未售出的商品项目一并删除
+func DeleteProductVariants(c *gin.Context) {
+	var requestData struct {
+		IDsString string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	ids, err := functions.ParseIDsString(requestData.IDsString)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+
+	if err := services.DeleteProductVariants(ids); err != nil {
+		restful.ParamErr(c, "删除失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "删除成功")
+}
@@ -0,0 +1,71 @@
+package admin_handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/services"
+	"gopay/internal/utils/functions"
+	"gopay/internal/utils/restful"
+)
+
+// 创建退款,只生成待确认记录,需调用确认接口才会发送
+func CreateRefund(c *gin.Context) {
+	var requestData struct {
+		OrderID    uuid.UUID       `json:"order_id" binding:"required"`
+		Cate       int             `json:"cate" binding:"required"`
+		Amount     decimal.Decimal `json:"amount" binding:"required"`
+		ToAddress  string          `json:"to_address"`
+		ItemAction int             `json:"item_action"`
+		Remark     string          `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	refund, err := services.CreateRefund(requestData.OrderID, requestData.Cate, requestData.Amount, requestData.ToAddress, requestData.ItemAction, requestData.Remark)
+	if err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
+
+	restful.Ok(c, "已创建退款,请确认后发送", functions.StructToMap(*refund, functions.StructToMapExcludeMode))
+}
+
+// 确认退款,链上退款需要再次填写退款地址
+func ConfirmRefund(c *gin.Context) {
+	var requestData struct {
+		ID             uuid.UUID `json:"id" binding:"required"`
+		ConfirmAddress string    `json:"confirm_address"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	refund, err := services.ConfirmRefund(requestData.ID, requestData.ConfirmAddress)
+	if err != nil {
+		restful.ParamErr(c, "退款失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "退款成功", functions.StructToMap(*refund, functions.StructToMapExcludeMode))
+}
+
+func CancelRefund(c *gin.Context) {
+	var requestData struct {
+		ID uuid.UUID `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	if err := services.CancelRefund(requestData.ID); err != nil {
+		restful.ParamErr(c, err.Error())
+		return
+	}
+
+	restful.Ok(c, "取消成功")
+}
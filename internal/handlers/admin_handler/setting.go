@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"gopay/internal/exts/config"
+	"gopay/internal/services"
 	"gopay/internal/utils/functions"
 	"gopay/internal/utils/restful"
 	"regexp"
@@ -69,6 +70,26 @@ func EditSetting(c *gin.Context) {
 		}
 	}
 
+	if requestData.Key == "webhook_secret" {
+		value, ok := requestData.Value.(string)
+		if !ok {
+			restful.ParamErr(c, "类型错误")
+			return
+		}
+		// 接收方用密钥校验签名,有调用发货接口的商品时不能清空
+		if value == "" {
+			hasWebhookProduct, err := services.HasWebhookDeliveryProduct()
+			if err != nil {
+				restful.ParamErr(c, err.Error())
+				return
+			}
+			if hasWebhookProduct {
+				restful.ParamErr(c, "有调用发货接口的商品,签名密钥不能为空")
+				return
+			}
+		}
+	}
+
 	if requestData.Key == "fixed_exchange_rate" {
 		jsonData, err := json.Marshal(requestData.Value)
 		if err != nil {
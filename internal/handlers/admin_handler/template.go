@@ -0,0 +1,123 @@
+package admin_handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gopay/internal/exts/config"
+	"gopay/internal/services"
+	"gopay/internal/utils/functions"
+	"gopay/internal/utils/restful"
+)
+
+// 某种语言的模板列表,language为空则为基础语言
+func Templates(c *gin.Context) {
+	var requestData struct {
+		Language string `json:"language"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	templateFiles, err := services.GetTemplates(requestData.Language)
+	if err != nil {
+		restful.ParamErr(c, "获取失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, map[string]interface{}{
+		"items": templateFiles,
+	})
+}
+
+func Template(c *gin.Context) {
+	var requestData struct {
+		Language string `json:"language"`
+		Name     string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	templateFile, err := services.GetTemplate(requestData.Language, requestData.Name)
+	if err != nil {
+		restful.ParamErr(c, "获取失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, functions.StructToMap(*templateFile, functions.StructToMapExcludeMode))
+}
+
+// 使用示例订单和商品渲染模板,content为空时预览当前的模板
+func PreviewTemplate(c *gin.Context) {
+	var requestData struct {
+		Language string `json:"language"`
+		Name     string `json:"name" binding:"required"`
+		Content  string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	msgText, err := services.PreviewTemplate(requestData.Language, requestData.Name, requestData.Content)
+	if err != nil {
+		restful.ParamErr(c, "预览失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, map[string]interface{}{
+		"text": msgText,
+	})
+}
+
+// 校验通过后保存并立即生效,其他语言保存时创建该语言自己的模板
+func SaveTemplate(c *gin.Context) {
+	var requestData struct {
+		Language string `json:"language"`
+		Name     string `json:"name" binding:"required"`
+		Content  string `json:"content" binding:"required"`
+		Remark   string `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	templateVersion, err := services.SaveTemplate(requestData.Language, requestData.Name, requestData.Content, requestData.Remark)
+	if err != nil {
+		restful.ParamErr(c, "保存失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "保存成功", functions.StructToMap(*templateVersion, functions.StructToMapExcludeMode))
+}
+
+// 直接修改模板文件后重新加载,不需要重启
+func ReloadTemplates(c *gin.Context) {
+	if err := config.ReloadTemplates(); err != nil {
+		restful.ParamErr(c, "加载失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "加载成功")
+}
+
+func RollbackTemplate(c *gin.Context) {
+	var requestData struct {
+		ID uuid.UUID `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	templateVersion, err := services.RollbackTemplate(requestData.ID)
+	if err != nil {
+		restful.ParamErr(c, "回滚失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "回滚成功", functions.StructToMap(*templateVersion, functions.StructToMapExcludeMode))
+}
@@ -1 +1,68 @@
 package admin_handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gopay/internal/models"
+	"gopay/internal/services"
+	"gopay/internal/utils/functions"
+	"gopay/internal/utils/restful"
+)
+
+// 未匹配到订单的入账交易
+func UnmatchedTransfers(c *gin.Context) {
+	fetchListWithFilters[*models.Transfer](c, map[string]interface{}{
+		"status": 2,
+	})
+}
+
+func AssignTransfer(c *gin.Context) {
+	var requestData struct {
+		TransferID uuid.UUID `json:"transfer_id" binding:"required"`
+		OrderID    uuid.UUID `json:"order_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+
+	completed, err := services.AssignTransferToOrder(requestData.TransferID, requestData.OrderID)
+	if err != nil {
+		restful.ParamErr(c, "分配失败: "+err.Error())
+		return
+	}
+
+	if !completed {
+		restful.Ok(c, "分配成功,订单金额未付清")
+		return
+	}
+
+	// 订单完成,发货
+	services.OrderCallbackMultiple([]uuid.UUID{requestData.OrderID})
+	restful.Ok(c, "分配成功,订单已完成")
+}
+
+func ResolveTransfers(c *gin.Context) {
+	var requestData struct {
+		IDsString string `json:"ids"`
+		Status    int    `json:"status" binding:"required"`
+		Remark    string `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	ids, err := functions.ParseIDsString(requestData.IDsString)
+	if err != nil {
+		restful.ParamErr(c, "id格式错误")
+		return
+	}
+
+	err = services.ResolveTransfers(ids, requestData.Status, requestData.Remark)
+	if err != nil {
+		restful.ParamErr(c, "处理失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "处理成功")
+}
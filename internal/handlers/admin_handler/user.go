@@ -0,0 +1,31 @@
+package admin_handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gopay/internal/services"
+	"gopay/internal/utils/restful"
+)
+
+func EditUserBalance(c *gin.Context) {
+	var requestData struct {
+		TGChatID int64           `json:"tg_chat_id" binding:"required"`
+		Amount   decimal.Decimal `json:"amount" binding:"required"`
+		Remark   string          `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		restful.ParamErr(c, "参数错误")
+		return
+	}
+	if requestData.Amount.Equal(decimal.Zero) {
+		restful.ParamErr(c, "金额不能为0")
+		return
+	}
+
+	if err := services.AdjustUserBalance(requestData.TGChatID, requestData.Amount, requestData.Remark); err != nil {
+		restful.ParamErr(c, "修改失败: "+err.Error())
+		return
+	}
+
+	restful.Ok(c, "修改成功")
+}
@@ -0,0 +1,454 @@
+package tg_handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"gopay/internal/exts/cache"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/tg_bot"
+	"gopay/internal/models"
+	"gopay/internal/services"
+	"gopay/internal/utils/functions"
+	"html"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 以下为管理员命令,只响应AdminTGID,结果较多时通过按钮翻页
+// 与后台和发给管理员的通知一致,管理员命令固定使用中文,不跟随管理员的语言
+
+var AdminOrdersPagePrefix = "a_o_"
+var AdminStockPagePrefix = "a_s_"
+var AdminWalletsPagePrefix = "a_w_"
+
+var adminPageLimit = 10
+
+// /stock 的关键词按管理员保存,用于翻页
+var adminStockKeywordDuration = time.Hour
+
+// 机器人只能下载20MB以内的文件
+var adminStockFileMaxSize = 20 << 20
+
+// /addstock 结果中最多显示的错误行数
+var adminStockMaxErrors = 10
+
+func IsAdmin(chatID int64) bool {
+	return chatID != 0 && chatID == config.GetSiteConfig().AdminTGID
+}
+
+// 管理员命令的会话,非管理员返回false
+func adminChatID(update tgbotapi.Update) (int64, bool) {
+	var chatID int64
+	if update.Message != nil {
+		chatID = update.Message.Chat.ID
+	} else if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
+		chatID = update.CallbackQuery.Message.Chat.ID
+	}
+	return chatID, IsAdmin(chatID)
+}
+
+// 命令时发送新消息,翻页时编辑原消息
+func sendAdminPage(update tgbotapi.Update, chatID int64, msgText string, rows [][]tgbotapi.InlineKeyboardButton) {
+	if update.CallbackQuery != nil {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+		editMsg := tgbotapi.NewEditMessageText(chatID, update.CallbackQuery.Message.MessageID, msgText)
+		editMsg.ParseMode = "HTML"
+		editMsg.DisableWebPagePreview = true
+		if len(rows) != 0 {
+			markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+			editMsg.ReplyMarkup = &markup
+		}
+		tg_bot.Bot.Send(editMsg)
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, msgText)
+	msg.ParseMode = "HTML"
+	msg.DisableWebPagePreview = true
+	if len(rows) != 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	tg_bot.Bot.Send(msg)
+}
+
+func sendAdminText(chatID int64, msgText string) {
+	msg := tgbotapi.NewMessage(chatID, msgText)
+	msg.DisableWebPagePreview = true
+	tg_bot.Bot.Send(msg)
+}
+
+// 翻页按钮,只有一页时没有按钮
+func adminPageRows(pagination services.Pagination, pagePrefix string) [][]tgbotapi.InlineKeyboardButton {
+	var row []tgbotapi.InlineKeyboardButton
+	if pagination.Page > 1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("上一页", pagePrefix+strconv.Itoa(pagination.Page-1)))
+	}
+	if int64(pagination.Page) < pagination.TotalPage {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("下一页", pagePrefix+strconv.Itoa(pagination.Page+1)))
+	}
+	if len(row) == 0 {
+		return nil
+	}
+	return [][]tgbotapi.InlineKeyboardButton{row}
+}
+
+func adminPageNumber(update tgbotapi.Update, pagePrefix string) int {
+	if update.CallbackQuery == nil {
+		return 1
+	}
+	page, err := strconv.Atoi(strings.TrimPrefix(update.CallbackQuery.Data, pagePrefix))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// /stats 今日和昨日收入,与后台首页一致
+func AdminStatsCommand(update tgbotapi.Update) {
+	chatID, ok := adminChatID(update)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	todayIncome, err := services.GetOrderIncomeByTimestampRange(functions.TruncateToStartOfDay(now).Unix(), functions.TruncateToEndOfDay(now).Unix())
+	if err != nil {
+		sendAdminText(chatID, err.Error())
+		return
+	}
+	yesterday := now.AddDate(0, 0, -1)
+	yesterdayIncome, err := services.GetOrderIncomeByTimestampRange(functions.TruncateToStartOfDay(yesterday).Unix(), functions.TruncateToEndOfDay(yesterday).Unix())
+	if err != nil {
+		sendAdminText(chatID, err.Error())
+		return
+	}
+	pendingCount, err := services.CountPendingOrders()
+	if err != nil {
+		sendAdminText(chatID, err.Error())
+		return
+	}
+
+	exchangeRateMode := "实时汇率"
+	if config.SiteConfig.EnableFixExchangeRate {
+		exchangeRateMode = "固定汇率"
+	}
+	msgText := fmt.Sprintf("今日收入: %s %s\n昨日收入: %s %s\n待支付订单: %d\n汇率: %s", todayIncome.StringFixed(2), config.CNY, yesterdayIncome.StringFixed(2), config.CNY, pendingCount, exchangeRateMode)
+	sendAdminText(chatID, msgText)
+}
+
+// /orders pending 所有用户的待支付订单
+func AdminPendingOrders(update tgbotapi.Update) {
+	chatID, ok := adminChatID(update)
+	if !ok {
+		return
+	}
+
+	pagination := services.Pagination{Limit: adminPageLimit, Page: adminPageNumber(update, AdminOrdersPagePrefix)}
+	if err := services.GetPendingOrdersByAdmin(&pagination); err != nil {
+		sendAdminText(chatID, "获取订单失败")
+		return
+	}
+
+	var lines []string
+	for _, item := range pagination.Items {
+		order := item.(models.Order)
+		name := order.Product.Name + variantNameSuffix(order.VariantName)
+		if order.Cate == 1 {
+			name = fmt.Sprintf("余额充值 %s %s", order.BaseCurrencyPrice, order.BaseCurrency)
+		}
+		user := strconv.FormatInt(order.TGChatID, 10)
+		if order.TGUsername != "" {
+			user = "@" + order.TGUsername + " " + user
+		}
+		lines = append(lines, fmt.Sprintf("<code>%s</code>\n%s\n用户: %s\n金额: %s %s-%s, 已付: %s\n过期时间: %s",
+			order.ID, html.EscapeString(name), html.EscapeString(user), order.Price, order.Currency, order.Network, order.PaidPrice, time.Unix(order.EndTime, 0).Format("2006-01-02 15:04:05")))
+	}
+
+	msgText := fmt.Sprintf("待支付订单(共%d个, 第%d/%d页)", pagination.Total, pagination.Page, max(pagination.TotalPage, 1))
+	if len(lines) == 0 {
+		msgText += "\n\n没有待支付订单"
+	} else {
+		msgText += "\n\n" + strings.Join(lines, "\n\n") + "\n\n关闭订单: /release 订单ID"
+	}
+	sendAdminPage(update, chatID, msgText, adminPageRows(pagination, AdminOrdersPagePrefix))
+}
+
+// /release 订单ID,关闭待支付订单
+func AdminReleaseCommand(update tgbotapi.Update) {
+	chatID, ok := adminChatID(update)
+	if !ok {
+		return
+	}
+
+	orderID, err := uuid.Parse(strings.TrimSpace(update.Message.CommandArguments()))
+	if err != nil {
+		sendAdminText(chatID, "请在命令后输入订单ID, 例如: /release 订单ID")
+		return
+	}
+	order, err := services.ReleaseOrderByAdmin(orderID)
+	if err != nil {
+		sendAdminText(chatID, "关闭失败: "+err.Error())
+		return
+	}
+	sendAdminText(chatID, fmt.Sprintf("订单已关闭\n订单ID: %s\n金额: %s %s-%s", order.ID, order.Price, order.Currency, order.Network))
+}
+
+func adminStockKeywordKey(chatID int64) string {
+	return fmt.Sprintf("admin_stock_keyword_%d", chatID)
+}
+
+// /stock 商品ID或名称,查询商品和规格的库存,不输入则查询全部
+func AdminStockCommand(update tgbotapi.Update) {
+	chatID, ok := adminChatID(update)
+	if !ok {
+		return
+	}
+
+	keyword := ""
+	if update.Message != nil {
+		keyword = strings.TrimSpace(update.Message.CommandArguments())
+		cache.Cache.Set(adminStockKeywordKey(chatID), keyword, adminStockKeywordDuration)
+	} else if cachedKeyword, ok := cache.Cache.Get(adminStockKeywordKey(chatID)).(string); ok {
+		keyword = cachedKeyword
+	} else {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "查询已过期, 请重新查询"))
+		return
+	}
+
+	pagination := services.Pagination{Limit: adminPageLimit, Page: adminPageNumber(update, AdminStockPagePrefix)}
+	if err := services.SearchProductsByAdmin(&pagination, keyword); err != nil {
+		sendAdminText(chatID, "获取商品失败")
+		return
+	}
+	var productIDs []uuid.UUID
+	for _, item := range pagination.Items {
+		productIDs = append(productIDs, item.(models.Product).ID)
+	}
+	counts, err := services.GetProductItemCounts(productIDs)
+	if err != nil {
+		sendAdminText(chatID, err.Error())
+		return
+	}
+
+	var lines []string
+	for _, item := range pagination.Items {
+		product := item.(models.Product)
+		line := fmt.Sprintf("%s%s\n<code>%s</code>", html.EscapeString(product.Name), productStatusSuffix(product), product.ID)
+		if product.IsWebhookDelivery() {
+			line += "\n自动发货"
+		} else if len(product.Variants) == 0 {
+			line += "\n" + productItemCountText(counts[product.ID])
+		} else {
+			for _, variant := range product.Variants {
+				line += fmt.Sprintf("\n%s: %s", html.EscapeString(variant.Name), productItemCountText(counts[variant.ID]))
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	msgText := fmt.Sprintf("库存(共%d个商品, 第%d/%d页)", pagination.Total, pagination.Page, max(pagination.TotalPage, 1))
+	if keyword != "" {
+		msgText = fmt.Sprintf("库存: %s (共%d个商品, 第%d/%d页)", html.EscapeString(keyword), pagination.Total, pagination.Page, max(pagination.TotalPage, 1))
+	}
+	if len(lines) == 0 {
+		msgText += "\n\n没有找到商品"
+	} else {
+		msgText += "\n\n" + strings.Join(lines, "\n\n") + "\n\n补货: 回复包含商品项目的消息或文件 /addstock 商品ID [规格]"
+	}
+	sendAdminPage(update, chatID, msgText, adminPageRows(pagination, AdminStockPagePrefix))
+}
+
+func productStatusSuffix(product models.Product) string {
+	if product.Status != 1 {
+		return " [未上架]"
+	}
+	return ""
+}
+
+func productItemCountText(count *services.ProductItemCount) string {
+	if count == nil {
+		count = &services.ProductItemCount{}
+	}
+	return fmt.Sprintf("未售出%d, 待支付%d, 已售出%d", count.Unsold, count.Locked, count.Sold)
+}
+
+// /addstock 商品ID或名称 [规格ID或名称],回复一条消息导入商品项目,文字消息每行一个,文件支持txt、csv和xlsx
+func AdminAddStockCommand(update tgbotapi.Update) {
+	chatID, ok := adminChatID(update)
+	if !ok {
+		return
+	}
+
+	replyMsg := update.Message.ReplyToMessage
+	args := strings.Fields(update.Message.CommandArguments())
+	if replyMsg == nil || len(args) == 0 {
+		sendAdminText(chatID, "请回复包含商品项目的消息或文件, 并在命令后输入商品, 例如: /addstock 商品ID 规格")
+		return
+	}
+	product, err := services.GetProductByAdmin(args[0])
+	if err != nil {
+		sendAdminText(chatID, err.Error())
+		return
+	}
+	options := services.ProductItemImportOptions{ProductID: product.ID}
+	if len(args) > 1 {
+		variant, err := services.GetProductVariantByAdmin(product, strings.Join(args[1:], " "))
+		if err != nil {
+			sendAdminText(chatID, err.Error())
+			return
+		}
+		options.VariantID = &variant.ID
+	}
+
+	var rows services.ProductItemRowReader
+	if replyMsg.Document != nil {
+		rows, err = adminStockFileRows(replyMsg.Document)
+		if err != nil {
+			sendAdminText(chatID, err.Error())
+			return
+		}
+	} else if replyMsg.Text != "" {
+		rows = services.NewTextRowReader(strings.NewReader(replyMsg.Text))
+	} else {
+		sendAdminText(chatID, "回复的消息中没有商品项目")
+		return
+	}
+
+	result, err := services.ImportProductItems(rows, options)
+	if result == nil {
+		sendAdminText(chatID, "导入失败: "+err.Error())
+		return
+	}
+	// 中途出错时已导入的部分同样有效
+	if result.Imported > 0 {
+		go NotifyRestock(product.ID)
+	}
+
+	msgText := fmt.Sprintf("%s\n成功导入%d个, 重复%d个, 错误%d个", product.Name, result.Imported, result.Duplicated, result.Failed)
+	if err != nil {
+		msgText = fmt.Sprintf("%s\n导入失败: %s, 已导入%d个", product.Name, err.Error(), result.Imported)
+	}
+	for i, importError := range result.Errors {
+		if i >= adminStockMaxErrors {
+			msgText += fmt.Sprintf("\n...共%d行错误", result.Failed)
+			break
+		}
+		msgText += fmt.Sprintf("\n第%d行: %s", importError.Line, importError.Error)
+	}
+	sendAdminText(chatID, msgText)
+}
+
+// 下载回复消息中的文件,按扩展名读取
+func adminStockFileRows(document *tgbotapi.Document) (services.ProductItemRowReader, error) {
+	if document.FileSize > adminStockFileMaxSize {
+		return nil, fmt.Errorf("文件过大, 不能超过%dMB", adminStockFileMaxSize>>20)
+	}
+	ext := strings.ToLower(filepath.Ext(document.FileName))
+	if ext != ".txt" && ext != ".csv" && ext != ".xlsx" {
+		return nil, errors.New("只支持csv、xlsx或txt文件")
+	}
+
+	fileURL, err := tg_bot.Bot.GetFileDirectURL(document.FileID)
+	if err != nil {
+		return nil, errors.New("获取文件失败")
+	}
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, errors.New("获取文件失败")
+	}
+	resp, err := tg_bot.Bot.Client.Do(req)
+	if err != nil {
+		return nil, errors.New("下载文件失败")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("下载文件失败")
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(adminStockFileMaxSize)+1))
+	if err != nil || len(data) > adminStockFileMaxSize {
+		return nil, errors.New("下载文件失败")
+	}
+
+	switch ext {
+	case ".xlsx":
+		return services.NewXLSXRowReader(bytes.NewReader(data), int64(len(data)))
+	case ".csv":
+		return services.NewCSVRowReader(bytes.NewReader(data), 0), nil
+	default:
+		return services.NewTextRowReader(bytes.NewReader(data)), nil
+	}
+}
+
+// /wallets 钱包池状态和钱包列表
+func AdminWalletsCommand(update tgbotapi.Update) {
+	chatID, ok := adminChatID(update)
+	if !ok {
+		return
+	}
+
+	poolEntries, err := services.GetWalletPoolSummary()
+	if err != nil {
+		sendAdminText(chatID, err.Error())
+		return
+	}
+	pagination := services.Pagination{Limit: adminPageLimit, Page: adminPageNumber(update, AdminWalletsPagePrefix)}
+	if err := services.GetWalletsByAdmin(&pagination); err != nil {
+		sendAdminText(chatID, "获取钱包失败")
+		return
+	}
+
+	msgText := fmt.Sprintf("钱包池(共%d个)", pagination.Total)
+	for _, entry := range poolEntries {
+		msgText += fmt.Sprintf("\n%s %s: %d", entry.Network, walletStatusName(entry.Status), entry.Count)
+	}
+
+	var lines []string
+	for _, item := range pagination.Items {
+		wallet := item.(models.Wallet)
+		line := fmt.Sprintf("<code>%s</code>\n%s %s", wallet.Address, wallet.Network, walletStatusName(wallet.Status))
+		if wallet.Remark != "" {
+			line += " " + html.EscapeString(wallet.Remark)
+		}
+		if balanceText := walletBalanceText(wallet); balanceText != "" {
+			line += "\n余额: " + balanceText
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 0 {
+		msgText += fmt.Sprintf("\n\n钱包列表(第%d/%d页)\n\n%s", pagination.Page, max(pagination.TotalPage, 1), strings.Join(lines, "\n\n"))
+	}
+	sendAdminPage(update, chatID, msgText, adminPageRows(pagination, AdminWalletsPagePrefix))
+}
+
+func walletStatusName(status int) string {
+	switch status {
+	case 0:
+		return "占用中"
+	case 1:
+		return "空闲"
+	case 2:
+		return "小数尾数钱包"
+	case 3:
+		return "固定钱包专用"
+	}
+	return strconv.Itoa(status)
+}
+
+func walletBalanceText(wallet models.Wallet) string {
+	if wallet.BalanceData == nil {
+		return ""
+	}
+	var parts []string
+	for currency, balance := range *wallet.BalanceData {
+		parts = append(parts, fmt.Sprintf("%v %s", balance, currency))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
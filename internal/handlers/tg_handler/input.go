@@ -0,0 +1,239 @@
+package tg_handler
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"gopay/internal/exts/cache"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/tg_bot"
+	"gopay/internal/models"
+	"gopay/internal/services"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 下单前填写商品输入字段的会话,按聊天保存在缓存中,超时后需要重新选择支付方式
+type inputSession struct {
+	ProductID           uuid.UUID
+	VariantID           *uuid.UUID
+	VariantName         string
+	PaymentOptionString string
+	Step                int // 当前填写的字段序号,等于字段数量时为确认阶段
+	Data                models.JSONField
+	MsgID               int // 当前的提示消息,进入下一步时删除
+}
+
+var inputSessionDuration = time.Minute * 10
+
+var inputActionSkip = "skip"
+var inputActionConfirm = "ok"
+var inputActionRestart = "restart"
+var inputActionCancel = "cancel"
+
+func inputSessionKey(chatID int64) string {
+	return fmt.Sprintf("input_session_%d", chatID)
+}
+
+func getInputSession(chatID int64) (inputSession, bool) {
+	session, ok := cache.Cache.Get(inputSessionKey(chatID)).(inputSession)
+	return session, ok
+}
+
+func startInputSession(update tgbotapi.Update, product models.Product, variant *models.ProductVariant, paymentOptionString string) {
+	senderChatID := update.CallbackQuery.Message.Chat.ID
+
+	// 重新下单时覆盖旧的会话,并删除旧的提示消息
+	if oldSession, ok := getInputSession(senderChatID); ok && oldSession.MsgID != 0 {
+		tg_bot.DeleteMsg(senderChatID, oldSession.MsgID)
+	}
+	session := inputSession{
+		ProductID:           product.ID,
+		VariantID:           variantIDOf(variant),
+		PaymentOptionString: paymentOptionString,
+		Data:                models.JSONField{},
+	}
+	if variant != nil {
+		session.VariantName = variant.Name
+	}
+	tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+	clearProductMediaMsg(senderChatID, update.CallbackQuery.Message.MessageID)
+	tg_bot.DeleteMsg(senderChatID, update.CallbackQuery.Message.MessageID)
+	sendInputPrompt(senderChatID, product, session, nil)
+}
+
+// 发送当前步骤的提示,填写完成后发送确认消息
+func sendInputPrompt(chatID int64, product models.Product, session inputSession, inputErr error) {
+	language := services.GetUserLanguage(chatID)
+	services.TranslateProduct(language, &product)
+	if session.MsgID != 0 {
+		tg_bot.DeleteMsg(chatID, session.MsgID)
+	}
+
+	var msg tgbotapi.MessageConfig
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if session.Step >= len(product.InputFields) {
+		paymentMethod := session.PaymentOptionString
+		if paymentMethod == config.BalancePaymentMethod {
+			paymentMethod = config.T(language, "余额支付")
+		}
+		msg = tgbotapi.NewMessage(chatID, config.InputFieldConfirmMsg(language, map[string]interface{}{
+			"Product":       product,
+			"VariantName":   session.VariantName,
+			"Inputs":        product.InputFields.Entries(session.Data),
+			"PaymentMethod": paymentMethod,
+		}))
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData(config.T(language, "确认下单"), InputActionPrefix+inputActionConfirm),
+			tgbotapi.NewInlineKeyboardButtonData(config.T(language, "重新填写"), InputActionPrefix+inputActionRestart),
+		})
+	} else {
+		field := product.InputFields[session.Step]
+		var errText string
+		if inputErr != nil {
+			errText = errorText(language, inputErr)
+		}
+		msg = tgbotapi.NewMessage(chatID, config.InputFieldPromptMsg(language, map[string]interface{}{
+			"Product":     product,
+			"VariantName": session.VariantName,
+			"Field":       field,
+			"Step":        session.Step + 1,
+			"Total":       len(product.InputFields),
+			"Error":       errText,
+		}))
+		if field.Type == models.InputFieldTypeChoice {
+			var row []tgbotapi.InlineKeyboardButton
+			for i, option := range field.Options {
+				callbackData := fmt.Sprintf("%s%d_%d", InputChoicePrefix, session.Step, i)
+				row = append(row, tgbotapi.NewInlineKeyboardButtonData(option, callbackData))
+				if len(row) == 2 {
+					rows = append(rows, row)
+					row = nil
+				}
+			}
+			if len(row) != 0 {
+				rows = append(rows, row)
+			}
+		}
+		if !field.Required {
+			callbackData := fmt.Sprintf("%s%s_%d", InputActionPrefix, inputActionSkip, session.Step)
+			rows = append(rows, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "跳过"), callbackData)})
+		}
+	}
+	rows = append(rows, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "取消"), InputActionPrefix+inputActionCancel)})
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	result, err := tg_bot.Bot.Send(msg)
+	if err != nil {
+		return
+	}
+	session.MsgID = result.MessageID
+	cache.Cache.Set(inputSessionKey(chatID), session, inputSessionDuration)
+}
+
+// 保存当前步骤的值并进入下一步,值不合法时重新提示
+func submitInputValue(chatID int64, product models.Product, session inputSession, value string) {
+	field := product.InputFields[session.Step]
+	parsedValue, err := services.ParseInputValue(field, value)
+	if err != nil {
+		sendInputPrompt(chatID, product, session, err)
+		return
+	}
+	session.Data[field.Key] = parsedValue
+	session.Step++
+	sendInputPrompt(chatID, product, session, nil)
+}
+
+// 用户发送的文本,有填写会话时作为当前字段的值,否则忽略
+func InputText(update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+	session, ok := getInputSession(chatID)
+	if !ok || update.Message.Text == "" {
+		return
+	}
+	// 确认阶段不接受文本
+	product, err := services.GetProductByIDByCustomer(session.ProductID)
+	if err != nil || session.Step >= len(product.InputFields) {
+		return
+	}
+	submitInputValue(chatID, product, session, update.Message.Text)
+}
+
+func InputChoice(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	chatID := update.CallbackQuery.Message.Chat.ID
+	parts := strings.Split(strings.TrimPrefix(update.CallbackQuery.Data, InputChoicePrefix), "_")
+	if len(parts) != 2 {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "参数错误")))
+		return
+	}
+	step, err1 := strconv.Atoi(parts[0])
+	optionIndex, err2 := strconv.Atoi(parts[1])
+	session, ok := getInputSession(chatID)
+	if err1 != nil || err2 != nil || !ok || session.Step != step || session.MsgID != update.CallbackQuery.Message.MessageID {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "已过期,请重新下单")))
+		return
+	}
+
+	product, err := services.GetProductByIDByCustomer(session.ProductID)
+	if err != nil || step >= len(product.InputFields) || optionIndex < 0 || optionIndex >= len(product.InputFields[step].Options) {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "选项不存在")))
+		return
+	}
+	tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+	submitInputValue(chatID, product, session, product.InputFields[step].Options[optionIndex])
+}
+
+func InputAction(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	chatID := update.CallbackQuery.Message.Chat.ID
+	action := strings.TrimPrefix(update.CallbackQuery.Data, InputActionPrefix)
+
+	session, ok := getInputSession(chatID)
+	if !ok || session.MsgID != update.CallbackQuery.Message.MessageID {
+		tg_bot.DeleteMsg(chatID, update.CallbackQuery.Message.MessageID)
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "已过期,请重新下单")))
+		return
+	}
+	if action == inputActionCancel {
+		cache.Cache.Delete(inputSessionKey(chatID))
+		tg_bot.DeleteMsg(chatID, session.MsgID)
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "已取消")))
+		return
+	}
+
+	product, err := services.GetProductByIDByCustomer(session.ProductID)
+	if err != nil {
+		cache.Cache.Delete(inputSessionKey(chatID))
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "商品不存在")))
+		return
+	}
+
+	switch {
+	case action == inputActionConfirm:
+		if session.Step < len(product.InputFields) {
+			tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "请先填写完成")))
+			return
+		}
+		// 下单时服务端会再次校验全部字段,商品字段变更导致失败时需重新填写
+		cache.Cache.Delete(inputSessionKey(chatID))
+		createOrderAndPay(update, product, session.VariantID, session.PaymentOptionString, session.Data)
+	case action == inputActionRestart:
+		session.Step = 0
+		session.Data = models.JSONField{}
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+		sendInputPrompt(chatID, product, session, nil)
+	case strings.HasPrefix(action, inputActionSkip+"_"):
+		step, err := strconv.Atoi(strings.TrimPrefix(action, inputActionSkip+"_"))
+		if err != nil || step != session.Step || step >= len(product.InputFields) || product.InputFields[step].Required {
+			tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "该项不能跳过")))
+			return
+		}
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+		session.Step++
+		sendInputPrompt(chatID, product, session, nil)
+	default:
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "参数错误")))
+	}
+}
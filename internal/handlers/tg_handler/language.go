@@ -0,0 +1,76 @@
+package tg_handler
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/tg_bot"
+	"gopay/internal/services"
+	"strings"
+)
+
+var LanguagePrefix = "lang_"
+
+// 清除选择的语言,跟随Telegram客户端语言
+var languageAuto = "auto"
+
+// 发送消息的用户使用的语言,同时记录用户的Telegram客户端语言
+func updateLanguage(update tgbotapi.Update) string {
+	user := update.SentFrom()
+	if user == nil {
+		return config.GetDefaultLanguage()
+	}
+	services.SetTGLanguageCode(user.ID, user.UserName, user.LanguageCode)
+	return services.GetUserLanguage(user.ID)
+}
+
+// 服务返回的错误按用户的语言显示,没有翻译时显示原文
+func errorText(language string, err error) string {
+	return services.ErrorText(language, err)
+}
+
+func languageMarkup(language string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, v := range config.GetLanguages() {
+		buttonText := v.Name
+		if v.Code == language {
+			buttonText = "✅ " + buttonText
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(buttonText, LanguagePrefix+v.Code))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) != 0 {
+		rows = append(rows, row)
+	}
+	rows = append(rows, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "跟随Telegram语言"), LanguagePrefix+languageAuto)})
+	rows = append(rows, deleteMsgRow(language))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// /language 选择机器人的语言
+func LanguageCommand(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, config.T(language, "请选择语言"))
+	msg.ReplyMarkup = languageMarkup(language)
+	tg_bot.Bot.Send(msg)
+}
+
+func SetLanguage(update tgbotapi.Update) {
+	selected := strings.TrimPrefix(update.CallbackQuery.Data, LanguagePrefix)
+	if selected == languageAuto {
+		selected = ""
+	}
+	if err := services.SetUserLanguage(update.CallbackQuery.From.ID, update.CallbackQuery.From.UserName, selected); err != nil {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(updateLanguage(update), err)))
+		return
+	}
+
+	// 使用新的语言刷新选择消息
+	language := updateLanguage(update)
+	tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "语言已切换")))
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, config.T(language, "请选择语言"), languageMarkup(language))
+	tg_bot.Bot.Send(editMsg)
+}
@@ -4,17 +4,22 @@ import (
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"gopay/internal/exts/config"
 	"gopay/internal/models"
 	"gopay/internal/services"
 )
 
-func paginationToRows(pagination services.Pagination) [][]tgbotapi.InlineKeyboardButton {
+// pagePrefix为翻页按钮的前缀,后接页码
+func paginationToRows(language string, pagination services.Pagination, pagePrefix string) [][]tgbotapi.InlineKeyboardButton {
 	var rows [][]tgbotapi.InlineKeyboardButton
 
 	for _, item := range pagination.Items {
 		product := item.(models.Product)
-		buttonText := fmt.Sprintf("%s : %s 库存:%d", product.Name, product.Description, product.InStockCount)
+		buttonText := config.Tf(language, "%s : %s 库存:%d", product.Name, product.Description, product.InStockCount)
+		if product.IsWebhookDelivery() {
+			buttonText = config.Tf(language, "%s : %s 自动发货", product.Name, product.Description)
+		}
 
 		row := []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(buttonText, ProductDetailPrefix+product.ID.String())}
 		rows = append(rows, row)
@@ -22,10 +27,10 @@ func paginationToRows(pagination services.Pagination) [][]tgbotapi.InlineKeyboar
 
 	var paginationRow []tgbotapi.InlineKeyboardButton
 	if pagination.Page > 1 {
-		paginationRow = append(paginationRow, tgbotapi.NewInlineKeyboardButtonData("上一页", ProductListPagePrefix+fmt.Sprintf("%d", pagination.Page-1)))
+		paginationRow = append(paginationRow, tgbotapi.NewInlineKeyboardButtonData(config.T(language, "上一页"), pagePrefix+fmt.Sprintf("%d", pagination.Page-1)))
 	}
 	if int64(pagination.Page) < pagination.TotalPage {
-		paginationRow = append(paginationRow, tgbotapi.NewInlineKeyboardButtonData("下一页", ProductListPagePrefix+fmt.Sprintf("%d", pagination.Page+1)))
+		paginationRow = append(paginationRow, tgbotapi.NewInlineKeyboardButtonData(config.T(language, "下一页"), pagePrefix+fmt.Sprintf("%d", pagination.Page+1)))
 	}
 	// row不能为空，空了发不出去
 	if len(paginationRow) != 0 {
@@ -35,22 +40,155 @@ func paginationToRows(pagination services.Pagination) [][]tgbotapi.InlineKeyboar
 	return rows
 }
 
-func paymentSelectRow(productID uuid.UUID) []tgbotapi.InlineKeyboardButton {
+// 分类按钮,两个一行
+func categoryRows(categoryEntries []services.CategoryEntry) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, categoryEntry := range categoryEntries {
+		buttonText := fmt.Sprintf("%s%s (%d)", categoryEntry.Category.Icon, categoryEntry.Category.Name, categoryEntry.ProductCount)
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(buttonText, categoryPagePrefix(&categoryEntry.Category.ID)+"1"))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) != 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// 分类商品列表的翻页前缀,categoryID为空时为商品列表首页
+func categoryPagePrefix(categoryID *uuid.UUID) string {
+	if categoryID == nil {
+		return ProductListPagePrefix
+	}
+	return CategoryPrefix + categoryID.String() + "_"
+}
+
+// payPrefix为PayOrderPrefix时id为商品ID,为PayVariantOrderPrefix时为规格ID
+func paymentSelectRow(payPrefix string, id uuid.UUID) []tgbotapi.InlineKeyboardButton {
 	var paymentSelectRow []tgbotapi.InlineKeyboardButton
 	for _, v := range config.GetAvailablePaymentMethods() {
-		callbackData := fmt.Sprintf("%s%s_%s", PayOrderPrefix, productID, v)
+		callbackData := fmt.Sprintf("%s%s_%s", payPrefix, id, v)
 		paymentSelectRow = append(paymentSelectRow, tgbotapi.NewInlineKeyboardButtonData(v, callbackData))
 	}
 	return paymentSelectRow
 }
-func deleteMsgRow() []tgbotapi.InlineKeyboardButton {
+func balancePayRow(language string, payPrefix string, id uuid.UUID) []tgbotapi.InlineKeyboardButton {
+	callbackData := fmt.Sprintf("%s%s_%s", payPrefix, id, config.BalancePaymentMethod)
+	return []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "余额支付"), callbackData)}
+}
+func restockSubscribeRow(language string, productID uuid.UUID) []tgbotapi.InlineKeyboardButton {
+	return []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "到货通知"), RestockSubscribePrefix+productID.String())}
+}
+
+// 商品或规格详情的购买按钮,缺货且不可预订时只提供到货通知,接口发货的商品不受库存限制;没有支付方式时返回false
+func productPurchaseRows(language string, product models.Product, payPrefix string, id uuid.UUID, inStockCount uint) ([][]tgbotapi.InlineKeyboardButton, bool) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if inStockCount > 0 || product.EnablePreOrder || product.IsWebhookDelivery() {
+		paymentRow := paymentSelectRow(payPrefix, id)
+		if len(paymentRow) == 0 {
+			return nil, false
+		}
+		rows = append(rows, paymentRow, balancePayRow(language, payPrefix, id))
+	}
+	if inStockCount == 0 && !product.IsWebhookDelivery() {
+		rows = append(rows, restockSubscribeRow(language, product.ID))
+	}
+	return rows, true
+}
+
+// 商品详情的规格按钮
+func variantSelectRows(language string, product models.Product) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, variant := range product.Variants {
+		price := variant.Price.String()
+		if sale, _ := services.GetProductSale(product, &variant); sale != nil {
+			price = config.T(language, "特价") + sale.Price.String()
+		}
+		buttonText := config.Tf(language, "%s %s%s 库存:%d", variant.Name, price, product.Currency, variant.InStockCount)
+		if product.IsWebhookDelivery() {
+			buttonText = fmt.Sprintf("%s %s%s", variant.Name, price, product.Currency)
+		}
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(buttonText, VariantDetailPrefix+variant.ID.String())})
+	}
+	return rows
+}
+
+func variantNameSuffix(variantName string) string {
+	if variantName == "" {
+		return ""
+	}
+	return " " + variantName
+}
+func depositAmountRows() [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, amount := range config.GetDepositAmounts() {
+		buttonText := fmt.Sprintf("%s %s", amount, config.BalanceCurrency)
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(buttonText, DepositAmountPrefix+amount.String()))
+		if len(row) == 3 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) != 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+func depositPaymentSelectRow(amount decimal.Decimal) []tgbotapi.InlineKeyboardButton {
+	var paymentSelectRow []tgbotapi.InlineKeyboardButton
+	for _, v := range config.GetAvailablePaymentMethods() {
+		callbackData := fmt.Sprintf("%s%s_%s", DepositOrderPrefix, amount, v)
+		paymentSelectRow = append(paymentSelectRow, tgbotapi.NewInlineKeyboardButtonData(v, callbackData))
+	}
+	return paymentSelectRow
+}
+
+// 付款消息的按钮
+func payOrderMarkup(language string, orderID uuid.UUID) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	rows = append(rows, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "我已付款"), CheckPaymentPrefix+orderID.String())})
+	rows = append(rows, []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(config.T(language, "更换支付方式"), SwitchPaymentPrefix+orderID.String()),
+		tgbotapi.NewInlineKeyboardButtonData(config.T(language, "取消订单"), CancelOrderPrefix+orderID.String()),
+	})
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// 更换支付方式的选项,不包括当前的支付方式
+func switchPaymentMarkup(language string, order models.Order) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	currentPaymentMethod := fmt.Sprintf("%s-%s", order.Currency, order.Network)
+	for _, v := range config.GetAvailablePaymentMethods() {
+		if v == currentPaymentMethod {
+			continue
+		}
+		callbackData := fmt.Sprintf("%s%s_%s", SwitchPaymentPrefix, order.ID, v)
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(v, callbackData))
+	}
+	if len(row) != 0 {
+		rows = append(rows, row)
+	}
+	rows = append(rows, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "返回"), fmt.Sprintf("%s%s_%s", SwitchPaymentPrefix, order.ID, switchPaymentBack))})
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+func deleteMsgRow(language string) []tgbotapi.InlineKeyboardButton {
 	var paymentSelectRow []tgbotapi.InlineKeyboardButton
-	paymentSelectRow = append(paymentSelectRow, tgbotapi.NewInlineKeyboardButtonData("关闭", "delete_msg"))
+	paymentSelectRow = append(paymentSelectRow, tgbotapi.NewInlineKeyboardButtonData(config.T(language, "关闭"), "delete_msg"))
 
 	return paymentSelectRow
 }
 
-func GoBackRow(callBackData string) []tgbotapi.InlineKeyboardButton {
-	goBackRow := []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData("返回", callBackData)}
+// 选择聊天后以内联模式搜索该商品,发送商品卡片
+func shareProductRow(language string, product models.Product) []tgbotapi.InlineKeyboardButton {
+	return []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonSwitch(config.T(language, "分享商品"), product.Name)}
+}
+
+func GoBackRow(language string, callBackData string) []tgbotapi.InlineKeyboardButton {
+	goBackRow := []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "返回"), callBackData)}
 	return goBackRow
 }
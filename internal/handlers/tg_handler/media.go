@@ -0,0 +1,235 @@
+package tg_handler
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"gopay/internal/exts/cache"
+	"gopay/internal/exts/tg_bot"
+	"gopay/internal/models"
+	"gopay/internal/services"
+	"time"
+	"unicode/utf8"
+)
+
+// Telegram图片、视频说明的长度上限
+var mediaCaptionMaxLength = 1024
+
+// 超过48小时的消息机器人无法删除,不再记录
+var productMediaMsgDuration = time.Hour * 48
+
+// 带图片或视频的商品详情消息,相册不能带按钮,按钮在相册之后单独的文字消息中
+type productMediaMsg struct {
+	ProductID   uuid.UUID
+	GroupMsgIDs []int // 相册消息,离开商品详情时一并删除
+}
+
+func productMediaMsgKey(chatID int64, msgID int) string {
+	return fmt.Sprintf("product_media_msg_%d_%d", chatID, msgID)
+}
+
+func getProductMediaMsg(chatID int64, msgID int) (productMediaMsg, bool) {
+	mediaMsg, ok := cache.Cache.Get(productMediaMsgKey(chatID, msgID)).(productMediaMsg)
+	return mediaMsg, ok
+}
+
+// 删除按钮消息对应的相册
+func clearProductMediaMsg(chatID int64, msgID int) {
+	mediaMsg, ok := getProductMediaMsg(chatID, msgID)
+	if !ok {
+		return
+	}
+	cache.Cache.Delete(productMediaMsgKey(chatID, msgID))
+	for _, groupMsgID := range mediaMsg.GroupMsgIDs {
+		tg_bot.DeleteMsg(chatID, groupMsgID)
+	}
+}
+
+// 编辑回调消息为文字消息,productID与消息中的商品相同时保留图片或视频,否则删除媒体消息后重新发送文字消息
+func editCallbackMsg(update tgbotapi.Update, msgText string, markup tgbotapi.InlineKeyboardMarkup, productID *uuid.UUID) {
+	message := update.CallbackQuery.Message
+	chatID := message.Chat.ID
+
+	mediaMsg, ok := getProductMediaMsg(chatID, message.MessageID)
+	keepMedia := ok && productID != nil && mediaMsg.ProductID == *productID
+	if ok && !keepMedia {
+		clearProductMediaMsg(chatID, message.MessageID)
+	}
+
+	if message.Text != "" {
+		newMsg := tgbotapi.NewEditMessageText(chatID, message.MessageID, msgText)
+		newMsg.ReplyMarkup = &markup
+		tg_bot.Bot.Send(newMsg)
+		return
+	}
+	if keepMedia && len(mediaMsg.GroupMsgIDs) == 0 && utf8.RuneCountInString(msgText) <= mediaCaptionMaxLength {
+		newMsg := tgbotapi.NewEditMessageCaption(chatID, message.MessageID, msgText)
+		newMsg.ReplyMarkup = &markup
+		tg_bot.Bot.Send(newMsg)
+		return
+	}
+
+	// 图片消息不能编辑为文字消息
+	tg_bot.DeleteMsg(chatID, message.MessageID)
+	newMsg := tgbotapi.NewMessage(chatID, msgText)
+	newMsg.ReplyMarkup = markup
+	tg_bot.Bot.Send(newMsg)
+}
+
+// 发送或编辑带图片、视频的商品详情,从同一商品的规格返回时只修改文字
+func showProductMedia(update tgbotapi.Update, product models.Product, msgText string, markup tgbotapi.InlineKeyboardMarkup) {
+	message := update.CallbackQuery.Message
+	chatID := message.Chat.ID
+
+	if mediaMsg, ok := getProductMediaMsg(chatID, message.MessageID); ok && mediaMsg.ProductID == product.ID {
+		if len(mediaMsg.GroupMsgIDs) == 0 && message.Text == "" && utf8.RuneCountInString(msgText) <= mediaCaptionMaxLength {
+			newMsg := tgbotapi.NewEditMessageCaption(chatID, message.MessageID, msgText)
+			newMsg.ReplyMarkup = &markup
+			tg_bot.Bot.Send(newMsg)
+			return
+		}
+		if len(mediaMsg.GroupMsgIDs) > 0 && message.Text != "" {
+			newMsg := tgbotapi.NewEditMessageText(chatID, message.MessageID, productMediaKeyboardText(product, msgText))
+			newMsg.ReplyMarkup = &markup
+			tg_bot.Bot.Send(newMsg)
+			return
+		}
+	}
+
+	clearProductMediaMsg(chatID, message.MessageID)
+	tg_bot.DeleteMsg(chatID, message.MessageID)
+	sendProductMediaOrText(chatID, product, msgText, markup)
+}
+
+// 发送带图片、视频的商品详情,发送失败时改为发送文字消息
+func sendProductMediaOrText(chatID int64, product models.Product, msgText string, markup tgbotapi.InlineKeyboardMarkup) {
+	err := sendProductMedia(chatID, product, msgText, markup, true)
+	if err != nil && productMediaHasFileID(product.Media) {
+		// 缓存的file_id失效时重新上传
+		err = sendProductMedia(chatID, product, msgText, markup, false)
+	}
+	if err != nil {
+		newMsg := tgbotapi.NewMessage(chatID, msgText)
+		newMsg.ReplyMarkup = markup
+		tg_bot.Bot.Send(newMsg)
+	}
+}
+
+func productMediaHasFileID(mediaList []models.ProductMedia) bool {
+	for _, media := range mediaList {
+		if media.TGFileID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// 相册已带有商品详情时,按钮消息只显示商品名称
+func productMediaKeyboardText(product models.Product, msgText string) string {
+	if utf8.RuneCountInString(msgText) <= mediaCaptionMaxLength {
+		return product.Name
+	}
+	return msgText
+}
+
+// 单个媒体直接带说明和按钮发送,多个媒体以相册发送后再发送按钮消息
+func sendProductMedia(chatID int64, product models.Product, msgText string, markup tgbotapi.InlineKeyboardMarkup, useFileID bool) error {
+	captionFits := utf8.RuneCountInString(msgText) <= mediaCaptionMaxLength
+	files := make([]tgbotapi.RequestFileData, len(product.Media))
+	for i, media := range product.Media {
+		file, err := productMediaFile(media, useFileID)
+		if err != nil {
+			return err
+		}
+		files[i] = file
+	}
+
+	if len(product.Media) == 1 && captionFits {
+		var chattable tgbotapi.Chattable
+		if product.Media[0].Type == models.ProductMediaTypeVideo {
+			videoMsg := tgbotapi.NewVideo(chatID, files[0])
+			videoMsg.Caption = msgText
+			videoMsg.ReplyMarkup = markup
+			chattable = videoMsg
+		} else {
+			photoMsg := tgbotapi.NewPhoto(chatID, files[0])
+			photoMsg.Caption = msgText
+			photoMsg.ReplyMarkup = markup
+			chattable = photoMsg
+		}
+		result, err := tg_bot.Bot.Send(chattable)
+		if err != nil {
+			return err
+		}
+		saveProductMediaFileIDs(product.Media, []tgbotapi.Message{result})
+		cache.Cache.Set(productMediaMsgKey(chatID, result.MessageID), productMediaMsg{ProductID: product.ID}, productMediaMsgDuration)
+		return nil
+	}
+
+	inputMediaList := make([]interface{}, len(product.Media))
+	for i, media := range product.Media {
+		caption := ""
+		if i == 0 && captionFits {
+			caption = msgText
+		}
+		if media.Type == models.ProductMediaTypeVideo {
+			inputMedia := tgbotapi.NewInputMediaVideo(files[i])
+			inputMedia.Caption = caption
+			inputMediaList[i] = inputMedia
+		} else {
+			inputMedia := tgbotapi.NewInputMediaPhoto(files[i])
+			inputMedia.Caption = caption
+			inputMediaList[i] = inputMedia
+		}
+	}
+	results, err := tg_bot.Bot.SendMediaGroup(tgbotapi.NewMediaGroup(chatID, inputMediaList))
+	if err != nil {
+		return err
+	}
+	saveProductMediaFileIDs(product.Media, results)
+
+	groupMsgIDs := make([]int, len(results))
+	for i, result := range results {
+		groupMsgIDs[i] = result.MessageID
+	}
+	keyboardMsg := tgbotapi.NewMessage(chatID, productMediaKeyboardText(product, msgText))
+	keyboardMsg.ReplyMarkup = markup
+	result, err := tg_bot.Bot.Send(keyboardMsg)
+	if err != nil {
+		for _, groupMsgID := range groupMsgIDs {
+			tg_bot.DeleteMsg(chatID, groupMsgID)
+		}
+		return err
+	}
+	cache.Cache.Set(productMediaMsgKey(chatID, result.MessageID), productMediaMsg{ProductID: product.ID, GroupMsgIDs: groupMsgIDs}, productMediaMsgDuration)
+	return nil
+}
+
+func productMediaFile(media models.ProductMedia, useFileID bool) (tgbotapi.RequestFileData, error) {
+	if useFileID && media.TGFileID != "" {
+		return tgbotapi.FileID(media.TGFileID), nil
+	}
+	data, err := services.GetProductMediaData(media)
+	if err != nil {
+		return nil, err
+	}
+	return tgbotapi.FileBytes{Name: media.FileName, Bytes: data}, nil
+}
+
+// 记录Telegram返回的file_id,之后不再重复上传
+func saveProductMediaFileIDs(mediaList []models.ProductMedia, results []tgbotapi.Message) {
+	for i, result := range results {
+		if i >= len(mediaList) {
+			break
+		}
+		fileID := ""
+		if len(result.Photo) > 0 {
+			fileID = result.Photo[len(result.Photo)-1].FileID
+		} else if result.Video != nil {
+			fileID = result.Video.FileID
+		}
+		if fileID != "" && fileID != mediaList[i].TGFileID {
+			services.SetProductMediaFileID(mediaList[i].ID, fileID)
+		}
+	}
+}
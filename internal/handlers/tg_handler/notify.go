@@ -0,0 +1,98 @@
+package tg_handler
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/tg_bot"
+	"gopay/internal/models"
+	"gopay/internal/services"
+)
+
+// 以下为定时任务触发的用户通知
+
+// 订单过期,删除付款二维码,发送过期通知和重新下单按钮
+func NotifyOrderExpired(order models.Order) error {
+	if order.TGMsgID != 0 {
+		tg_bot.DeleteMsg(order.TGChatID, int(order.TGMsgID))
+	}
+
+	language := services.GetUserLanguage(order.TGChatID)
+	product := order.Product
+	services.TranslateProduct(language, &product)
+	msgText := config.OrderExpiredMsg(language, map[string]interface{}{
+		"Order":   order,
+		"Product": product,
+	})
+	msg := tgbotapi.NewMessage(order.TGChatID, msgText)
+
+	var reorderRow []tgbotapi.InlineKeyboardButton
+	if order.Cate == 1 {
+		reorderRow = []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "重新充值"), DepositAmountPrefix+order.BaseCurrencyPrice.String())}
+	} else if order.VariantID != nil {
+		reorderRow = []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "重新下单"), VariantDetailPrefix+order.VariantID.String())}
+	} else if order.ProductID != nil {
+		reorderRow = []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "重新下单"), ProductDetailPrefix+order.ProductID.String())}
+	}
+	if reorderRow != nil {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(reorderRow, deleteMsgRow(language))
+	} else {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(deleteMsgRow(language))
+	}
+
+	_, err := tg_bot.Bot.Send(msg)
+	return err
+}
+
+// 订单即将过期,回复付款二维码消息进行提醒
+func NotifyOrderExpireSoon(order models.Order) error {
+	msgText := config.OrderRemindMsg(services.GetUserLanguage(order.TGChatID), map[string]interface{}{
+		"Order": order,
+	})
+	msg := tgbotapi.NewMessage(order.TGChatID, msgText)
+	if order.TGMsgID != 0 {
+		msg.ReplyToMessageID = int(order.TGMsgID)
+	}
+
+	// 无论是否发送成功都标记为已提醒,防止重复发送
+	services.SetOrderReminded(order.ID)
+	_, err := tg_bot.Bot.Send(msg)
+	return err
+}
+
+// 商品补货后通知订阅用户,通知为一次性,发送后删除订阅
+func NotifyRestock(productID uuid.UUID) error {
+	product, err := services.GetProductByIDByCustomer(productID)
+	if err != nil || product.InStockCount == 0 {
+		return err
+	}
+	restockSubscriptions, err := services.GetRestockSubscriptions(productID)
+	if err != nil {
+		return err
+	}
+
+	// 按订阅用户的语言发送,相同语言的通知只生成一次
+	msgTexts := make(map[string]string)
+	var notifiedIDs []uuid.UUID
+	for _, restockSubscription := range restockSubscriptions {
+		language := services.GetUserLanguage(restockSubscription.TGChatID)
+		msgText, ok := msgTexts[language]
+		if !ok {
+			translatedProduct := product
+			services.TranslateProduct(language, &translatedProduct)
+			msgText = config.RestockNotifyMsg(language, map[string]interface{}{
+				"Product": translatedProduct,
+			})
+			msgTexts[language] = msgText
+		}
+		msg := tgbotapi.NewMessage(restockSubscription.TGChatID, msgText)
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			[]tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(config.T(language, "立即购买"), ProductDetailPrefix+product.ID.String())},
+			deleteMsgRow(language),
+		)
+		// 发送失败(如用户已屏蔽机器人)同样删除订阅,避免每次补货重复尝试
+		tg_bot.Bot.Send(msg)
+		notifiedIDs = append(notifiedIDs, restockSubscription.ID)
+	}
+	return services.DeleteRestockSubscriptions(notifiedIDs)
+}
@@ -0,0 +1,177 @@
+package tg_handler
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/cache"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/tg_bot"
+	"gopay/internal/models"
+	"gopay/internal/services"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var SearchPagePrefix = "s_r_"
+
+// /start参数的前缀,后接商品ID,打开商品详情
+var productStartParamPrefix = "p_"
+
+// 内联搜索每次返回的结果数量,Telegram最多50个
+var inlineQueryResultLimit = 20
+var inlineQueryCacheTime = 30
+
+// 机器人内搜索的关键词按用户保存,用于翻页
+var searchKeywordDuration = time.Hour
+var searchKeywordMaxLength = 64
+
+// 打开机器人并显示商品详情的链接
+func productDeepLink(productID uuid.UUID) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%s", tg_bot.Bot.Self.UserName, productStartParamPrefix, productID)
+}
+
+// 商品当前的价格,有规格时显示规格的价格范围,特价期间使用特价,返回是否有特价
+func productPriceText(product models.Product) (string, bool) {
+	if len(product.Variants) == 0 {
+		if sale, _ := services.GetProductSale(product, nil); sale != nil {
+			return sale.Price.String(), true
+		}
+		return product.Price.String(), false
+	}
+
+	var minPrice, maxPrice decimal.Decimal
+	onSale := false
+	for i, variant := range product.Variants {
+		price := variant.Price
+		if sale, _ := services.GetProductSale(product, &variant); sale != nil {
+			price = sale.Price
+			onSale = true
+		}
+		if i == 0 || price.LessThan(minPrice) {
+			minPrice = price
+		}
+		if i == 0 || price.GreaterThan(maxPrice) {
+			maxPrice = price
+		}
+	}
+	if minPrice.Equal(maxPrice) {
+		return minPrice.String(), onSale
+	}
+	return minPrice.String() + "~" + maxPrice.String(), onSale
+}
+
+// 在任意聊天中输入@机器人 关键词搜索商品,选择结果后发送带商品链接的卡片
+func InlineQuery(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	inlineQuery := update.InlineQuery
+	page, err := strconv.Atoi(inlineQuery.Offset)
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pagination := services.Pagination{Limit: inlineQueryResultLimit, Page: page}
+	if err := services.SearchProductsByCustomer(&pagination, inlineQuery.Query); err != nil {
+		return
+	}
+	services.TranslatePaginationProducts(language, &pagination)
+
+	results := make([]interface{}, 0, len(pagination.Items))
+	for _, item := range pagination.Items {
+		product := item.(models.Product)
+		price, onSale := productPriceText(product)
+		msgText := config.ProductShareMsg(language, map[string]interface{}{
+			"Product": product,
+			"Price":   price,
+			"OnSale":  onSale,
+		})
+
+		article := tgbotapi.NewInlineQueryResultArticle(product.ID.String(), product.Name, msgText)
+		article.Description = config.Tf(language, "价格: %s%s 库存: %d", price, product.Currency, product.InStockCount)
+		if product.IsWebhookDelivery() {
+			article.Description = config.Tf(language, "价格: %s%s 自动发货", price, product.Currency)
+		}
+		markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL(config.T(language, "查看商品"), productDeepLink(product.ID))))
+		article.ReplyMarkup = &markup
+		results = append(results, article)
+	}
+
+	inlineConfig := tgbotapi.InlineConfig{
+		InlineQueryID: inlineQuery.ID,
+		Results:       results,
+		CacheTime:     inlineQueryCacheTime,
+	}
+	if int64(pagination.Page) < pagination.TotalPage {
+		inlineConfig.NextOffset = strconv.Itoa(pagination.Page + 1)
+	}
+	tg_bot.Bot.Request(inlineConfig)
+}
+
+func searchKeywordKey(chatID int64) string {
+	return fmt.Sprintf("search_keyword_%d", chatID)
+}
+
+// /search 关键词,按名称和描述搜索商品
+func SearchCommand(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	chatID := update.Message.Chat.ID
+	keyword := strings.TrimSpace(update.Message.CommandArguments())
+	if keyword == "" {
+		tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, config.T(language, "请在命令后输入关键词, 例如: /search netflix")))
+		return
+	}
+	if utf8.RuneCountInString(keyword) > searchKeywordMaxLength {
+		tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, config.Tf(language, "关键词不能超过%d个字符", searchKeywordMaxLength)))
+		return
+	}
+	cache.Cache.Set(searchKeywordKey(chatID), keyword, searchKeywordDuration)
+	sendSearchResult(update, language, keyword, 1)
+}
+
+// 搜索结果翻页
+func SearchPage(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	currentPage, err := strconv.Atoi(strings.TrimPrefix(update.CallbackQuery.Data, SearchPagePrefix))
+	if err != nil {
+		currentPage = 1
+	}
+	keyword, ok := cache.Cache.Get(searchKeywordKey(update.CallbackQuery.Message.Chat.ID)).(string)
+	if !ok {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "搜索已过期, 请重新搜索")))
+		return
+	}
+	sendSearchResult(update, language, keyword, currentPage)
+}
+
+func sendSearchResult(update tgbotapi.Update, language string, keyword string, currentPage int) {
+	var chatID int64
+	if update.Message != nil {
+		chatID = update.Message.Chat.ID
+	} else {
+		chatID = update.CallbackQuery.Message.Chat.ID
+	}
+
+	pagination := services.Pagination{Limit: 10, Page: currentPage}
+	if err := services.SearchProductsByCustomer(&pagination, keyword); err != nil {
+		tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, config.T(language, "搜索失败")))
+		return
+	}
+	services.TranslatePaginationProducts(language, &pagination)
+
+	msgText := config.ProductSearchMsg(language, map[string]interface{}{
+		"Keyword": keyword,
+		"Total":   pagination.Total,
+	})
+	rows := paginationToRows(language, pagination, SearchPagePrefix)
+	rows = append(rows, deleteMsgRow(language))
+	replyMarkup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if update.Message != nil {
+		msg := tgbotapi.NewMessage(chatID, msgText)
+		msg.ReplyMarkup = replyMarkup
+		tg_bot.Bot.Send(msg)
+	} else {
+		editCallbackMsg(update, msgText, replyMarkup, nil)
+	}
+}
@@ -4,8 +4,9 @@ import (
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/cache"
 	"gopay/internal/exts/config"
-	"gopay/internal/exts/db"
 	"gopay/internal/exts/tg_bot"
 	"gopay/internal/models"
 	"gopay/internal/services"
@@ -17,12 +18,38 @@ import (
 
 // 修改消息，文本为空则忽视，markup为空则新发一个消息
 var ProductListPagePrefix = "p_l_p_"
+var CategoryPrefix = "cat_" // 分类ID_页码
 var ProductDetailPrefix = "p_d_"
 var PayOrderPrefix = "p_o_"
+var VariantDetailPrefix = "v_d_"
+var PayVariantOrderPrefix = "v_p_o_" // 有规格的商品付款,参数为规格ID
 var GetPaidOrderResultPrefix = "g_p_o_r_"
+var DepositAmountPrefix = "d_a_"
+var DepositOrderPrefix = "d_o_"
+var CancelOrderPrefix = "c_o_"
+var CheckPaymentPrefix = "c_p_"
+var SwitchPaymentPrefix = "s_p_"
+var RestockSubscribePrefix = "r_s_"
+var InputChoicePrefix = "i_c_"
+var InputActionPrefix = "i_a_"
+
+// 更换支付方式时返回付款按钮
+var switchPaymentBack = "back"
+
+// 主动查询付款的间隔,每个用户单独计算
+var checkPaymentInterval = time.Second * 15
 
 func StartCommand(update tgbotapi.Update) {
-	msgText := config.WelcomeMsg(map[string]interface{}{})
+	language := updateLanguage(update)
+	// 通过分享链接打开时直接显示商品详情
+	if param := update.Message.CommandArguments(); strings.HasPrefix(param, productStartParamPrefix) {
+		if productID, err := uuid.Parse(strings.TrimPrefix(param, productStartParamPrefix)); err == nil {
+			sendProductDetail(update.Message.Chat.ID, language, productID)
+			return
+		}
+	}
+
+	msgText := config.WelcomeMsg(language, map[string]interface{}{})
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, msgText)
 	tg_bot.Bot.Send(msg)
 }
@@ -66,201 +93,741 @@ func ProductList(update tgbotapi.Update) {
 			currentPage = value
 		}
 	}
+	sendProductList(update, nil, currentPage)
+}
 
-	pagination := services.Pagination{Limit: 10, Page: currentPage}
-	err := services.GetProductsByCustomer(&pagination)
+func CategoryProductList(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	parts := strings.Split(strings.TrimPrefix(update.CallbackQuery.Data, CategoryPrefix), "_")
+	if len(parts) != 2 {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "参数错误")))
+		return
+	}
+	categoryID, err := uuid.Parse(parts[0])
 	if err != nil {
-		tg_bot.Bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "获取失败"))
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "id错误")))
+		return
+	}
+	currentPage, err := strconv.Atoi(parts[1])
+	if err != nil {
+		currentPage = 1
 	}
+	category, err := services.GetCategoryByCustomer(categoryID)
+	if err != nil {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err)))
+		return
+	}
+	sendProductList(update, &category, currentPage)
+}
 
-	var products []models.Product
-	for _, item := range pagination.Items {
-		products = append(products, item.(models.Product))
+// 商品列表,先显示下级分类,再分页显示分类中的商品,category为空时为首页
+func sendProductList(update tgbotapi.Update, category *models.Category, currentPage int) {
+	language := updateLanguage(update)
+	var categoryID *uuid.UUID
+	if category != nil {
+		categoryID = &category.ID
+	}
+	var chatID int64
+	if update.Message != nil {
+		chatID = update.Message.Chat.ID
+	} else {
+		chatID = update.CallbackQuery.Message.Chat.ID
 	}
 
-	msgText := config.ProductListMsg(map[string]interface{}{})
-	rows := append(paginationToRows(pagination), deleteMsgRow())
+	categoryEntries, err := services.GetSubCategoriesByCustomer(categoryID)
+	if err != nil {
+		tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, config.T(language, "获取失败")))
+		return
+	}
+	pagination := services.Pagination{Limit: 10, Page: currentPage}
+	if err := services.GetProductsByCustomer(&pagination, categoryID); err != nil {
+		tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, config.T(language, "获取失败")))
+		return
+	}
+	services.TranslatePaginationProducts(language, &pagination)
+
+	msgText := config.ProductListMsg(language, map[string]interface{}{
+		"Category": category,
+	})
+	var rows [][]tgbotapi.InlineKeyboardButton
+	// 分类只在第一页显示
+	if pagination.Page <= 1 {
+		rows = append(rows, categoryRows(categoryEntries)...)
+	}
+	rows = append(rows, paginationToRows(language, pagination, categoryPagePrefix(categoryID))...)
+	if category != nil {
+		rows = append(rows, GoBackRow(language, categoryPagePrefix(category.ParentID)+"1"))
+	}
+	rows = append(rows, deleteMsgRow(language))
 	replyMarkup := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	if update.Message != nil {
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, msgText)
+		msg := tgbotapi.NewMessage(chatID, msgText)
 		msg.ReplyMarkup = replyMarkup
 		tg_bot.Bot.Send(msg)
 	} else {
-		msg := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, msgText)
-		replyMarkup := tgbotapi.NewInlineKeyboardMarkup(rows...)
-		msg.ReplyMarkup = &replyMarkup
-		tg_bot.Bot.Send(msg)
+		editCallbackMsg(update, msgText, replyMarkup, nil)
 	}
 }
 
 func ProductDetail(update tgbotapi.Update) {
+	language := updateLanguage(update)
 	callbackData := update.CallbackQuery.Data
 	productID, err := uuid.Parse(strings.TrimPrefix(callbackData, ProductDetailPrefix))
 	if err != nil {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "id错误")
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "id错误"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
 
 	product, err := services.GetProductByIDByCustomer(productID)
 	if err != nil {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "商品不存在")
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "商品不存在"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
 
-	msgText := config.ProductDetailMsg(map[string]interface{}{
-		"Product": product,
+	msgText, markup, ok := productDetailMsg(language, product)
+	if !ok {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "没有设置支付方式"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	if len(product.Media) > 0 {
+		showProductMedia(update, product, msgText, markup)
+		return
+	}
+	editCallbackMsg(update, msgText, markup, nil)
+}
+
+// 通过链接打开的商品详情,发送新消息
+func sendProductDetail(chatID int64, language string, productID uuid.UUID) {
+	product, err := services.GetProductByIDByCustomer(productID)
+	if err != nil {
+		tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, config.T(language, "商品不存在或已下架")))
+		return
+	}
+	msgText, markup, ok := productDetailMsg(language, product)
+	if !ok {
+		tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, config.T(language, "没有设置支付方式")))
+		return
+	}
+	if len(product.Media) > 0 {
+		sendProductMediaOrText(chatID, product, msgText, markup)
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, msgText)
+	msg.ReplyMarkup = markup
+	tg_bot.Bot.Send(msg)
+}
+
+// 商品详情的文字和按钮,没有支付方式时返回false
+func productDetailMsg(language string, product models.Product) (string, tgbotapi.InlineKeyboardMarkup, bool) {
+	services.TranslateProduct(language, &product)
+	var sale *services.ProductSale
+	if len(product.Variants) == 0 {
+		sale, _ = services.GetProductSale(product, nil)
+	}
+	msgText := config.ProductDetailMsg(language, map[string]interface{}{
+		"Product":  product,
+		"Sale":     sale,
+		"Language": language,
 	})
-	newMsg := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, msgText)
 
 	//backRow := []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData("返回", ProductListPagePrefix+"1")}
-	goBackRow := GoBackRow(ProductListPagePrefix + "1")
-	paymentRow := paymentSelectRow(product.ID)
-	if len(paymentRow) == 0 {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "没有设置支付方式")
+	goBackRow := GoBackRow(language, categoryPagePrefix(product.CategoryID)+"1")
+	closeRow := deleteMsgRow(language)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(product.Variants) > 0 {
+		// 有规格的商品先选择规格
+		rows = append(rows, variantSelectRows(language, product)...)
+		if product.InStockCount == 0 && !product.IsWebhookDelivery() {
+			rows = append(rows, restockSubscribeRow(language, product.ID))
+		}
+	} else {
+		purchaseRows, ok := productPurchaseRows(language, product, PayOrderPrefix, product.ID, product.InStockCount)
+		if !ok {
+			return "", tgbotapi.InlineKeyboardMarkup{}, false
+		}
+		rows = append(rows, purchaseRows...)
+	}
+	rows = append(rows, shareProductRow(language, product), goBackRow, closeRow)
+	return msgText, tgbotapi.NewInlineKeyboardMarkup(rows...), true
+}
+
+// 规格详情,价格和库存使用规格的
+func VariantDetail(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	callbackData := update.CallbackQuery.Data
+	variantID, err := uuid.Parse(strings.TrimPrefix(callbackData, VariantDetailPrefix))
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "id错误"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
-	closeRow := deleteMsgRow()
-	markupPtr := tgbotapi.NewInlineKeyboardMarkup(paymentRow, goBackRow, closeRow)
-	newMsg.ReplyMarkup = &markupPtr
-	tg_bot.Bot.Send(newMsg)
+	variant, err := services.GetProductVariantByIDByCustomer(variantID)
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	product := variant.Product
+	services.TranslateProduct(language, &product)
+	sale, _ := services.GetProductSale(product, &variant)
+	product.Price = variant.Price
+	product.InStockCount = variant.InStockCount
+
+	msgText := config.ProductDetailMsg(language, map[string]interface{}{
+		"Product":  product,
+		"Variant":  variant,
+		"Sale":     sale,
+		"Language": language,
+	})
 
+	purchaseRows, ok := productPurchaseRows(language, product, PayVariantOrderPrefix, variant.ID, variant.InStockCount)
+	if !ok {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "没有设置支付方式"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	rows := append(purchaseRows, GoBackRow(language, ProductDetailPrefix+product.ID.String()), deleteMsgRow(language))
+	// 保留商品的图片或视频
+	editCallbackMsg(update, msgText, tgbotapi.NewInlineKeyboardMarkup(rows...), &product.ID)
 }
 
 func CallbackDeleteMsg(update tgbotapi.Update) {
 	chatID := update.CallbackQuery.Message.Chat.ID
 	messageID := update.CallbackQuery.Message.MessageID
+	clearProductMediaMsg(chatID, messageID)
 	tg_bot.DeleteMsg(chatID, messageID)
 }
 
+// 商品付款,PayVariantOrderPrefix开头的参数为规格ID
 func PayOrder(update tgbotapi.Update) {
-	senderChatID := update.CallbackQuery.Message.Chat.ID
-	senderMsgID := update.CallbackQuery.Message.MessageID
-	senderUsername := update.CallbackQuery.From.UserName
-
+	language := updateLanguage(update)
 	callbackData := update.CallbackQuery.Data
+	isVariant := strings.HasPrefix(callbackData, PayVariantOrderPrefix)
 	value := strings.TrimPrefix(callbackData, PayOrderPrefix)
+	if isVariant {
+		value = strings.TrimPrefix(callbackData, PayVariantOrderPrefix)
+	}
 	parts := strings.Split(value, "_")
 	if len(parts) != 2 {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "参数长度错误")
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "参数长度错误"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
 
-	productIDString := parts[0]
+	idString := parts[0]
 	paymentOptionString := parts[1]
 
-	if !config.IsPaymentEnable(paymentOptionString) {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "支付方式不存在")
+	if paymentOptionString != config.BalancePaymentMethod && !config.IsPaymentEnable(paymentOptionString) {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "支付方式不存在"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
-	var paymentOption *config.PaymentOption
-	paymentOption, err := config.ParsePaymentMethod(paymentOptionString)
+	id, err := uuid.Parse(idString)
 	if err != nil {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "支付方式错误")
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "商品ID错误"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
-	productID, err := uuid.Parse(productIDString)
+
+	productID := id
+	var variant *models.ProductVariant
+	if isVariant {
+		productVariant, err := services.GetProductVariantByIDByCustomer(id)
+		if err != nil {
+			callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
+			tg_bot.Bot.Request(callback)
+			return
+		}
+		productID = productVariant.ProductID
+		variant = &productVariant
+	}
+	product, err := services.GetProductByIDByCustomer(productID)
 	if err != nil {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "商品ID错误")
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "商品不存在"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
-	product, err := services.GetProductByIDByCustomer(productID)
-	if err != nil {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "商品不存在")
+	if variant == nil && len(product.Variants) > 0 {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "请选择商品规格"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
 
-	// 一個用戶只能有一個訂單，由於放在前面釋放，先釋放后创建
-	var toReleaseOrderIDs []uuid.UUID
-	if result := db.DB.Model(&models.Order{}).Where("status = 0 and tg_chat_id = ?", senderChatID).Pluck("id", &toReleaseOrderIDs); result.RowsAffected > 0 {
-		services.ReleaseOrders(toReleaseOrderIDs)
+	// 商品需要填写输入字段时先逐项填写,确认后再创建订单
+	if len(product.InputFields) > 0 {
+		startInputSession(update, product, variant, paymentOptionString)
+		return
+	}
+	createOrderAndPay(update, product, variantIDOf(variant), paymentOptionString, nil)
+}
+
+func variantIDOf(variant *models.ProductVariant) *uuid.UUID {
+	if variant == nil {
+		return nil
 	}
+	return &variant.ID
+}
+
+// 创建订单并发送付款消息,余额支付直接发货
+func createOrderAndPay(update tgbotapi.Update, product models.Product, variantID *uuid.UUID, paymentOptionString string, inputData models.JSONField) {
+	language := updateLanguage(update)
+	senderChatID := update.CallbackQuery.Message.Chat.ID
+	senderUsername := update.CallbackQuery.From.UserName
 
-	// 创建订单
-	order, err := services.CreateOrder(paymentOption.Currency, string(paymentOption.Network), product, senderChatID, senderUsername)
+	if paymentOptionString == config.BalancePaymentMethod {
+		payOrderByBalance(update, product, variantID, inputData)
+		return
+	}
+
+	paymentOption, err := config.ParsePaymentMethod(paymentOptionString)
 	if err != nil {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, err.Error())
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "支付方式错误"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
 
+	// 创建订单,待支付订单达到上限会返回错误,由用户在 /orders 中自行取消
+	order, err := services.CreateOrder(paymentOption.Currency, string(paymentOption.Network), product, variantID, senderChatID, senderUsername, inputData)
+	if err != nil {
+		createOrderErrCallback(update, err)
+		return
+	}
+
+	sendPayOrderMsg(update, order)
+}
+
+// 下单失败的提示,超出限购时以弹窗显示
+func createOrderErrCallback(update tgbotapi.Update, err error) {
+	text := errorText(updateLanguage(update), err)
+	callback := tgbotapi.NewCallback(update.CallbackQuery.ID, text)
+	if services.IsPurchaseLimitError(err) {
+		callback = tgbotapi.NewCallbackWithAlert(update.CallbackQuery.ID, text)
+	}
+	tg_bot.Bot.Request(callback)
+}
+
+// 发送付款二维码,删除原消息,并记录msgID用于删除
+func sendPayOrderMsg(update tgbotapi.Update, order *models.Order) {
+	language := updateLanguage(update)
+	senderChatID := update.CallbackQuery.Message.Chat.ID
+	senderMsgID := update.CallbackQuery.Message.MessageID
+
 	// 生成图片
 	qrImageBytes, err := functions.GenerateQrCodeBytes(order.WalletAddress)
 	if err != nil {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, err.Error())
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
 		tg_bot.Bot.Request(callback)
 		return
 	}
 
 	photoFileBytes := tgbotapi.FileBytes{Name: "qr.png", Bytes: qrImageBytes}
 	photoMsg := tgbotapi.NewPhoto(senderChatID, photoFileBytes)
-	photoMsg.Caption = config.PayOrderMsg(map[string]interface{}{
+	photoMsg.Caption = config.PayOrderMsg(language, map[string]interface{}{
 		"Order": order,
 	})
 	photoMsg.ParseMode = "HTML"
+	photoMsg.ReplyMarkup = payOrderMarkup(language, order.ID)
 
 	result, _ := tg_bot.Bot.Send(photoMsg)
 
 	// 删除原消息
+	clearProductMediaMsg(senderChatID, senderMsgID)
 	tg_bot.DeleteMsg(senderChatID, senderMsgID)
 
 	// 给订单设置msgID用于删除
 	services.SetOrderTGMsgID(order.ID, int64(result.MessageID))
+}
 
+func payOrderByBalance(update tgbotapi.Update, product models.Product, variantID *uuid.UUID, inputData models.JSONField) {
+	senderChatID := update.CallbackQuery.Message.Chat.ID
+	senderMsgID := update.CallbackQuery.Message.MessageID
+	senderUsername := update.CallbackQuery.From.UserName
+
+	order, err := services.CreateBalanceOrder(product, variantID, senderChatID, senderUsername, inputData)
+	if err != nil {
+		createOrderErrCallback(update, err)
+		return
+	}
+
+	// 发货后删除支付选择消息
+	clearProductMediaMsg(senderChatID, senderMsgID)
+	services.SetOrderTGMsgID(order.ID, int64(senderMsgID))
+	services.OrderCallbackMultiple([]uuid.UUID{order.ID})
+}
+
+func BalanceCommand(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	chatID := update.Message.Chat.ID
+
+	user, err := services.GetUserByTGChatID(chatID)
+	if err != nil {
+		tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, errorText(language, err)))
+		return
+	}
+
+	msgText := config.BalanceMsg(language, map[string]interface{}{
+		"User":            user,
+		"BalanceCurrency": config.BalanceCurrency,
+	})
+	rows := append(depositAmountRows(), deleteMsgRow(language))
+	msg := tgbotapi.NewMessage(chatID, msgText)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	tg_bot.Bot.Send(msg)
+}
+
+func DepositAmount(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	callbackData := update.CallbackQuery.Data
+	amount, err := decimal.NewFromString(strings.TrimPrefix(callbackData, DepositAmountPrefix))
+	if err != nil || !amount.GreaterThan(decimal.Zero) {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "金额错误"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	paymentRow := depositPaymentSelectRow(amount)
+	if len(paymentRow) == 0 {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "没有设置支付方式"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	msgText := config.Tf(language, "充值金额: %s %s\n请选择付款方式以创建充值订单", amount, config.BalanceCurrency)
+	newMsg := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, msgText)
+	markupPtr := tgbotapi.NewInlineKeyboardMarkup(paymentRow, deleteMsgRow(language))
+	newMsg.ReplyMarkup = &markupPtr
+	tg_bot.Bot.Send(newMsg)
 }
+
+func DepositOrder(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	senderChatID := update.CallbackQuery.Message.Chat.ID
+	senderUsername := update.CallbackQuery.From.UserName
+
+	value := strings.TrimPrefix(update.CallbackQuery.Data, DepositOrderPrefix)
+	parts := strings.Split(value, "_")
+	if len(parts) != 2 {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "参数长度错误"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	amount, err := decimal.NewFromString(parts[0])
+	if err != nil || !amount.GreaterThan(decimal.Zero) {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "金额错误"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	paymentOptionString := parts[1]
+	if !config.IsPaymentEnable(paymentOptionString) {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "支付方式不存在"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	paymentOption, err := config.ParsePaymentMethod(paymentOptionString)
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "支付方式错误"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	order, err := services.CreateDepositOrder(paymentOption.Currency, string(paymentOption.Network), amount, senderChatID, senderUsername)
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	sendPayOrderMsg(update, order)
+}
+
+// 用户点击我已付款,立即查询该订单钱包的入账,并更新付款消息
+func CheckPayment(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	callbackData := update.CallbackQuery.Data
+	senderChatID := update.CallbackQuery.Message.Chat.ID
+	senderMsgID := update.CallbackQuery.Message.MessageID
+
+	orderID, err := uuid.Parse(strings.TrimPrefix(callbackData, CheckPaymentPrefix))
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "id错误"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	order, err := services.GetOrderToCheckPayment(orderID, senderChatID)
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	// 只有需要查询链上交易的待支付订单才占用查询间隔
+	var successOrderIDs []uuid.UUID
+	if order.Status == 0 {
+		if !cache.Cache.Add(fmt.Sprintf("check_payment_%d", senderChatID), true, checkPaymentInterval) {
+			callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.Tf(language, "查询过于频繁,请%d秒后再试", int(checkPaymentInterval.Seconds())))
+			tg_bot.Bot.Request(callback)
+			return
+		}
+		checkedOrder, checkedOrderIDs, err := services.CheckOrderPayment(order)
+		if err != nil {
+			callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
+			tg_bot.Bot.Request(callback)
+			return
+		}
+		order, successOrderIDs = *checkedOrder, checkedOrderIDs
+	}
+
+	callbackText := "暂未检测到付款"
+	if order.Status == 1 {
+		callbackText = "已收到付款"
+	} else if order.Status != 0 {
+		callbackText = "订单已失效"
+	} else if order.PaidPrice.GreaterThan(decimal.Zero) {
+		callbackText = "已收到部分付款"
+	}
+	tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, callbackText)))
+
+	// 先更新付款消息,发货时会删除该消息
+	editMsg := tgbotapi.NewEditMessageCaption(senderChatID, senderMsgID, config.PayOrderMsg(language, map[string]interface{}{
+		"Order":     &order,
+		"Checked":   true,
+		"CheckTime": time.Now().Unix(),
+	}))
+	editMsg.ParseMode = "HTML"
+	if order.Status == 0 {
+		replyMarkup := payOrderMarkup(language, order.ID)
+		editMsg.ReplyMarkup = &replyMarkup
+	}
+	tg_bot.Bot.Send(editMsg)
+
+	services.OrderCallbackMultiple(successOrderIDs)
+}
+
+// 更换支付方式,不带支付方式时显示选项,带支付方式时更换并重新发送付款消息
+func SwitchPayment(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	callbackData := update.CallbackQuery.Data
+	senderChatID := update.CallbackQuery.Message.Chat.ID
+	senderMsgID := update.CallbackQuery.Message.MessageID
+
+	parts := strings.SplitN(strings.TrimPrefix(callbackData, SwitchPaymentPrefix), "_", 2)
+	orderID, err := uuid.Parse(parts[0])
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "id错误"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	// 显示选项
+	if len(parts) == 1 {
+		order, err := services.GetPendingOrderByCustomerByID(orderID, senderChatID)
+		if err != nil {
+			callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
+			tg_bot.Bot.Request(callback)
+			return
+		}
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "如已向当前地址付款，请勿更换")))
+		tg_bot.Bot.Send(tgbotapi.NewEditMessageReplyMarkup(senderChatID, senderMsgID, switchPaymentMarkup(language, order)))
+		return
+	}
+
+	// 返回
+	if parts[1] == switchPaymentBack {
+		tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+		tg_bot.Bot.Send(tgbotapi.NewEditMessageReplyMarkup(senderChatID, senderMsgID, payOrderMarkup(language, orderID)))
+		return
+	}
+
+	if !config.IsPaymentEnable(parts[1]) {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "支付方式不存在"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	paymentOption, err := config.ParsePaymentMethod(parts[1])
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "支付方式错误"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	order, err := services.SwitchOrderPayment(orderID, senderChatID, paymentOption.Currency, string(paymentOption.Network))
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	sendPayOrderMsg(update, order)
+}
+
 func PaidOrder(update tgbotapi.Update) {
+	language := updateLanguage(update)
 	chatID := update.Message.Chat.ID
 
 	paidOrders, err := services.GetPaidOrdersByCustomer(chatID)
 	if err != nil {
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "获取订单错误")
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, config.T(language, "获取订单错误"))
 		tg_bot.Bot.Send(msg)
 		return
 	}
 	if len(paidOrders) == 0 {
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "没有已付订单")
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, config.T(language, "没有已付订单"))
 		tg_bot.Bot.Send(msg)
 		return
 	}
+	services.TranslateOrderProducts(language, paidOrders)
 
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, paidOrder := range paidOrders {
-		buttonText := fmt.Sprintf("%s %s %s%s ", time.Unix(paidOrder.CreateTime, 0).Format("2006-01-02"), paidOrder.Product.Name, paidOrder.Price, paidOrder.Currency)
+		buttonText := fmt.Sprintf("%s %s%s %s%s ", time.Unix(paidOrder.CreateTime, 0).Format("2006-01-02"), paidOrder.Product.Name, variantNameSuffix(paidOrder.VariantName), paidOrder.Price, paidOrder.Currency)
+		if paidOrder.ProductItem.IsFile() {
+			buttonText += config.T(language, "[文件]")
+		}
 		row := []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(buttonText, GetPaidOrderResultPrefix+paidOrder.ID.String())}
 		rows = append(rows, row)
 	}
-	msgText := config.PaidOrderListMsg(map[string]interface{}{})
-	rows = append(rows, deleteMsgRow())
+	msgText := config.PaidOrderListMsg(language, map[string]interface{}{})
+	rows = append(rows, deleteMsgRow(language))
 	replyMarkup := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, msgText)
 	msg.ReplyMarkup = replyMarkup
 	tg_bot.Bot.Send(msg)
 }
 
+// 待支付订单列表,每个订单带取消按钮
+func pendingOrderListMsg(chatID int64, language string) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	pendingOrders, err := services.GetPendingOrdersByCustomer(chatID)
+	if err != nil {
+		return "", nil, err
+	}
+	services.TranslateOrderProducts(language, pendingOrders)
+
+	msgText := config.PendingOrderListMsg(language, map[string]interface{}{
+		"Orders":           pendingOrders,
+		"MaxPendingOrders": config.GetMaxPendingOrders(),
+	})
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, pendingOrder := range pendingOrders {
+		name := pendingOrder.Product.Name
+		if pendingOrder.Cate == 1 {
+			name = config.T(language, "余额充值")
+		}
+		buttonText := config.Tf(language, "取消 %s %s%s", name, pendingOrder.Price, pendingOrder.Currency)
+		row := []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(buttonText, CancelOrderPrefix+pendingOrder.ID.String())}
+		rows = append(rows, row)
+	}
+	rows = append(rows, deleteMsgRow(language))
+	replyMarkup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return msgText, &replyMarkup, nil
+}
+
+func PendingOrders(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	chatID := update.Message.Chat.ID
+
+	msgText, replyMarkup, err := pendingOrderListMsg(chatID, language)
+	if err != nil {
+		tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, errorText(language, err)))
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, msgText)
+	msg.ReplyMarkup = replyMarkup
+	tg_bot.Bot.Send(msg)
+}
+
+func CancelOrder(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	callbackData := update.CallbackQuery.Data
+	senderChatID := update.CallbackQuery.Message.Chat.ID
+	senderMsgID := update.CallbackQuery.Message.MessageID
+
+	orderID, err := uuid.Parse(strings.TrimPrefix(callbackData, CancelOrderPrefix))
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "id错误"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	if err := services.CancelOrderByCustomer(orderID, senderChatID); err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "订单已取消")))
+
+	// 刷新列表,如果是在付款消息上取消的,付款消息已在关闭订单时删除,修改失败忽略即可
+	msgText, replyMarkup, err := pendingOrderListMsg(senderChatID, language)
+	if err != nil {
+		return
+	}
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(senderChatID, senderMsgID, msgText, *replyMarkup)
+	tg_bot.Bot.Send(editMsg)
+}
+
 func GetPaidOrderResult(update tgbotapi.Update) {
+	language := updateLanguage(update)
 	callbackData := update.CallbackQuery.Data
 	senderChatID := update.CallbackQuery.Message.Chat.ID
 	senderMsgID := update.CallbackQuery.Message.MessageID
 
 	orderID, err := uuid.Parse(strings.TrimPrefix(callbackData, GetPaidOrderResultPrefix))
 	if err != nil {
-		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "id错误")
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "id错误"))
 		tg_bot.Bot.Request(callback)
 		return
 	}
-	order, err := services.GetPaidOrderByCustomerByID(orderID)
+	order, err := services.GetPaidOrderByCustomerByID(orderID, senderChatID)
 	if err != nil {
-		msg := tgbotapi.NewMessage(senderChatID, err.Error())
+		msg := tgbotapi.NewMessage(senderChatID, errorText(language, err))
 		tg_bot.Bot.Send(msg)
 		return
 	}
 
+	if order.AwaitStock {
+		services.SendPreOrderCallBack(senderChatID, senderMsgID, order, order.Product)
+		return
+	}
 	services.SendOrderCallBack(senderChatID, senderMsgID, order, order.Product, order.ProductItem)
 }
+
+func RestockSubscribe(update tgbotapi.Update) {
+	language := updateLanguage(update)
+	callbackData := update.CallbackQuery.Data
+	senderChatID := update.CallbackQuery.Message.Chat.ID
+	senderUsername := update.CallbackQuery.From.UserName
+
+	productID, err := uuid.Parse(strings.TrimPrefix(callbackData, RestockSubscribePrefix))
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "id错误"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	product, err := services.GetProductByIDByCustomer(productID)
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "商品不存在"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	if product.InStockCount > 0 || product.IsWebhookDelivery() {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, "商品有库存,可直接购买"))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+
+	added, err := services.AddRestockSubscription(productID, senderChatID, senderUsername)
+	if err != nil {
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, errorText(language, err))
+		tg_bot.Bot.Request(callback)
+		return
+	}
+	callbackText := "已订阅到货通知"
+	if !added {
+		callbackText = "已订阅过到货通知,请勿重复订阅"
+	}
+	tg_bot.Bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, config.T(language, callbackText)))
+}
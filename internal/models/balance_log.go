@@ -0,0 +1,47 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// 余额流水,只增不改
+type BalanceLog struct {
+	ID         uuid.UUID       `gorm:"type:uuid;primary_key;not null" json:"id"`
+	Cate       int             `gorm:"index;not null" json:"cate"` // 1.超额支付 2.退款 3.充值 4.余额购买 5.管理员调整
+	CreateTime int64           `gorm:"index;autoCreateTime;not null" json:"create_time"`
+	Amount     decimal.Decimal `gorm:"not null" json:"amount"`  // 正数为入账,负数为扣除
+	Balance    decimal.Decimal `gorm:"not null" json:"balance"` // 变动后的余额
+	Remark     string          `json:"remark"`
+
+	UserID   uuid.UUID `gorm:"index;not null" json:"user_id"`
+	User     User      `gorm:"foreignKey:UserID"`
+	TGChatID int64     `gorm:"index;not null" json:"tg_chat_id"`
+
+	OrderID *uuid.UUID `gorm:"index" json:"order_id"`
+	Order   *Order     `gorm:"foreignKey:OrderID"`
+}
+
+func (*BalanceLog) TableName() string {
+	return "balance_log"
+}
+func (t *BalanceLog) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*BalanceLog) DefaultOrder() string {
+	return "create_time DESC"
+}
+func NewBalanceLog(cate int, amount decimal.Decimal, balance decimal.Decimal, remark string, userID uuid.UUID, tgChatID int64, orderID *uuid.UUID) *BalanceLog {
+	balanceLog := &BalanceLog{
+		Cate:     cate,
+		Amount:   amount,
+		Balance:  balance,
+		Remark:   remark,
+		UserID:   userID,
+		TGChatID: tgChatID,
+		OrderID:  orderID,
+	}
+	return balanceLog
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 商品分类,可多级嵌套,隐藏的分类连同子分类不在机器人中显示
+type Category struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
+	Name       string    `gorm:"not null" json:"name"`
+	Icon       string    `json:"icon"`                             // 显示在名称前,如emoji
+	Status     int       `gorm:"default:1;not null" json:"status"` // 1.显示 0.隐藏
+	Priority   int64     `gorm:"default:0;not null" json:"priority"`
+	CreateTime int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
+
+	ParentID *uuid.UUID `gorm:"index" json:"parent_id"` // 为空则为顶级分类
+}
+
+func (*Category) TableName() string {
+	return "category"
+}
+func (t *Category) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*Category) DefaultOrder() string {
+	return "priority DESC, create_time ASC"
+}
+func NewCategory(name string, icon string, priority int64, parentID *uuid.UUID) *Category {
+	category := &Category{
+		Name:     name,
+		Icon:     icon,
+		Priority: priority,
+		ParentID: parentID,
+	}
+	return category
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 已支付订单的发货消息,与订单完成在同一个事务中写入,由定时任务重试发送
+type DeliveryOutbox struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
+	Status      int       `gorm:"index;default:0;not null" json:"status"` // 0.待发送 1.已发送 2.多次失败放弃
+	CreateTime  int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
+	Attempts    int       `gorm:"default:0;not null" json:"attempts"`            // 已尝试次数
+	NextTryTime int64     `gorm:"index;default:0;not null" json:"next_try_time"` // 下次尝试时间,同时用于抢占,防止重复发送
+	SentTime    int64     `json:"sent_time"`
+	LastError   string    `json:"last_error"`
+
+	OrderID uuid.UUID `gorm:"uniqueIndex;not null" json:"order_id"` // 一个订单只发一次货
+	Order   Order     `gorm:"foreignKey:OrderID"`
+}
+
+func (*DeliveryOutbox) TableName() string {
+	return "delivery_outbox"
+}
+func (t *DeliveryOutbox) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*DeliveryOutbox) DefaultOrder() string {
+	return "create_time DESC"
+}
+func NewDeliveryOutbox(orderID uuid.UUID, nextTryTime int64) *DeliveryOutbox {
+	deliveryOutbox := &DeliveryOutbox{
+		OrderID:     orderID,
+		NextTryTime: nextTryTime,
+	}
+	return deliveryOutbox
+}
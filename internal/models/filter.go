@@ -26,6 +26,10 @@ var fieldOperations = map[string]Operation{
 	"network":         applyAndEquals,
 	"currency":        applyAndEquals,
 	"cate":            applyAndEquals,
+	"actor":           applyAndEquals,
+	"variant_id":      applyAndEquals, // 与商品ID同时使用时筛选该商品的某个规格
+	"category_id":     applyAndEquals,
+	"parent_id":       applyAndEquals,
 	"timestamp_range": applyBetween,
 
 	"id":             applyOrEquals,
@@ -38,6 +42,8 @@ var fieldOperations = map[string]Operation{
 	"product_id":     applyOrEquals,
 	"wallet_address": applyOrEquals,
 	"tg_username":    applyOrEquals,
+	"tg_chat_id":     applyOrEquals,
+	"user_id":        applyOrEquals,
 	//"keyword":         ApplyKeywordSearch,
 
 }
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	InputFieldTypeText   = "text"
+	InputFieldTypeNumber = "number"
+	InputFieldTypeChoice = "choice"
+)
+
+// 商品购买前需要用户填写的字段,如邮箱、游戏区服、账号ID
+type InputField struct {
+	Key      string           `json:"key"`   // 字段标识,发货模板中通过 .Order.InputData.key 获取
+	Label    string           `json:"label"` // 提示用户时显示的名称
+	Type     string           `json:"type"`  // text.文本 number.数字 choice.选项
+	Required bool             `json:"required"`
+	Options  []string         `json:"options"` // choice的可选项
+	Pattern  string           `json:"pattern"` // text的正则校验,为空不校验
+	Min      *decimal.Decimal `json:"min"`     // number的取值范围,为空不限制
+	Max      *decimal.Decimal `json:"max"`
+}
+
+// 输入字段与用户填写的值,用于模板展示
+type InputEntry struct {
+	Key   string
+	Label string
+	Value string
+}
+
+type InputFieldList []InputField
+
+func (l *InputFieldList) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+
+	var byteValue []byte
+	switch v := value.(type) {
+	case []byte:
+		byteValue = v
+	case string:
+		byteValue = []byte(v)
+	default:
+		return errors.New("unsupported type for InputFieldList")
+	}
+
+	return json.Unmarshal(byteValue, l)
+}
+func (l InputFieldList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
+// 按字段顺序列出填写的值,未填写的字段跳过
+func (l InputFieldList) Entries(data JSONField) []InputEntry {
+	var entries []InputEntry
+	for _, field := range l {
+		value, ok := data[field.Key]
+		if !ok || value == nil {
+			continue
+		}
+		entries = append(entries, InputEntry{Key: field.Key, Label: field.Label, Value: fmt.Sprint(value)})
+	}
+	return entries
+}
@@ -9,7 +9,8 @@ import (
 // 使用指针可以方便的置空，使用原则：必须要判断是否为空的情况
 type Order struct {
 	ID         uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
-	Status     int       `gorm:"default:0;not null" json:"status"` // 0，待支付 1,已支付 -1,超时 -2.强行关闭
+	Status     int       `gorm:"default:0;not null" json:"status"` // 0，待支付 1,已支付 -1,超时 -2.强行关闭 2.已退款 3.部分退款
+	Cate       int       `gorm:"default:0;not null" json:"cate"`   // 0.商品订单 1.余额充值订单
 	CreateTime int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
 	EndTime    int64     `gorm:"index" json:"end_time"` // 结束时间,订单完成,则标记为支付时间
 	//MerchantOrderID string    `gorm:"unique;index" json:"merchant_order_id"` // 用来防止用户重复创建订单，系统订单时为空
@@ -19,26 +20,41 @@ type Order struct {
 
 	Price     decimal.Decimal `gorm:"not null" json:"price"`
 	PaidPrice decimal.Decimal `gorm:"default:0;not null" json:"paid_price"`
+	// 已退款金额,与Price同一货币
+	RefundedPrice decimal.Decimal `gorm:"default:0;not null" json:"refunded_price"`
+	// 已存入用户余额的金额,与Price同一货币,充值订单为已付金额,商品订单为超额支付的部分
+	CreditedPrice decimal.Decimal `gorm:"default:0;not null" json:"credited_price"`
 	//PriceID        *decimal.Decimal `json:"price_id"`
 	PriceIDForLock *string `gorm:"unique" json:"price_id_for_lock"` // 字符串，钱包-网络-货币-价格，从数据库层级防止重复价格
 
 	BaseCurrency      string          `json:"base_currency"`
 	BaseCurrencyPrice decimal.Decimal `json:"base_currency_price"`
 
-	WalletID      uuid.UUID `gorm:"" json:"wallet_id"`
-	Wallet        Wallet    `gorm:"foreignKey:WalletID"`
-	WalletAddress string    `gorm:"" json:"wallet_address"`
-	WalletType    int       `gorm:"" json:"wallet_type"`
+	// 余额支付的订单没有钱包,充值订单没有商品,所以都为指针
+	WalletID      *uuid.UUID `gorm:"" json:"wallet_id"`
+	Wallet        Wallet     `gorm:"foreignKey:WalletID"`
+	WalletAddress string     `gorm:"" json:"wallet_address"`
+	WalletType    int        `gorm:"" json:"wallet_type"`
 
-	ProductID uuid.UUID `gorm:"" json:"product_id"`
-	Product   Product   `gorm:"foreignKey:ProductID"`
+	ProductID *uuid.UUID `gorm:"" json:"product_id"`
+	Product   Product    `gorm:"foreignKey:ProductID"`
+
+	VariantID   *uuid.UUID `gorm:"index" json:"variant_id"`
+	VariantName string     `json:"variant_name"` // 下单时的规格名称,规格修改或删除后仍可显示
 
 	TGUsername string `gorm:"index;" json:"tg_username"`
 	TGChatID   int64  `gorm:"index;not null" json:"tg_chat_id"`
 	TGMsgID    int64  `gorm:"index;not null" json:"tg_msg_id"`
+	RemindTime int64  `gorm:"default:0;not null" json:"remind_time"`           // 过期提醒发送时间,0为未提醒
+	AwaitStock bool   `gorm:"index;default:false;not null" json:"await_stock"` // 已付款但没有商品项目,补货后按付款顺序发货
+	OnSale     bool   `gorm:"default:false;not null" json:"on_sale"`           // 以限时特价下单,计入特价可售数量
+
+	InputData *JSONField `gorm:"type:json" json:"input_data"` // 用户下单前填写的商品输入字段,key为InputField.Key
+	// 发货接口返回或管理员手动填写的发货内容,获取后重试发货只重发消息,不再调用接口
+	DeliveryContent string `json:"delivery_content"`
 
 	//NotifyType string `json:"notify_type"`
-	NotifyStatus uint `gorm:"default:0" json:"notify_status"`
+	NotifyStatus uint `gorm:"default:0" json:"notify_status"` // 发货消息 0.待发送 1.已发送 2.发送失败
 	//notify_info = db.Column(JSONB, default={})
 
 	//UserID uuid.UUID `json:"user_id"`
@@ -59,8 +75,9 @@ func (t *Order) BeforeCreate(tx *gorm.DB) (err error) {
 	//t.EndTime = time.Now().Unix() + int64(config.SiteConfig.OrderExpireDuration.Seconds())
 	return
 }
-func NewOrder(endTime int64, currency string, network string, price decimal.Decimal, priceIDForLock *string, baseCurrency string, baseCurrencyPrice decimal.Decimal, walletID uuid.UUID, walletAddress string, walletType int, productID uuid.UUID, tgChatID int64, tgUsername string) *Order {
+func NewOrder(cate int, endTime int64, currency string, network string, price decimal.Decimal, priceIDForLock *string, baseCurrency string, baseCurrencyPrice decimal.Decimal, walletID *uuid.UUID, walletAddress string, walletType int, productID *uuid.UUID, tgChatID int64, tgUsername string) *Order {
 	order := &Order{
+		Cate:              cate,
 		EndTime:           endTime,
 		Currency:          currency,
 		Network:           network,
@@ -77,3 +94,12 @@ func NewOrder(endTime int64, currency string, network string, price decimal.Deci
 	}
 	return order
 }
+
+// 订单填写的输入字段,按商品字段顺序排列
+func (t *Order) InputEntries(fields InputFieldList) []InputEntry {
+	var data JSONField
+	if t.InputData != nil {
+		data = *t.InputData
+	}
+	return fields.Entries(data)
+}
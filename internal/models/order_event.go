@@ -0,0 +1,50 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	OrderEventActorScheduler = "scheduler"
+	OrderEventActorAdmin     = "admin"
+	OrderEventActorBuyer     = "buyer"
+)
+
+// 订单状态变更记录,只增不改
+type OrderEvent struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
+	CreateTime int64     `gorm:"index;autoCreateTime:milli;not null" json:"create_time"` // 毫秒,同一秒内可能有多个事件
+	OldStatus  *int      `json:"old_status"`                                             // 创建订单时为空
+	NewStatus  int       `gorm:"not null" json:"new_status"`
+	Actor      string    `gorm:"index;not null" json:"actor"` // scheduler,admin,buyer
+	Message    string    `json:"message"`
+
+	OrderID uuid.UUID `gorm:"index;not null" json:"order_id"`
+	Order   Order     `gorm:"foreignKey:OrderID"`
+
+	TransferID *uuid.UUID `json:"transfer_id"`
+	Transfer   *Transfer  `gorm:"foreignKey:TransferID"`
+}
+
+func (*OrderEvent) TableName() string {
+	return "order_event"
+}
+func (t *OrderEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*OrderEvent) DefaultOrder() string {
+	return "create_time ASC"
+}
+func NewOrderEvent(orderID uuid.UUID, oldStatus *int, newStatus int, actor string, transferID *uuid.UUID, message string) *OrderEvent {
+	orderEvent := &OrderEvent{
+		OrderID:    orderID,
+		OldStatus:  oldStatus,
+		NewStatus:  newStatus,
+		Actor:      actor,
+		TransferID: transferID,
+		Message:    message,
+	}
+	return orderEvent
+}
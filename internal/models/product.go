@@ -7,19 +7,67 @@ import (
 )
 
 type Product struct {
-	ID           uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
-	Name         string    `gorm:"index;not null" json:"name"`
-	Description  string    `gorm:"not null" json:"description"`
-	Status       int       `gorm:"default:0;not null" json:"status"`
-	CreateTime   int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
-	InStockCount uint      `gorm:"default:0;not null" json:"in_stock_count"`
-	Priority     int64     `gorm:"default:0;not null" json:"priority"`
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;not null" json:"id"`
+	Name         string     `gorm:"index;not null" json:"name"`
+	Description  string     `gorm:"not null" json:"description"`
+	Status       int        `gorm:"default:0;not null" json:"status"`
+	CreateTime   int64      `gorm:"index;autoCreateTime;not null" json:"create_time"`
+	InStockCount uint       `gorm:"default:0;not null" json:"in_stock_count"`
+	Priority     int64      `gorm:"default:0;not null" json:"priority"`
+	CategoryID   *uuid.UUID `gorm:"index" json:"category_id"` // 为空则显示在商品列表首页
+
+	EnablePreOrder    bool `gorm:"default:false;not null" json:"enable_pre_order"` // 无库存时允许预订,付款后补货时按付款顺序发货
+	LowStockThreshold uint `gorm:"default:0;not null" json:"low_stock_threshold"`  // 库存低于该值时提醒管理员,为0则只在售罄时提醒
+
+	InputFields InputFieldList `gorm:"type:json" json:"input_fields"` // 购买前需要用户填写的字段,为空则直接下单
+
+	DeliveryType int    `gorm:"default:0;not null" json:"delivery_type"` // 0.发送库存商品项目 1.付款后调用发货接口生成内容
+	WebhookURL   string `json:"webhook_url"`                             // 发货接口地址,发货类型为1时使用
 
 	Currency string          `gorm:"not null" json:"currency"`
-	Price    decimal.Decimal `gorm:"not null" json:"price"`
+	Price    decimal.Decimal `gorm:"not null" json:"price"` // 有规格时使用规格价格
+
+	PublishTime   *int64 `gorm:"index" json:"publish_time"`   // 定时上架时间,到达后自动上架并清空
+	UnpublishTime *int64 `gorm:"index" json:"unpublish_time"` // 定时下架时间,到达后自动下架并清空
+
+	SalePrice     *decimal.Decimal `json:"sale_price"`                                // 限时特价,为空则没有特价;有规格时使用规格的特价
+	SaleStartTime int64            `gorm:"default:0;not null" json:"sale_start_time"` // 特价开始时间,为0则立即开始
+	SaleEndTime   int64            `gorm:"default:0;not null" json:"sale_end_time"`   // 特价结束时间,为0则不限
+	SaleLimit     uint             `gorm:"default:0;not null" json:"sale_limit"`      // 特价可售数量,有规格时所有规格共用,为0则不限
+
+	UserPurchaseLimit       uint `gorm:"default:0;not null" json:"user_purchase_limit"`        // 每个用户在限购周期内可购买的数量,为0则不限
+	UserPurchaseLimitPeriod int  `gorm:"default:0;not null" json:"user_purchase_limit_period"` // 限购周期 0.永久 1.每天 2.每周
+	DailyPurchaseLimit      uint `gorm:"default:0;not null" json:"daily_purchase_limit"`       // 所有用户每天合计可购买的数量,为0则不限
 
 	ProductItems []ProductItem `gorm:"constraint:OnDelete:CASCADE;"` // product_item有product_id外键联系，product被删除时会联级删除(仅限Delete函数)
 	Orders       []Order       `gorm:"constraint:OnDelete:SET NULL;"`
+
+	RestockSubscriptions []RestockSubscription `gorm:"constraint:OnDelete:CASCADE;"`
+	Variants             []ProductVariant      `gorm:"constraint:OnDelete:CASCADE;" json:"variants"` // 为空则按商品价格和库存出售
+	Media                []ProductMedia        `gorm:"constraint:OnDelete:CASCADE;" json:"media"`    // 商品详情中展示的图片或视频
+
+	Translations []ProductTranslation `gorm:"constraint:OnDelete:CASCADE;" json:"translations,omitempty"` // 其他语言的商品名称和描述
+}
+
+const (
+	ProductDeliveryTypeItem    = 0
+	ProductDeliveryTypeWebhook = 1
+)
+
+const (
+	PurchaseLimitPeriodLifetime = 0
+	PurchaseLimitPeriodDay      = 1
+	PurchaseLimitPeriodWeek     = 2
+)
+
+// 调用发货接口生成内容的商品没有库存限制
+func (t Product) IsWebhookDelivery() bool {
+	return t.DeliveryType == ProductDeliveryTypeWebhook
+}
+
+// 当前时间是否在特价时间内,不检查特价可售数量
+func (t Product) InSaleTime(now int64) bool {
+	return (t.SaleStartTime == 0 || now >= t.SaleStartTime) && (t.SaleEndTime == 0 || now < t.SaleEndTime)
 }
 
 func (*Product) TableName() string {
@@ -1,21 +1,34 @@
 package models
 
 import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"strings"
 )
 
 type ProductItem struct {
 	ID         uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
-	Status     int       `gorm:"default:1;not null" json:"status"` //1未出售，-1已出售，0待支付                                                //0未出售，1已出售，-1待支付
+	Status     int       `gorm:"default:1;not null" json:"status"` //1未出售，-1已出售，0待支付，-2退款作废                                               //0未出售，1已出售，-1待支付
 	CreateTime int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
-	Content    string    `gorm:"not null" json:"content"`
+	Content    string    `gorm:"not null" json:"content"` // 文件商品项目为文件名
+	FileKey    string    `json:"file_key"`                // 文件在存储中的key,为空则为文本内容
+	FileSize   int64     `json:"file_size"`
+
+	Fields      ProductItemFieldList `gorm:"type:json" json:"fields"`                                 // 按列导入的结构化字段,为空则只有文本内容
+	ContentHash string               `gorm:"index:idx_product_item_content_hash,priority:2" json:"-"` // 文本内容的哈希,用于导入时去重
 
 	EndLockTime *uint `gorm:"" json:"end_lock_time"`
 
-	ProductID uuid.UUID `gorm:"" json:"product_id"`
+	ProductID uuid.UUID `gorm:"index:idx_product_item_content_hash,priority:1" json:"product_id"`
 	Product   Product   `gorm:"foreignKey:ProductID"`
 
+	VariantID *uuid.UUID `gorm:"index" json:"variant_id"` // 有规格的商品,项目属于某个规格
+
 	OrderID *uuid.UUID `json:"order_id"` // 只有在锁定或已完成交易才存在
 	Order   *Order     `gorm:"foreignKey:OrderID"`
 }
@@ -26,11 +39,26 @@ func (*ProductItem) TableName() string {
 
 func (t *ProductItem) BeforeCreate(tx *gorm.DB) (err error) {
 	t.ID = uuid.New()
+	if t.ContentHash == "" && !t.IsFile() {
+		t.ContentHash = ProductItemContentHash(t.Content)
+	}
 	return
 }
 func (*ProductItem) DefaultOrder() string {
 	return "create_time DESC"
 }
+func NewFileProductItem(fileName string, fileKey string, fileSize int64, productID uuid.UUID) *ProductItem {
+	productItem := &ProductItem{
+		Content:   fileName,
+		FileKey:   fileKey,
+		FileSize:  fileSize,
+		ProductID: productID,
+	}
+	return productItem
+}
+func (t ProductItem) IsFile() bool {
+	return t.FileKey != ""
+}
 func NewProductItem(content string, productID uuid.UUID) *ProductItem {
 	product := &ProductItem{
 		Content:   content,
@@ -38,3 +66,41 @@ func NewProductItem(content string, productID uuid.UUID) *ProductItem {
 	}
 	return product
 }
+
+// 去除首尾空白后的内容哈希,相同内容视为重复的商品项目
+func ProductItemContentHash(content string) string {
+	hash := sha256.Sum256([]byte(strings.TrimSpace(content)))
+	return hex.EncodeToString(hash[:])
+}
+
+type ProductItemField struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+type ProductItemFieldList []ProductItemField
+
+func (l *ProductItemFieldList) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+
+	var byteValue []byte
+	switch v := value.(type) {
+	case []byte:
+		byteValue = v
+	case string:
+		byteValue = []byte(v)
+	default:
+		return errors.New("unsupported type for ProductItemFieldList")
+	}
+
+	return json.Unmarshal(byteValue, l)
+}
+func (l ProductItemFieldList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
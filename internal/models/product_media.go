@@ -0,0 +1,47 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ProductMediaTypePhoto = "photo"
+	ProductMediaTypeVideo = "video"
+)
+
+// 商品详情中展示的图片或视频,文件保存在blob_store,首次发送后缓存Telegram的file_id
+type ProductMedia struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
+	Type       string    `gorm:"not null" json:"type"` // photo或video
+	FileName   string    `gorm:"not null" json:"file_name"`
+	FileKey    string    `gorm:"not null" json:"file_key"`
+	FileSize   int64     `gorm:"default:0;not null" json:"file_size"`
+	TGFileID   string    `gorm:"default:'';not null" json:"tg_file_id"` // 为空则下次发送时重新上传
+	Priority   int64     `gorm:"default:0;not null" json:"priority"`
+	CreateTime int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
+
+	ProductID uuid.UUID `gorm:"index;not null" json:"product_id"`
+}
+
+func (*ProductMedia) TableName() string {
+	return "product_media"
+}
+func (t *ProductMedia) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*ProductMedia) DefaultOrder() string {
+	return "priority DESC, create_time ASC"
+}
+func NewProductMedia(mediaType string, fileName string, fileKey string, fileSize int64, priority int64, productID uuid.UUID) *ProductMedia {
+	productMedia := &ProductMedia{
+		Type:      mediaType,
+		FileName:  fileName,
+		FileKey:   fileKey,
+		FileSize:  fileSize,
+		Priority:  priority,
+		ProductID: productID,
+	}
+	return productMedia
+}
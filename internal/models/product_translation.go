@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 商品名称和描述的翻译,每个商品每种语言一条,为空的项目使用商品原来的
+type ProductTranslation struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
+	CreateTime int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
+
+	ProductID uuid.UUID `gorm:"uniqueIndex:idx_product_translation_product_language;not null" json:"product_id"`
+	Language  string    `gorm:"uniqueIndex:idx_product_translation_product_language;not null" json:"language"`
+
+	Name        string `gorm:"not null" json:"name"`
+	Description string `gorm:"not null" json:"description"`
+}
+
+func (*ProductTranslation) TableName() string {
+	return "product_translation"
+}
+func (t *ProductTranslation) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*ProductTranslation) DefaultOrder() string {
+	return "language ASC"
+}
+func NewProductTranslation(productID uuid.UUID, language string, name string, description string) *ProductTranslation {
+	productTranslation := &ProductTranslation{
+		ProductID:   productID,
+		Language:    language,
+		Name:        name,
+		Description: description,
+	}
+	return productTranslation
+}
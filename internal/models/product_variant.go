@@ -0,0 +1,45 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// 商品规格,有规格的商品按规格定价,每个规格有单独的库存
+type ProductVariant struct {
+	ID           uuid.UUID       `gorm:"type:uuid;primary_key;not null" json:"id"`
+	Name         string          `gorm:"not null" json:"name"`
+	CreateTime   int64           `gorm:"index;autoCreateTime;not null" json:"create_time"`
+	Priority     int64           `gorm:"default:0;not null" json:"priority"`
+	Price        decimal.Decimal `gorm:"not null" json:"price"` // 与商品同一货币
+	InStockCount uint            `gorm:"default:0;not null" json:"in_stock_count"`
+
+	SalePrice *decimal.Decimal `json:"sale_price"` // 限时特价,时间和可售数量使用商品的设置
+
+	ProductID uuid.UUID `gorm:"index;not null" json:"product_id"`
+	Product   Product   `gorm:"foreignKey:ProductID"`
+
+	ProductItems []ProductItem `gorm:"foreignKey:VariantID;constraint:OnDelete:SET NULL;"` // 删除规格时未售出的项目一并删除,已售出的保留
+	Orders       []Order       `gorm:"foreignKey:VariantID;constraint:OnDelete:SET NULL;"`
+}
+
+func (*ProductVariant) TableName() string {
+	return "product_variant"
+}
+func (t *ProductVariant) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*ProductVariant) DefaultOrder() string {
+	return "priority DESC, create_time ASC"
+}
+func NewProductVariant(name string, price decimal.Decimal, priority int64, productID uuid.UUID) *ProductVariant {
+	productVariant := &ProductVariant{
+		Name:      name,
+		Price:     price,
+		Priority:  priority,
+		ProductID: productID,
+	}
+	return productVariant
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// 订单退款,创建后需管理员确认才会发送,链上退款发送前将状态改为发送中,防止重复发送
+type Refund struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
+	Status      int       `gorm:"index;default:0;not null" json:"status"` // 0.待确认 1.已退款 2.发送失败 3.发送中 -1.已取消
+	Cate        int       `gorm:"not null" json:"cate"`                   // 1.链上原路退回 2.退回余额
+	CreateTime  int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
+	ConfirmTime int64     `json:"confirm_time"`
+
+	Currency  string          `gorm:"not null" json:"currency"` // 与订单货币一致
+	Network   string          `gorm:"not null" json:"network"`
+	Amount    decimal.Decimal `gorm:"not null" json:"amount"`
+	ToAddress string          `json:"to_address"` // 链上退款的收款地址
+	TxID      string          `gorm:"index" json:"tx_id"`
+
+	ItemAction int    `gorm:"default:0;not null" json:"item_action"` // 商品项目处理 0.保留 1.退回库存 2.作废
+	Remark     string `json:"remark"`
+	LastError  string `json:"last_error"`
+
+	OrderID uuid.UUID `gorm:"index;not null" json:"order_id"`
+	Order   Order     `gorm:"foreignKey:OrderID"`
+}
+
+func (*Refund) TableName() string {
+	return "refund"
+}
+func (t *Refund) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*Refund) DefaultOrder() string {
+	return "create_time DESC"
+}
+func NewRefund(orderID uuid.UUID, cate int, currency string, network string, amount decimal.Decimal, toAddress string, itemAction int, remark string) *Refund {
+	refund := &Refund{
+		OrderID:    orderID,
+		Cate:       cate,
+		Currency:   currency,
+		Network:    network,
+		Amount:     amount,
+		ToAddress:  toAddress,
+		ItemAction: itemAction,
+		Remark:     remark,
+	}
+	return refund
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 到货通知订阅,补货通知后删除
+type RestockSubscription struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
+	CreateTime int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
+
+	ProductID uuid.UUID `gorm:"uniqueIndex:idx_restock_subscription_product_chat;not null" json:"product_id"`
+	Product   Product   `gorm:"foreignKey:ProductID"`
+
+	TGUsername string `gorm:"index;" json:"tg_username"`
+	TGChatID   int64  `gorm:"uniqueIndex:idx_restock_subscription_product_chat;not null" json:"tg_chat_id"`
+}
+
+func (*RestockSubscription) TableName() string {
+	return "restock_subscription"
+}
+func (t *RestockSubscription) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*RestockSubscription) DefaultOrder() string {
+	return "create_time DESC"
+}
+func NewRestockSubscription(productID uuid.UUID, tgChatID int64, tgUsername string) *RestockSubscription {
+	restockSubscription := &RestockSubscription{
+		ProductID:  productID,
+		TGChatID:   tgChatID,
+		TGUsername: tgUsername,
+	}
+	return restockSubscription
+}
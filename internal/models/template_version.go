@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 模板的历史版本,后台每次保存模板时记录,用于回滚
+type TemplateVersion struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
+	CreateTime int64     `gorm:"index;autoCreateTime;not null" json:"create_time"`
+
+	Language string `gorm:"index:idx_template_version_language_name;not null" json:"language"`
+	Name     string `gorm:"index:idx_template_version_language_name;not null" json:"name"` // 模板文件名,如welcome.tpl
+
+	Content string `gorm:"not null" json:"content"`
+	Remark  string `json:"remark"`
+}
+
+func (*TemplateVersion) TableName() string {
+	return "template_version"
+}
+func (t *TemplateVersion) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+func (*TemplateVersion) DefaultOrder() string {
+	return "create_time DESC"
+}
+func NewTemplateVersion(language string, name string, content string, remark string) *TemplateVersion {
+	templateVersion := &TemplateVersion{
+		Language: language,
+		Name:     name,
+		Content:  content,
+		Remark:   remark,
+	}
+	return templateVersion
+}
@@ -10,15 +10,16 @@ import (
 // 属性为指针的时候，不会赋予默认值，json报marshal会跳过nil
 type Transfer struct {
 	ID     uuid.UUID `gorm:"type:uuid;primary_key;not null" json:"id"`
-	Status int       `gorm:"default:1;not null" json:"status"`
-	Cate   uint      `gorm:"default:0;not null" json:"cate"` // 0.未分类 1.小数点钱包交易 2.非小数点钱包交易 3.用户的固定钱包交易
+	Status int       `gorm:"default:1;not null" json:"status"` // 1.已匹配订单 2.未匹配待处理 3.已手动分配订单 4.已退款 5.已忽略
+	Cate   uint      `gorm:"default:0;not null" json:"cate"`   // 0.未分类 1.小数点钱包交易 2.非小数点钱包交易 3.用户的固定钱包交易
 
 	Currency      string          `gorm:"not null" json:"currency"`
 	Network       string          `gorm:"not null" json:"network"`
 	TransactionID string          `gorm:"index;not null" json:"transaction_id"` // 不使用unique了,支出和收入重复了
 	Price         decimal.Decimal `gorm:"not null" json:"price"`
 
-	CreateTime int64 `gorm:"index;not null" json:"create_time"`
+	CreateTime int64  `gorm:"index;not null" json:"create_time"`
+	Remark     string `json:"remark"`
 
 	FromAddress string `gorm:"index;not null" json:"from_address"`
 	ToAddress   string `gorm:"index;not null" json:"to_address"`
@@ -1,14 +1,42 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
 
+// Telegram用户,记录余额和用户选择的语言,余额单位为config.BalanceCurrency
 type User struct {
-	ID uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	ID         uuid.UUID       `gorm:"type:uuid;primary_key;not null" json:"id"`
+	CreateTime int64           `gorm:"index;autoCreateTime;not null" json:"create_time"`
+	TGChatID   int64           `gorm:"uniqueIndex;not null" json:"tg_chat_id"`
+	TGUsername string          `gorm:"index" json:"tg_username"`
+	Balance    decimal.Decimal `gorm:"default:0;not null" json:"balance"`
+	Language   string          `gorm:"default:'';not null" json:"language"` // 在 /language 中选择的语言,为空则跟随Telegram客户端语言
+	// 最近一次收到用户消息时的Telegram客户端语言,重启后定时任务给用户发消息时也能使用
+	TGLanguageCode string `gorm:"default:'';not null" json:"tg_language_code"`
+
+	BalanceLogs []BalanceLog `gorm:"constraint:OnDelete:CASCADE;"`
 }
 
-func (User) TableName() string {
+func (*User) TableName() string {
 	return "user"
 }
+func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
+	u.ID = uuid.New()
+	return
+}
+func (*User) DefaultOrder() string {
+	return "create_time DESC"
+}
+func NewUser(tgChatID int64, tgUsername string) *User {
+	user := &User{
+		TGChatID:   tgChatID,
+		TGUsername: tgUsername,
+	}
+	return user
+}
 
 //
 //import (
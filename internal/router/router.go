@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gopay/internal/exts/blob_store"
 	"gopay/internal/exts/cache"
 	"gopay/internal/exts/config"
 	"gopay/internal/exts/db"
@@ -22,6 +23,7 @@ func SetupRoutes() *gin.Engine {
 	db.InitAllDB()
 	tg_bot.InitTGBot()
 	cache.InitCache()
+	blob_store.InitBlobStore()
 
 	r := gin.Default()
 
@@ -31,21 +33,73 @@ func SetupRoutes() *gin.Engine {
 	r.POST("/api/admin/info", middleware.AdminAuthMiddleware(), admin_handler.Info)
 	r.POST("/api/admin/dashboard", middleware.AdminAuthMiddleware(), admin_handler.Dashboard)
 	r.POST("/api/admin/dashboard_chart", middleware.AdminAuthMiddleware(), admin_handler.DashboardChart)
+	r.POST("/api/admin/stock_summary", middleware.AdminAuthMiddleware(), admin_handler.StockSummary)
+
+	r.POST("/api/admin/category", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.Category])
+	r.POST("/api/admin/create_category", middleware.AdminAuthMiddleware(), admin_handler.CreateCategory)
+	r.POST("/api/admin/edit_category", middleware.AdminAuthMiddleware(), admin_handler.EditCategory)
+	r.POST("/api/admin/delete_categories", middleware.AdminAuthMiddleware(), admin_handler.DeleteCategories)
+	r.POST("/api/admin/assign_products_category", middleware.AdminAuthMiddleware(), admin_handler.AssignProductsCategory)
 
 	r.POST("/api/admin/product", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.Product])
 	r.POST("/api/admin/create_product", middleware.AdminAuthMiddleware(), admin_handler.CreateProduct)
 	r.POST("/api/admin/edit_product", middleware.AdminAuthMiddleware(), admin_handler.EditProduct)
+	r.POST("/api/admin/set_product_schedule", middleware.AdminAuthMiddleware(), admin_handler.SetProductSchedule)
 	r.POST("/api/admin/delete_products", middleware.AdminAuthMiddleware(), admin_handler.DeleteEntities[*models.Product])
 
+	r.POST("/api/admin/product_variant", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.ProductVariant])
+	r.POST("/api/admin/create_product_variant", middleware.AdminAuthMiddleware(), admin_handler.CreateProductVariant)
+	r.POST("/api/admin/edit_product_variant", middleware.AdminAuthMiddleware(), admin_handler.EditProductVariant)
+	r.POST("/api/admin/delete_product_variants", middleware.AdminAuthMiddleware(), admin_handler.DeleteProductVariants)
+
+	r.POST("/api/admin/product_media", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.ProductMedia])
+	r.POST("/api/admin/upload_product_media", middleware.AdminAuthMiddleware(), admin_handler.UploadProductMedia)
+	r.POST("/api/admin/edit_product_media", middleware.AdminAuthMiddleware(), admin_handler.EditProductMedia)
+	r.POST("/api/admin/delete_product_media", middleware.AdminAuthMiddleware(), admin_handler.DeleteProductMedia)
+
+	r.POST("/api/admin/languages", middleware.AdminAuthMiddleware(), admin_handler.Languages)
+	r.POST("/api/admin/product_translation", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.ProductTranslation])
+	r.POST("/api/admin/set_product_translation", middleware.AdminAuthMiddleware(), admin_handler.SetProductTranslation)
+	r.POST("/api/admin/delete_product_translations", middleware.AdminAuthMiddleware(), admin_handler.DeleteProductTranslations)
+
+	r.POST("/api/admin/templates", middleware.AdminAuthMiddleware(), admin_handler.Templates)
+	r.POST("/api/admin/template", middleware.AdminAuthMiddleware(), admin_handler.Template)
+	r.POST("/api/admin/preview_template", middleware.AdminAuthMiddleware(), admin_handler.PreviewTemplate)
+	r.POST("/api/admin/save_template", middleware.AdminAuthMiddleware(), admin_handler.SaveTemplate)
+	r.POST("/api/admin/reload_templates", middleware.AdminAuthMiddleware(), admin_handler.ReloadTemplates)
+	r.POST("/api/admin/template_version", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.TemplateVersion])
+	r.POST("/api/admin/rollback_template", middleware.AdminAuthMiddleware(), admin_handler.RollbackTemplate)
+
 	r.POST("/api/admin/product_item", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.ProductItem])
 	r.POST("/api/admin/create_product_items", middleware.AdminAuthMiddleware(), admin_handler.CreateProductItems)
+	r.POST("/api/admin/upload_product_items", middleware.AdminAuthMiddleware(), admin_handler.UploadProductItems)
+	r.POST("/api/admin/import_product_items", middleware.AdminAuthMiddleware(), admin_handler.ImportProductItems)
+	r.POST("/api/admin/export_product_items", middleware.AdminAuthMiddleware(), admin_handler.ExportProductItems)
 	r.POST("/api/admin/delete_product_items", middleware.AdminAuthMiddleware(), admin_handler.DeleteProductItems) //这个要更新product库存，deletebefore是按删除个数执行的，效率低
 	//r.POST("/api/admin/delete_product_items", middleware.AdminAuthMiddleware(), admin_handler.DeleteEntities[*models.ProductItem])
 
 	r.POST("/api/admin/order", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.Order])
 	r.POST("/api/admin/release_orders", middleware.AdminAuthMiddleware(), admin_handler.ReleaseOrders)
+	r.POST("/api/admin/order_detail", middleware.AdminAuthMiddleware(), admin_handler.OrderDetail)
+	r.POST("/api/admin/order_event", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.OrderEvent])
+	r.POST("/api/admin/delivery_outbox", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.DeliveryOutbox])
+	r.POST("/api/admin/restock_subscription", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.RestockSubscription])
+	r.POST("/api/admin/retry_deliveries", middleware.AdminAuthMiddleware(), admin_handler.RetryDeliveries)
+	r.POST("/api/admin/webhook_queue", middleware.AdminAuthMiddleware(), admin_handler.WebhookResolutionQueue)
+	r.POST("/api/admin/resolve_webhook_delivery", middleware.AdminAuthMiddleware(), admin_handler.ResolveWebhookDelivery)
+	r.POST("/api/admin/refund", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.Refund])
+	r.POST("/api/admin/create_refund", middleware.AdminAuthMiddleware(), admin_handler.CreateRefund)
+	r.POST("/api/admin/confirm_refund", middleware.AdminAuthMiddleware(), admin_handler.ConfirmRefund)
+	r.POST("/api/admin/cancel_refund", middleware.AdminAuthMiddleware(), admin_handler.CancelRefund)
 
 	r.POST("/api/admin/transfer", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.Transfer])
+	r.POST("/api/admin/unmatched_transfer", middleware.AdminAuthMiddleware(), admin_handler.UnmatchedTransfers)
+	r.POST("/api/admin/assign_transfer", middleware.AdminAuthMiddleware(), admin_handler.AssignTransfer)
+	r.POST("/api/admin/resolve_transfers", middleware.AdminAuthMiddleware(), admin_handler.ResolveTransfers)
+
+	r.POST("/api/admin/user", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.User])
+	r.POST("/api/admin/balance_log", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.BalanceLog])
+	r.POST("/api/admin/edit_user_balance", middleware.AdminAuthMiddleware(), admin_handler.EditUserBalance)
 
 	r.POST("/api/admin/wallet", middleware.AdminAuthMiddleware(), admin_handler.FetchList[*models.Wallet])
 	r.POST("/api/admin/generate_wallet", middleware.AdminAuthMiddleware(), admin_handler.GenerateWallet)
@@ -93,19 +147,76 @@ func handleUpdate(update tgbotapi.Update) {
 				tg_handler.ProductList(update)
 			case "paid_order":
 				tg_handler.PaidOrder(update)
+			case "balance":
+				tg_handler.BalanceCommand(update)
+			case "orders":
+				if update.Message.CommandArguments() == "pending" && tg_handler.IsAdmin(update.Message.Chat.ID) {
+					tg_handler.AdminPendingOrders(update)
+				} else {
+					tg_handler.PendingOrders(update)
+				}
+			case "search":
+				tg_handler.SearchCommand(update)
+			case "language":
+				tg_handler.LanguageCommand(update)
+			case "stats":
+				tg_handler.AdminStatsCommand(update)
+			case "release":
+				tg_handler.AdminReleaseCommand(update)
+			case "stock":
+				tg_handler.AdminStockCommand(update)
+			case "addstock":
+				tg_handler.AdminAddStockCommand(update)
+			case "wallets":
+				tg_handler.AdminWalletsCommand(update)
 			}
+		} else {
+			tg_handler.InputText(update)
 		}
 	}
+	if update.InlineQuery != nil {
+		tg_handler.InlineQuery(update)
+	}
 	if update.CallbackQuery != nil {
 		callbackData := update.CallbackQuery.Data
 		if strings.HasPrefix(callbackData, tg_handler.ProductListPagePrefix) {
 			tg_handler.ProductList(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.CategoryPrefix) {
+			tg_handler.CategoryProductList(update)
 		} else if strings.HasPrefix(callbackData, tg_handler.ProductDetailPrefix) {
 			tg_handler.ProductDetail(update)
-		} else if strings.HasPrefix(callbackData, tg_handler.PayOrderPrefix) {
+		} else if strings.HasPrefix(callbackData, tg_handler.VariantDetailPrefix) {
+			tg_handler.VariantDetail(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.PayOrderPrefix) || strings.HasPrefix(callbackData, tg_handler.PayVariantOrderPrefix) {
 			tg_handler.PayOrder(update)
 		} else if strings.HasPrefix(callbackData, tg_handler.GetPaidOrderResultPrefix) {
 			tg_handler.GetPaidOrderResult(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.DepositAmountPrefix) {
+			tg_handler.DepositAmount(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.DepositOrderPrefix) {
+			tg_handler.DepositOrder(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.CheckPaymentPrefix) {
+			tg_handler.CheckPayment(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.SwitchPaymentPrefix) {
+			tg_handler.SwitchPayment(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.CancelOrderPrefix) {
+			tg_handler.CancelOrder(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.RestockSubscribePrefix) {
+			tg_handler.RestockSubscribe(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.InputChoicePrefix) {
+			tg_handler.InputChoice(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.InputActionPrefix) {
+			tg_handler.InputAction(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.SearchPagePrefix) {
+			tg_handler.SearchPage(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.LanguagePrefix) {
+			tg_handler.SetLanguage(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.AdminOrdersPagePrefix) {
+			tg_handler.AdminPendingOrders(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.AdminStockPagePrefix) {
+			tg_handler.AdminStockCommand(update)
+		} else if strings.HasPrefix(callbackData, tg_handler.AdminWalletsPagePrefix) {
+			tg_handler.AdminWalletsCommand(update)
 		} else if callbackData == "delete_msg" {
 			tg_handler.CallbackDeleteMsg(update)
 		}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// 以下为管理员在Telegram中使用的查询和操作
+
+// 所有用户的待支付订单
+func GetPendingOrdersByAdmin(pagination *Pagination) error {
+	query := db.DB.Preload("Product").Where("status = 0").Order((&models.Order{}).DefaultOrder())
+	return Paginate[models.Order](pagination, query)
+}
+
+func CountPendingOrders() (int64, error) {
+	var count int64
+	if err := db.DB.Model(&models.Order{}).Where("status = 0").Count(&count).Error; err != nil {
+		return 0, errors.New("获取订单错误")
+	}
+	return count, nil
+}
+
+// 管理员关闭待支付订单,解锁钱包和商品项目
+func ReleaseOrderByAdmin(orderID uuid.UUID) (models.Order, error) {
+	var order models.Order
+	if result := db.DB.Where("id = ?", orderID).Find(&order); result.Error != nil {
+		return order, errors.New("获取订单错误")
+	} else if result.RowsAffected == 0 {
+		return order, errors.New("没有该订单")
+	}
+	if order.Status != 0 {
+		return order, errors.New("只能关闭待支付订单")
+	}
+	// 查询后订单可能已付款或超时,以实际关闭的数量为准
+	if count, err := releaseOrders([]uuid.UUID{order.ID}, models.OrderEventActorAdmin); err != nil {
+		return order, err
+	} else if count == 0 {
+		return order, errors.New("只能关闭待支付订单")
+	}
+	return order, nil
+}
+
+// 按商品ID或名称查询商品,包括未上架的,keyword为空则查询全部
+func SearchProductsByAdmin(pagination *Pagination, keyword string) error {
+	query := db.DB
+	if keyword = strings.TrimSpace(keyword); keyword != "" {
+		if productID, err := uuid.Parse(keyword); err == nil {
+			query = query.Where("id = ?", productID)
+		} else {
+			pattern := "%" + productSearchEscaper.Replace(strings.ToLower(keyword)) + "%"
+			query = query.Where("LOWER(name) LIKE ? ESCAPE '\\'", pattern)
+		}
+	}
+	query = query.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order((&models.ProductVariant{}).DefaultOrder())
+	}).Order((&models.Product{}).DefaultOrder())
+	return Paginate[models.Product](pagination, query)
+}
+
+// 商品或规格的商品项目数量
+type ProductItemCount struct {
+	Unsold uint // 未出售
+	Locked uint // 待支付订单锁定
+	Sold   uint
+}
+
+// 按商品和规格统计商品项目数量,key为规格ID,没有规格的为商品ID
+func GetProductItemCounts(productIDs []uuid.UUID) (map[uuid.UUID]*ProductItemCount, error) {
+	var rows []struct {
+		ProductID uuid.UUID
+		VariantID *uuid.UUID
+		Status    int
+		Count     uint
+	}
+	if err := db.DB.Model(&models.ProductItem{}).Select("product_id, variant_id, status, count(*) as count").
+		Where("product_id in ?", productIDs).Group("product_id, variant_id, status").Scan(&rows).Error; err != nil {
+		return nil, errors.New("获取商品项目错误")
+	}
+
+	counts := make(map[uuid.UUID]*ProductItemCount)
+	for _, row := range rows {
+		key := row.ProductID
+		if row.VariantID != nil {
+			key = *row.VariantID
+		}
+		if counts[key] == nil {
+			counts[key] = &ProductItemCount{}
+		}
+		switch row.Status {
+		case 1:
+			counts[key].Unsold += row.Count
+		case 0:
+			counts[key].Locked += row.Count
+		case -1:
+			counts[key].Sold += row.Count
+		}
+	}
+	return counts, nil
+}
+
+// 按商品ID或完整名称获取商品,同名商品有多个时需使用ID
+func GetProductByAdmin(keyword string) (models.Product, error) {
+	var products []models.Product
+	query := db.DB.Preload("Variants")
+	if productID, err := uuid.Parse(keyword); err == nil {
+		query = query.Where("id = ?", productID)
+	} else {
+		query = query.Where("name = ?", keyword)
+	}
+	if err := query.Limit(2).Find(&products).Error; err != nil {
+		return models.Product{}, errors.New("获取商品错误")
+	}
+	if len(products) == 0 {
+		return models.Product{}, errors.New("没有该商品")
+	} else if len(products) > 1 {
+		return models.Product{}, errors.New("有多个同名商品, 请使用商品ID")
+	}
+	return products[0], nil
+}
+
+// 按规格ID或名称获取商品的规格
+func GetProductVariantByAdmin(product models.Product, keyword string) (*models.ProductVariant, error) {
+	for _, variant := range product.Variants {
+		if variant.ID.String() == keyword || variant.Name == keyword {
+			return &variant, nil
+		}
+	}
+	return nil, errors.New("没有该规格")
+}
+
+// 钱包池中每个主网每种状态的钱包数量
+type WalletPoolEntry struct {
+	Network string
+	Status  int
+	Count   int64
+}
+
+func GetWalletPoolSummary() ([]WalletPoolEntry, error) {
+	var entries []WalletPoolEntry
+	if err := db.DB.Model(&models.Wallet{}).Select("network, status, count(*) as count").
+		Group("network, status").Order("network, status").Scan(&entries).Error; err != nil {
+		return nil, errors.New("获取钱包错误")
+	}
+	return entries, nil
+}
+
+func GetWalletsByAdmin(pagination *Pagination) error {
+	return Paginate[models.Wallet](pagination, db.DB.Order(GetWalletOrder()))
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"github.com/google/uuid"
+	"gopay/internal/models"
+	"testing"
+)
+
+func TestReleaseOrderByAdminNotPending(t *testing.T) {
+	setupTestDB(t)
+	order := &models.Order{Status: 1}
+	createTestOrder(t, order)
+
+	// 已不是待支付状态的订单不会被关闭,返回实际关闭的数量
+	if count, err := releaseOrders([]uuid.UUID{order.ID}, models.OrderEventActorAdmin); err != nil || count != 0 {
+		t.Fatalf("关闭 %d 个订单 %v, 应为 0 个", count, err)
+	}
+	if _, err := ReleaseOrderByAdmin(order.ID); err == nil {
+		t.Fatal("只能关闭待支付订单")
+	}
+	assertTestOrder(t, *order, 1, "0")
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+)
+
+// 机器人中显示的分类,ProductCount包含子分类中的上架商品
+type CategoryEntry struct {
+	Category     models.Category
+	ProductCount int64
+}
+
+// 全部分类和每个分类直接包含的上架商品数量,分类数量不多,每次全量加载
+type categoryTree struct {
+	categories  map[uuid.UUID]models.Category
+	children    map[uuid.UUID][]uuid.UUID // 顶级分类的key为uuid.Nil
+	directCount map[uuid.UUID]int64
+}
+
+func loadCategoryTree() (*categoryTree, error) {
+	var categories []models.Category
+	if result := db.DB.Order((&models.Category{}).DefaultOrder()).Find(&categories); result.Error != nil {
+		return nil, errors.New("获取分类失败")
+	}
+	var counts []struct {
+		CategoryID   uuid.UUID
+		ProductCount int64
+	}
+	if result := db.DB.Model(&models.Product{}).Select("category_id, count(*) as product_count").Where("status = 1 and category_id is not null").Group("category_id").Scan(&counts); result.Error != nil {
+		return nil, errors.New("获取分类商品数量失败")
+	}
+
+	tree := &categoryTree{
+		categories:  make(map[uuid.UUID]models.Category),
+		children:    make(map[uuid.UUID][]uuid.UUID),
+		directCount: make(map[uuid.UUID]int64),
+	}
+	for _, category := range categories {
+		tree.categories[category.ID] = category
+		parentKey := uuid.Nil
+		if category.ParentID != nil {
+			parentKey = *category.ParentID
+		}
+		tree.children[parentKey] = append(tree.children[parentKey], category.ID)
+	}
+	for _, count := range counts {
+		tree.directCount[count.CategoryID] = count.ProductCount
+	}
+	return tree, nil
+}
+
+// 分类及其显示的子分类中的上架商品数量,隐藏的子分类不计入
+func (t *categoryTree) visibleProductCount(categoryID uuid.UUID, depth int) int64 {
+	// 正常不会有循环,防止数据错误导致无限递归
+	if depth > len(t.categories) {
+		return 0
+	}
+	count := t.directCount[categoryID]
+	for _, childID := range t.children[categoryID] {
+		if t.categories[childID].Status == 1 {
+			count += t.visibleProductCount(childID, depth+1)
+		}
+	}
+	return count
+}
+
+// 分类和所有上级分类都没有隐藏
+func (t *categoryTree) isVisible(categoryID uuid.UUID) bool {
+	for depth := 0; depth <= len(t.categories); depth++ {
+		category, ok := t.categories[categoryID]
+		if !ok || category.Status != 1 {
+			return false
+		}
+		if category.ParentID == nil {
+			return true
+		}
+		categoryID = *category.ParentID
+	}
+	return false
+}
+
+// 机器人中显示的下级分类,parentID为空时为顶级分类,隐藏和没有上架商品的分类不显示
+func GetSubCategoriesByCustomer(parentID *uuid.UUID) ([]CategoryEntry, error) {
+	tree, err := loadCategoryTree()
+	if err != nil {
+		return nil, err
+	}
+	parentKey := uuid.Nil
+	if parentID != nil {
+		if !tree.isVisible(*parentID) {
+			return nil, errors.New("分类不存在")
+		}
+		parentKey = *parentID
+	}
+
+	var categoryEntries []CategoryEntry
+	for _, childID := range tree.children[parentKey] {
+		category := tree.categories[childID]
+		if category.Status != 1 {
+			continue
+		}
+		if productCount := tree.visibleProductCount(childID, 0); productCount > 0 {
+			categoryEntries = append(categoryEntries, CategoryEntry{Category: category, ProductCount: productCount})
+		}
+	}
+	return categoryEntries, nil
+}
+
+func GetCategoryByCustomer(categoryID uuid.UUID) (models.Category, error) {
+	tree, err := loadCategoryTree()
+	if err != nil {
+		return models.Category{}, err
+	}
+	if !tree.isVisible(categoryID) {
+		return models.Category{}, errors.New("分类不存在")
+	}
+	return tree.categories[categoryID], nil
+}
+
+// 校验上级分类存在,且不是分类自身或其子分类
+func checkCategoryParent(categoryID *uuid.UUID, parentID *uuid.UUID) error {
+	if parentID == nil {
+		return nil
+	}
+	tree, err := loadCategoryTree()
+	if err != nil {
+		return err
+	}
+	ancestorID := *parentID
+	for depth := 0; depth <= len(tree.categories); depth++ {
+		ancestor, ok := tree.categories[ancestorID]
+		if !ok {
+			return errors.New("上级分类不存在")
+		}
+		if categoryID != nil && ancestor.ID == *categoryID {
+			return errors.New("上级分类不能是自身或子分类")
+		}
+		if ancestor.ParentID == nil {
+			return nil
+		}
+		ancestorID = *ancestor.ParentID
+	}
+	return errors.New("分类层级错误")
+}
+
+func CreateCategory(category *models.Category) error {
+	if err := checkCategoryParent(nil, category.ParentID); err != nil {
+		return err
+	}
+	if result := db.DB.Create(category); result.Error != nil {
+		return errors.New("创建分类失败")
+	}
+	return nil
+}
+
+// parentChanged为true时修改上级分类,parentID为空表示移到顶级
+func UpdateCategory(categoryID uuid.UUID, updateMap map[string]interface{}, parentChanged bool, parentID *uuid.UUID) error {
+	if parentChanged {
+		if err := checkCategoryParent(&categoryID, parentID); err != nil {
+			return err
+		}
+		updateMap["parent_id"] = parentID
+	}
+	if len(updateMap) == 0 {
+		return errors.New("没有修改内容")
+	}
+	result := db.DB.Model(&models.Category{}).Where("id = ?", categoryID).Updates(updateMap)
+	if result.Error != nil {
+		return errors.New("更新分类失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("not_found")
+	}
+	return nil
+}
+
+// 删除分类,子分类移到被删除分类的上级,分类中的商品移到商品列表首页
+func DeleteCategories(categoryIDs []uuid.UUID) error {
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	var categories []models.Category
+	if result := tx.Where("id in ?", categoryIDs).Find(&categories); result.Error != nil {
+		return errors.New("获取分类失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("not_found")
+	}
+	deleting := make(map[uuid.UUID]models.Category)
+	for _, category := range categories {
+		deleting[category.ID] = category
+	}
+
+	for _, category := range categories {
+		// 上级也被删除时继续向上查找
+		newParentID := category.ParentID
+		for depth := 0; newParentID != nil && depth <= len(deleting); depth++ {
+			parent, ok := deleting[*newParentID]
+			if !ok {
+				break
+			}
+			newParentID = parent.ParentID
+		}
+		if result := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).Update("parent_id", newParentID); result.Error != nil {
+			return errors.New("更新子分类失败")
+		}
+	}
+	if result := tx.Model(&models.Product{}).Where("category_id in ?", categoryIDs).Update("category_id", nil); result.Error != nil {
+		return errors.New("更新商品失败")
+	}
+	if result := tx.Where("id in ?", categoryIDs).Delete(&models.Category{}); result.Error != nil {
+		return errors.New("删除分类失败")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.New("提交失败, " + err.Error())
+	}
+	return nil
+}
+
+// 商品所属分类校验,nil表示不属于任何分类
+func CheckProductCategory(categoryID *uuid.UUID) error {
+	if categoryID == nil {
+		return nil
+	}
+	var count int64
+	if result := db.DB.Model(&models.Category{}).Where("id = ?", *categoryID).Count(&count); result.Error != nil || count == 0 {
+		return errors.New("分类不存在")
+	}
+	return nil
+}
+
+// 批量设置商品分类,categoryID为空则移到商品列表首页
+func AssignProductsCategory(productIDs []uuid.UUID, categoryID *uuid.UUID) error {
+	if err := CheckProductCategory(categoryID); err != nil {
+		return err
+	}
+	result := db.DB.Model(&models.Product{}).Where("id in ?", productIDs).Update("category_id", categoryID)
+	if result.Error != nil {
+		return errors.New("更新商品失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("not_found")
+	}
+	return nil
+}
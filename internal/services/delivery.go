@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gopay/internal/utils/handle_defender"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var deliveryMaxAttempts = 8
+var deliveryBaseBackoff = time.Second * 30
+var deliveryMaxBackoff = time.Hour
+
+// 抢占后的锁定时长,发送过程中进程退出,超过这个时间后会被重新发送
+var deliveryClaimLease = time.Minute * 2
+
+// 写入发货消息,必须在订单完成的事务中调用,同一订单重复写入忽略
+func AddDeliveryOutbox(tx *gorm.DB, orderID uuid.UUID) error {
+	deliveryOutbox := models.NewDeliveryOutbox(orderID, time.Now().Unix())
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "order_id"}},
+		DoNothing: true,
+	}).Create(deliveryOutbox).Error; err != nil {
+		return errors.New("写入发货消息失败")
+	}
+	return nil
+}
+
+// 重新发送订单的发货消息,用于预订订单补货后发货,必须在绑定商品项目的事务中调用
+func RequeueDeliveryOutbox(tx *gorm.DB, orderID uuid.UUID) error {
+	deliveryOutbox := models.NewDeliveryOutbox(orderID, time.Now().Unix())
+	if err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "order_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":        0,
+			"attempts":      0,
+			"next_try_time": deliveryOutbox.NextTryTime,
+			"last_error":    "",
+		}),
+	}).Create(deliveryOutbox).Error; err != nil {
+		return errors.New("写入发货消息失败")
+	}
+	if result := tx.Model(&models.Order{}).Where("id = ?", orderID).Update("notify_status", 0); result.Error != nil {
+		return errors.New("更新订单失败")
+	}
+	return nil
+}
+
+// 发送所有到期的发货消息,由定时任务调用
+func ProcessDeliveryOutbox() error {
+	var deliveryOutboxes []models.DeliveryOutbox
+	if result := db.DB.Where("status = 0 and next_try_time <= ?", time.Now().Unix()).Order("next_try_time asc").Limit(100).Find(&deliveryOutboxes); result.Error != nil {
+		return errors.New("查询发货消息失败")
+	}
+	for _, deliveryOutbox := range deliveryOutboxes {
+		deliverOutbox(deliveryOutbox)
+	}
+	return nil
+}
+
+// 立即发送指定订单的发货消息,失败的由定时任务重试
+func DeliverOrders(orderIDs []uuid.UUID) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+	var deliveryOutboxes []models.DeliveryOutbox
+	if result := db.DB.Where("status = 0 and next_try_time <= ? and order_id in ?", time.Now().Unix(), orderIDs).Find(&deliveryOutboxes); result.Error != nil {
+		return errors.New("查询发货消息失败")
+	}
+	for _, deliveryOutbox := range deliveryOutboxes {
+		deliverOutbox(deliveryOutbox)
+	}
+	return nil
+}
+
+// 重新发送多次失败的发货消息
+func RetryDeliveries(deliveryOutboxIDs []uuid.UUID) error {
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	var deliveryOutboxes []models.DeliveryOutbox
+	if result := tx.Where("status = 2 and id in ?", deliveryOutboxIDs).Find(&deliveryOutboxes); result.Error != nil {
+		return errors.New("查询发货消息失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("没有发送失败的发货消息")
+	}
+	var orderIDs []uuid.UUID
+	for _, deliveryOutbox := range deliveryOutboxes {
+		orderIDs = append(orderIDs, deliveryOutbox.OrderID)
+	}
+
+	if result := tx.Model(&models.DeliveryOutbox{}).Where("status = 2 and id in ?", deliveryOutboxIDs).Updates(map[string]interface{}{
+		"status":        0,
+		"attempts":      0,
+		"next_try_time": time.Now().Unix(),
+	}); result.Error != nil {
+		return errors.New("更新发货消息失败")
+	}
+	if result := tx.Model(&models.Order{}).Where("id in ?", orderIDs).Update("notify_status", 0); result.Error != nil {
+		return errors.New("更新订单失败")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.New("提交失败, " + err.Error())
+	}
+	return DeliverOrders(orderIDs)
+}
+
+// 第n次失败后的等待时间,指数增长
+func deliveryBackoff(attempts int) time.Duration {
+	backoff := deliveryBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff = backoff * 2
+		if backoff >= deliveryMaxBackoff {
+			return deliveryMaxBackoff
+		}
+	}
+	return backoff
+}
+
+func deliverOutbox(deliveryOutbox models.DeliveryOutbox) {
+	// 抢占,只有一个调用者能更新成功,防止定时任务和即时发送重复发货
+	now := time.Now().Unix()
+	if result := db.DB.Model(&models.DeliveryOutbox{}).Where("id = ? and status = 0 and next_try_time = ?", deliveryOutbox.ID, deliveryOutbox.NextTryTime).Updates(map[string]interface{}{
+		"next_try_time": now + int64(deliveryClaimLease.Seconds()),
+		"attempts":      gorm.Expr("attempts + 1"),
+	}); result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	attempts := deliveryOutbox.Attempts + 1
+
+	var order models.Order
+	err := db.DB.Preload("Product").Preload("ProductItem").Where("id = ?", deliveryOutbox.OrderID).First(&order).Error
+	if err == nil {
+		if order.Cate == 1 {
+			err = SendDepositCallBack(order.TGChatID, int(order.TGMsgID), order)
+		} else if order.AwaitStock {
+			err = SendPreOrderCallBack(order.TGChatID, int(order.TGMsgID), order, order.Product)
+		} else if order.Product.IsWebhookDelivery() {
+			// 先从发货接口获取内容,失败与发送失败一样重试
+			if err = fetchWebhookContent(&order); err == nil {
+				err = SendOrderCallBack(order.TGChatID, int(order.TGMsgID), order, order.Product, order.ProductItem)
+			}
+		} else {
+			err = SendOrderCallBack(order.TGChatID, int(order.TGMsgID), order, order.Product, order.ProductItem)
+		}
+	}
+
+	if err == nil {
+		db.DB.Model(&models.DeliveryOutbox{}).Where("id = ?", deliveryOutbox.ID).Updates(map[string]interface{}{
+			"status":     1,
+			"sent_time":  time.Now().Unix(),
+			"last_error": "",
+		})
+		db.DB.Model(&models.Order{}).Where("id = ?", deliveryOutbox.OrderID).Update("notify_status", 1)
+		return
+	}
+
+	if attempts < deliveryMaxAttempts {
+		db.DB.Model(&models.DeliveryOutbox{}).Where("id = ?", deliveryOutbox.ID).Updates(map[string]interface{}{
+			"next_try_time": time.Now().Add(deliveryBackoff(attempts)).Unix(),
+			"last_error":    err.Error(),
+		})
+		return
+	}
+
+	// 多次失败,放弃并通知管理员手动处理
+	db.DB.Model(&models.DeliveryOutbox{}).Where("id = ?", deliveryOutbox.ID).Updates(map[string]interface{}{
+		"status":     2,
+		"last_error": err.Error(),
+	})
+	db.DB.Model(&models.Order{}).Where("id = ?", deliveryOutbox.OrderID).Update("notify_status", 2)
+	handle_defender.HandleError(err, fmt.Sprintf("订单发货消息发送失败%d次, 订单ID: %s, 用户: %d", attempts, order.ID, order.TGChatID))
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"gopay/internal/models"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var inputValueMaxLength = 200
+
+// 校验管理员设置的商品输入字段
+func ValidateInputFields(fields models.InputFieldList) error {
+	keys := make(map[string]bool)
+	for _, field := range fields {
+		if field.Key == "" || field.Label == "" {
+			return errors.New("输入字段的key和label不能为空")
+		}
+		if keys[field.Key] {
+			return fmt.Errorf("输入字段key重复: %s", field.Key)
+		}
+		keys[field.Key] = true
+
+		switch field.Type {
+		case models.InputFieldTypeText:
+			if field.Pattern != "" {
+				if _, err := regexp.Compile(field.Pattern); err != nil {
+					return fmt.Errorf("输入字段 %s 的正则错误", field.Key)
+				}
+			}
+		case models.InputFieldTypeNumber:
+			if field.Min != nil && field.Max != nil && field.Min.GreaterThan(*field.Max) {
+				return fmt.Errorf("输入字段 %s 的最小值大于最大值", field.Key)
+			}
+		case models.InputFieldTypeChoice:
+			if len(field.Options) == 0 {
+				return fmt.Errorf("输入字段 %s 没有选项", field.Key)
+			}
+		default:
+			return fmt.Errorf("输入字段 %s 的类型错误", field.Key)
+		}
+	}
+	return nil
+}
+
+// 校验用户填写的单个值,返回整理后的值
+func ParseInputValue(field models.InputField, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errors.New("内容不能为空")
+	}
+	if utf8.RuneCountInString(value) > inputValueMaxLength {
+		return "", newTextError("内容不能超过%d个字符", inputValueMaxLength)
+	}
+
+	switch field.Type {
+	case models.InputFieldTypeText:
+		if field.Pattern != "" {
+			matched, err := regexp.MatchString(field.Pattern, value)
+			if err != nil || !matched {
+				return "", errors.New("格式不正确")
+			}
+		}
+	case models.InputFieldTypeNumber:
+		number, err := decimal.NewFromString(value)
+		if err != nil {
+			return "", errors.New("请输入数字")
+		}
+		if field.Min != nil && number.LessThan(*field.Min) {
+			return "", newTextError("不能小于%s", field.Min)
+		}
+		if field.Max != nil && number.GreaterThan(*field.Max) {
+			return "", newTextError("不能大于%s", field.Max)
+		}
+		value = number.String()
+	case models.InputFieldTypeChoice:
+		found := false
+		for _, option := range field.Options {
+			if option == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", errors.New("请选择给出的选项")
+		}
+	default:
+		return "", errors.New("字段类型错误")
+	}
+	return value, nil
+}
+
+// 下单时校验用户填写的全部字段,必填项缺失返回错误,未定义的字段丢弃
+func checkInputData(fields models.InputFieldList, inputData models.JSONField) (*models.JSONField, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	checkedData := models.JSONField{}
+	for _, field := range fields {
+		rawValue, ok := inputData[field.Key]
+		if !ok || rawValue == nil || fmt.Sprint(rawValue) == "" {
+			if field.Required {
+				return nil, newTextError("请填写%s", field.Label)
+			}
+			continue
+		}
+		value, err := ParseInputValue(field, fmt.Sprint(rawValue))
+		if err != nil {
+			return nil, newTextError("%s%s", field.Label, err)
+		}
+		checkedData[field.Key] = value
+	}
+	return &checkedData, nil
+}
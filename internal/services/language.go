@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gopay/internal/exts/cache"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"time"
+)
+
+// 用户选择的语言缓存时间,修改时同时更新缓存
+var userLanguageDuration = time.Hour
+
+// Telegram客户端语言在收到用户消息时更新,变化时写入用户
+var tgLanguageCodeDuration = time.Hour * 24 * 30
+
+func userLanguageKey(tgChatID int64) string {
+	return fmt.Sprintf("user_language_%d", tgChatID)
+}
+func tgLanguageCodeKey(tgChatID int64) string {
+	return fmt.Sprintf("tg_language_code_%d", tgChatID)
+}
+
+// 记录用户Telegram客户端的语言,用户没有选择语言时使用,用户不存在时自动创建
+func SetTGLanguageCode(tgChatID int64, tgUsername string, languageCode string) {
+	if languageCode == "" {
+		return
+	}
+	if cached, ok := cache.Cache.Get(tgLanguageCodeKey(tgChatID)).(string); ok && cached == languageCode {
+		return
+	}
+
+	if result := db.DB.Model(&models.User{}).Where("tg_chat_id = ?", tgChatID).Update("tg_language_code", languageCode); result.Error != nil {
+		return
+	} else if result.RowsAffected == 0 {
+		user := models.NewUser(tgChatID, tgUsername)
+		user.TGLanguageCode = languageCode
+		if err := db.DB.Create(user).Error; err != nil {
+			return
+		}
+	}
+	cache.Cache.Set(tgLanguageCodeKey(tgChatID), languageCode, tgLanguageCodeDuration)
+}
+
+// 用户的语言,依次为 /language 中选择的语言、Telegram客户端语言、默认语言
+func GetUserLanguage(tgChatID int64) string {
+	language, ok := cache.Cache.Get(userLanguageKey(tgChatID)).(string)
+	languageCode, codeOk := cache.Cache.Get(tgLanguageCodeKey(tgChatID)).(string)
+	if !ok || !codeOk {
+		var user models.User
+		if err := db.DB.Select("language", "tg_language_code").Where("tg_chat_id = ?", tgChatID).Limit(1).Find(&user).Error; err == nil {
+			if !ok {
+				language = user.Language
+				cache.Cache.Set(userLanguageKey(tgChatID), language, userLanguageDuration)
+			}
+			if !codeOk {
+				languageCode = user.TGLanguageCode
+				cache.Cache.Set(tgLanguageCodeKey(tgChatID), languageCode, tgLanguageCodeDuration)
+			}
+		}
+	}
+	if language = config.MatchLanguage(language); language != "" {
+		return language
+	}
+	if language = config.MatchLanguage(languageCode); language != "" {
+		return language
+	}
+	return config.GetDefaultLanguage()
+}
+
+// 设置用户的语言,language为空则跟随Telegram客户端语言,用户不存在时自动创建
+func SetUserLanguage(tgChatID int64, tgUsername string, language string) error {
+	if language != "" && !config.IsLanguageAvailable(language) {
+		return errors.New("语言不存在")
+	}
+
+	var user models.User
+	if result := db.DB.Where("tg_chat_id = ?", tgChatID).Find(&user); result.Error != nil {
+		return errors.New("获取用户错误")
+	} else if result.RowsAffected == 0 {
+		user = *models.NewUser(tgChatID, tgUsername)
+		user.Language = language
+		if err := db.DB.Create(&user).Error; err != nil {
+			return errors.New("创建用户失败")
+		}
+	} else if err := db.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("language", language).Error; err != nil {
+		return errors.New("设置语言失败")
+	}
+
+	cache.Cache.Set(userLanguageKey(tgChatID), language, userLanguageDuration)
+	return nil
+}
+
+// 带参数的错误,按用户的语言显示,翻译文件以格式化前的原文为键
+type TextError struct {
+	format string
+	args   []interface{}
+}
+
+func newTextError(format string, args ...interface{}) *TextError {
+	return &TextError{format: format, args: args}
+}
+
+func (e *TextError) Error() string {
+	return fmt.Sprintf(e.format, e.args...)
+}
+
+// 按用户的语言显示,参数中的错误同样翻译
+func (e *TextError) Text(language string) string {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg
+		if err, ok := arg.(error); ok {
+			args[i] = ErrorText(language, err)
+		}
+	}
+	return config.Tf(language, e.format, args...)
+}
+
+// 错误按用户的语言显示,带参数的错误翻译后再格式化,没有翻译时显示原文
+func ErrorText(language string, err error) string {
+	var textErr interface{ Text(language string) string }
+	if errors.As(err, &textErr) {
+		return textErr.Text(language)
+	}
+	return config.T(language, err.Error())
+}
@@ -6,6 +6,7 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
+	"gopay/internal/exts/blob_store"
 	"gopay/internal/exts/config"
 	"gopay/internal/exts/db"
 	"gopay/internal/exts/tg_bot"
@@ -13,98 +14,343 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"time"
+	"unicode/utf8"
 )
 
-func CreateOrder(targetCurrency config.Currency, targetNetwork string, product models.Product, tgChatID int64, tgUsername string) (*models.Order, error) {
-	// 基础金额,需换算
-	baseCurrency := product.Currency
-	baseCurrencyPrice := product.Price
-
+// 将基础货币价格换算为支付货币价格
+func quoteOrderPrice(baseCurrency string, baseCurrencyPrice decimal.Decimal, targetCurrency config.Currency) (decimal.Decimal, error) {
 	targetPrice, err := config.ConvertCurrencyPrice(baseCurrencyPrice, config.Currency(baseCurrency), targetCurrency)
 	if err != nil {
-		return nil, errors.New("获取汇率失败")
+		return decimal.Zero, errors.New("获取汇率失败")
 	}
 
 	// 精度截断，当精度大于小数尾数步长，则截断，否则保留精度
 	targetPrice = targetPrice.Round(-config.DecimalWalletUnitMap[targetCurrency].Exponent())
+	return targetPrice, nil
+}
 
-	// 使用tx.begin应该慎重，需要显式commit或rollback，不然会导致会话过多塞满数据库
-	tx := db.DB.Begin()
-	defer tx.Rollback()
-
-	// 获取空闲钱包,分为1.任意金额钱包 2.小数点尾数钱包,
-	// 任意金额钱包要锁,绑定订单后状态会从1变成0
-	// 并获取最后的订单价格
+// 获取空闲钱包,分为1.任意金额钱包 2.小数点尾数钱包,
+// 任意金额钱包要锁,绑定订单后状态会从1变成0
+// 并获取最后的订单价格
+func reserveWallet(tx *gorm.DB, targetCurrency config.Currency, targetNetwork string, targetPrice decimal.Decimal) (*models.Wallet, *decimal.Decimal, *string, error) {
 	var orderFinalPrice *decimal.Decimal
 	var priceIDForLock *string
 
 	var freeWallet *models.Wallet
+	var err error
 	walletType := config.SiteConfig.WalletType
 	if walletType == 1 {
 		orderFinalPrice = &targetPrice
 		// 获取钱包并上锁，因为这个钱包状态需要更改的
 		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("status=? and network=?", 1, targetNetwork).Order(GetWalletOrder()).Find(&freeWallet); result.Error != nil {
-			return nil, errors.New("获取钱包出错")
+			return nil, nil, nil, errors.New("获取钱包出错")
 		} else if result.RowsAffected == 0 {
-			return nil, errors.New("无空闲钱包1")
+			return nil, nil, nil, errors.New("无空闲钱包1")
 		}
 		// 修改钱包状态为锁定
 		if result := tx.Model(&models.Wallet{}).Where("id=?", freeWallet.ID).Update("status", 0); result.Error != nil {
-			return nil, err
+			return nil, nil, nil, result.Error
 		} else if result.RowsAffected == 0 {
-			return nil, errors.New("钱包状态出错")
+			return nil, nil, nil, errors.New("钱包状态出错")
 		}
 
 	} else if walletType == 2 {
 		freeWallet, err = GetFreeDecimalWallet(targetNetwork, targetCurrency, targetPrice)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		// 获取最终的订单价格
 		orderFinalPrice, err = GetFreeDecimalWalletPrice(targetNetwork, targetCurrency, freeWallet.ID, targetPrice)
 		if err != nil {
-			return nil, errors.New("获取最终订单价格失败: " + err.Error())
+			return nil, nil, nil, errors.New("获取最终订单价格失败: " + err.Error())
 		}
 		// 无法从函数获得指针，需要变量中转
 		temp := fmt.Sprintf("%s-%s-%s-%s", freeWallet.Address, targetNetwork, targetCurrency, orderFinalPrice)
 		priceIDForLock = &temp
 
 	} else {
-		return nil, errors.New("钱包类型设置错误")
+		return nil, nil, nil, errors.New("钱包类型设置错误")
+	}
+
+	return freeWallet, orderFinalPrice, priceIDForLock, nil
+}
+
+// 待支付订单达到上限则不能再创建,先锁定用户,避免同一用户并发下单超出上限
+func checkPendingOrderLimit(tx *gorm.DB, tgChatID int64, tgUsername string) error {
+	if _, err := lockUser(tx, tgChatID, tgUsername); err != nil {
+		return err
+	}
+	var count int64
+	if err := tx.Model(&models.Order{}).Where("status = 0 and tg_chat_id = ?", tgChatID).Count(&count).Error; err != nil {
+		return errors.New("查询待支付订单失败")
+	}
+	maxPendingOrders := config.GetMaxPendingOrders()
+	if count >= int64(maxPendingOrders) {
+		return newTextError("待支付订单已达上限(%d个),请先支付或在 /orders 中取消", maxPendingOrders)
 	}
+	return nil
+}
 
-	// 商品库存,获取一个空闲商品项目,并锁定
+// 有特价限量或限购时锁定商品,同一商品的订单依次创建,避免并发下单超出数量
+func lockOrderProduct(tx *gorm.DB, product models.Product) error {
+	if product.SaleLimit == 0 && product.UserPurchaseLimit == 0 && product.DailyPurchaseLimit == 0 {
+		return nil
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", product.ID).Find(&models.Product{}).Error; err != nil {
+		return errors.New("获取商品失败")
+	}
+	return nil
+}
+
+// 获取并锁定一个空闲商品项目,调用发货接口的商品不需要商品项目,开启预订的商品无库存时返回预订
+func lockFreeProductItem(tx *gorm.DB, product models.Product, variant *models.ProductVariant) (*models.ProductItem, bool, error) {
+	if product.IsWebhookDelivery() {
+		return nil, false, nil
+	}
 	var productItem models.ProductItem
-	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id=? and status=1", product.ID).Find(&productItem); result.Error != nil {
-		return nil, err
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id=? and status=1", product.ID)
+	if variant != nil {
+		query = query.Where("variant_id = ?", variant.ID)
+	}
+	result := query.Find(&productItem)
+	if result.Error != nil {
+		return nil, false, errors.New("获取商品项目失败")
 	} else if result.RowsAffected == 0 {
-		return nil, errors.New("商品无库存")
+		if !product.EnablePreOrder {
+			return nil, false, errors.New("商品无库存")
+		}
+		return nil, true, nil
+	}
+	return &productItem, false, nil
+}
+
+func setOrderVariant(order *models.Order, variant *models.ProductVariant) {
+	if variant != nil {
+		order.VariantID = &variant.ID
+		order.VariantName = variant.Name
+	}
+}
+
+// variantID为选择的商品规格,商品没有规格时传nil;inputData为用户填写的商品输入字段,商品没有输入字段时传nil
+func CreateOrder(targetCurrency config.Currency, targetNetwork string, product models.Product, variantID *uuid.UUID, tgChatID int64, tgUsername string, inputData models.JSONField) (*models.Order, error) {
+	checkedInputData, err := checkInputData(product.InputFields, inputData)
+	if err != nil {
+		return nil, err
+	}
+	variant, err := getOrderVariant(product.ID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用tx.begin应该慎重，需要显式commit或rollback，不然会导致会话过多塞满数据库
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	if err := lockOrderProduct(tx, product); err != nil {
+		return nil, err
+	}
+	if err := checkPurchaseLimit(tx, product, tgChatID); err != nil {
+		return nil, err
+	}
+
+	// 基础金额,需换算,限时特价期间使用特价
+	baseCurrency := product.Currency
+	baseCurrencyPrice, onSale, err := getOrderBasePrice(tx, product, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	targetPrice, err := quoteOrderPrice(baseCurrency, baseCurrencyPrice, targetCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPendingOrderLimit(tx, tgChatID, tgUsername); err != nil {
+		return nil, err
+	}
+
+	freeWallet, orderFinalPrice, priceIDForLock, err := reserveWallet(tx, targetCurrency, targetNetwork, targetPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	// 商品库存,获取一个空闲商品项目,并锁定,开启预订的商品无库存时也可以下单
+	productItem, isPreOrder, err := lockFreeProductItem(tx, product, variant)
+	if err != nil {
+		return nil, err
 	}
 
 	end_time := time.Now().Unix() + int64(config.SiteConfig.OrderExpireDuration.Seconds())
 
 	// 创建订单
-	order := models.NewOrder(end_time, string(targetCurrency), targetNetwork, *orderFinalPrice, priceIDForLock, baseCurrency, baseCurrencyPrice, freeWallet.ID, freeWallet.Address, walletType, product.ID, tgChatID, tgUsername)
-	tx.Create(order)
+	order := models.NewOrder(0, end_time, string(targetCurrency), targetNetwork, *orderFinalPrice, priceIDForLock, baseCurrency, baseCurrencyPrice, &freeWallet.ID, freeWallet.Address, config.SiteConfig.WalletType, &product.ID, tgChatID, tgUsername)
+	order.InputData = checkedInputData
+	order.OnSale = onSale
+	setOrderVariant(order, variant)
+	if err := tx.Create(order).Error; err != nil {
+		return nil, errors.New("创建订单失败")
+	}
+	eventMessage := "创建订单"
+	if isPreOrder {
+		eventMessage = "创建预订订单"
+	}
+	if err := AddOrderEvent(tx, order.ID, nil, order.Status, models.OrderEventActorBuyer, nil, eventMessage); err != nil {
+		return nil, err
+	}
 
 	// 更新项目为待支付,设置解锁时间,并绑定到订单上,要在订单创建的事务之后
-	if result := tx.Model(&models.ProductItem{}).Where("id=?", productItem.ID).Updates(map[string]interface{}{
-		"status":        0,
-		"order_id":      order.ID,
+	if productItem != nil {
+		if result := tx.Model(&models.ProductItem{}).Where("id=?", productItem.ID).Updates(map[string]interface{}{
+			"status":        0,
+			"order_id":      order.ID,
+			"end_lock_time": end_time,
+		}); result.Error != nil {
+			return nil, errors.New("商品项目更新失败")
+		} else if result.RowsAffected == 0 {
+			return nil, errors.New("商品项目更新失败")
+		}
+	}
+
+	// 设置钱包解锁时间
+	if result := tx.Model(&models.Wallet{}).Where("id=?", freeWallet.ID).Updates(map[string]interface{}{
 		"end_lock_time": end_time,
 	}); result.Error != nil {
 		return nil, err
-	} else if result.RowsAffected == 0 {
-		return nil, errors.New("商品项目更新失败")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.New("提交失败, " + err.Error())
+	}
+
+	UpdateProductInStockCount([]uuid.UUID{product.ID})
+	return order, nil
+}
+
+// 创建余额充值订单,amount单位为config.BalanceCurrency,完成后已付金额换算入账
+func CreateDepositOrder(targetCurrency config.Currency, targetNetwork string, amount decimal.Decimal, tgChatID int64, tgUsername string) (*models.Order, error) {
+	baseCurrency := string(config.BalanceCurrency)
+
+	targetPrice, err := quoteOrderPrice(baseCurrency, amount, targetCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	if err := checkPendingOrderLimit(tx, tgChatID, tgUsername); err != nil {
+		return nil, err
+	}
+
+	freeWallet, orderFinalPrice, priceIDForLock, err := reserveWallet(tx, targetCurrency, targetNetwork, targetPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	end_time := time.Now().Unix() + int64(config.SiteConfig.OrderExpireDuration.Seconds())
+
+	order := models.NewOrder(1, end_time, string(targetCurrency), targetNetwork, *orderFinalPrice, priceIDForLock, baseCurrency, amount, &freeWallet.ID, freeWallet.Address, config.SiteConfig.WalletType, nil, tgChatID, tgUsername)
+	if err := tx.Create(order).Error; err != nil {
+		return nil, errors.New("创建订单失败")
+	}
+	if err := AddOrderEvent(tx, order.ID, nil, order.Status, models.OrderEventActorBuyer, nil, "创建充值订单"); err != nil {
+		return nil, err
 	}
 
 	// 设置钱包解锁时间
 	if result := tx.Model(&models.Wallet{}).Where("id=?", freeWallet.ID).Updates(map[string]interface{}{
 		"end_lock_time": end_time,
 	}); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.New("提交失败, " + err.Error())
+	}
+	return order, nil
+}
+
+// 使用余额直接购买商品,扣款、出库、订单完成在同一个事务中
+func CreateBalanceOrder(product models.Product, variantID *uuid.UUID, tgChatID int64, tgUsername string, inputData models.JSONField) (*models.Order, error) {
+	checkedInputData, err := checkInputData(product.InputFields, inputData)
+	if err != nil {
+		return nil, err
+	}
+	variant, err := getOrderVariant(product.ID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	if err := lockOrderProduct(tx, product); err != nil {
+		return nil, err
+	}
+	if err := checkPurchaseLimit(tx, product, tgChatID); err != nil {
+		return nil, err
+	}
+
+	baseCurrency := product.Currency
+	baseCurrencyPrice, onSale, err := getOrderBasePrice(tx, product, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	price, err := config.ConvertCurrencyPrice(baseCurrencyPrice, config.Currency(baseCurrency), config.BalanceCurrency)
+	if err != nil {
+		return nil, errors.New("获取汇率失败")
+	}
+	price = price.RoundCeil(2)
+
+	// 商品库存,获取一个空闲商品项目,并锁定,开启预订的商品无库存时付款后等待补货
+	productItem, isPreOrder, err := lockFreeProductItem(tx, product, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	order := models.NewOrder(0, now, string(config.BalanceCurrency), config.BalancePaymentMethod, price, nil, baseCurrency, baseCurrencyPrice, nil, "", 0, &product.ID, tgChatID, tgUsername)
+	order.Status = 1
+	order.PaidPrice = price
+	order.AwaitStock = isPreOrder
+	order.InputData = checkedInputData
+	order.OnSale = onSale
+	setOrderVariant(order, variant)
+	if err := tx.Create(order).Error; err != nil {
+		return nil, errors.New("创建订单失败")
+	}
+
+	eventMessage := "余额支付"
+	if isPreOrder {
+		eventMessage = "余额支付预订订单,等待补货"
+	}
+	if err := AddOrderEvent(tx, order.ID, nil, order.Status, models.OrderEventActorBuyer, nil, eventMessage); err != nil {
+		return nil, err
+	}
+	if err := AddDeliveryOutbox(tx, order.ID); err != nil {
 		return nil, err
 	}
 
+	balanceRemark := "购买 " + product.Name
+	if order.VariantName != "" {
+		balanceRemark += " " + order.VariantName
+	}
+	if _, err := ChangeUserBalance(tx, tgChatID, tgUsername, price.Neg(), 4, &order.ID, balanceRemark); err != nil {
+		return nil, err
+	}
+
+	if productItem != nil {
+		if result := tx.Model(&models.ProductItem{}).Where("id=?", productItem.ID).Updates(map[string]interface{}{
+			"status":   -1,
+			"order_id": order.ID,
+		}); result.Error != nil {
+			return nil, result.Error
+		} else if result.RowsAffected == 0 {
+			return nil, errors.New("商品项目更新失败")
+		}
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return nil, errors.New("提交失败, " + err.Error())
 	}
@@ -113,56 +359,192 @@ func CreateOrder(targetCurrency config.Currency, targetNetwork string, product m
 	return order, nil
 }
 
-func ClearExpireOrder() error {
+// 待支付订单更换支付方式,保留已锁定的商品项目,按新货币重新报价,并在同一事务中转移钱包或小数点尾数的占用
+func SwitchOrderPayment(orderID uuid.UUID, tgChatID int64, targetCurrency config.Currency, targetNetwork string) (*models.Order, error) {
+	tx := db.DB.Begin()
+	defer tx.Rollback()
 
-	// 设置订单过期
-	if result := db.DB.Model(&models.Order{}).Where("status = 0 and end_time < ?", time.Now().Unix()).Updates(map[string]interface{}{
+	var order models.Order
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? and tg_chat_id = ?", orderID, tgChatID).Find(&order); result.Error != nil {
+		return nil, errors.New("获取订单错误")
+	} else if result.RowsAffected == 0 {
+		return nil, errors.New("没有该订单")
+	}
+	if order.Status != 0 {
+		return nil, errors.New("订单不是待支付状态")
+	}
+	if order.PaidPrice.GreaterThan(decimal.Zero) {
+		return nil, errors.New("订单已部分付款,不能更换支付方式")
+	}
+	if order.Currency == string(targetCurrency) && order.Network == targetNetwork {
+		return nil, errors.New("与当前支付方式相同")
+	}
+
+	targetPrice, err := quoteOrderPrice(order.BaseCurrency, order.BaseCurrencyPrice, targetCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先解锁原来的任意金额钱包,同一主网时可以继续使用该钱包,小数点尾数的占用随订单价格锁一起替换
+	if order.WalletType == 1 && order.WalletID != nil {
+		if result := tx.Model(&models.Wallet{}).Where("id = ? and status = 0", order.WalletID).Updates(map[string]interface{}{
+			"status": 1,
+		}); result.Error != nil {
+			return nil, errors.New("解锁钱包失败")
+		}
+	}
+
+	freeWallet, orderFinalPrice, priceIDForLock, err := reserveWallet(tx, targetCurrency, targetNetwork, targetPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	oldPaymentMethod := fmt.Sprintf("%s-%s", order.Currency, order.Network)
+	order.Currency = string(targetCurrency)
+	order.Network = targetNetwork
+	order.Price = *orderFinalPrice
+	order.PriceIDForLock = priceIDForLock
+	order.WalletID = &freeWallet.ID
+	order.WalletAddress = freeWallet.Address
+	order.WalletType = config.SiteConfig.WalletType
+	if result := tx.Model(&models.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"currency":          order.Currency,
+		"network":           order.Network,
+		"price":             order.Price,
+		"price_id_for_lock": order.PriceIDForLock,
+		"wallet_id":         order.WalletID,
+		"wallet_address":    order.WalletAddress,
+		"wallet_type":       order.WalletType,
+	}); result.Error != nil {
+		return nil, errors.New("更新订单失败")
+	}
+
+	// 结束时间不变,设置新钱包解锁时间
+	if result := tx.Model(&models.Wallet{}).Where("id=?", freeWallet.ID).Updates(map[string]interface{}{
+		"end_lock_time": order.EndTime,
+	}); result.Error != nil {
+		return nil, result.Error
+	}
+
+	message := fmt.Sprintf("更换支付方式 %s -> %s-%s", oldPaymentMethod, order.Currency, order.Network)
+	if err := AddOrderEvent(tx, order.ID, &order.Status, order.Status, models.OrderEventActorBuyer, nil, message); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.New("提交失败, " + err.Error())
+	}
+	return &order, nil
+}
+
+// 设置订单过期,返回本次过期的订单用于通知用户
+func ClearExpireOrder() ([]models.Order, error) {
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	// 锁定订单,防止查询后被支付
+	var expiredOrders []models.Order
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("status = 0 and end_time < ?", time.Now().Unix()).Find(&expiredOrders); result.Error != nil {
+		return nil, errors.New("查询过期订单失败")
+	}
+	if len(expiredOrders) == 0 {
+		return nil, nil
+	}
+	var expiredOrderIDs []uuid.UUID
+	for _, expiredOrder := range expiredOrders {
+		expiredOrderIDs = append(expiredOrderIDs, expiredOrder.ID)
+	}
+
+	// 设置订单过期,再次判断状态
+	if result := tx.Model(&models.Order{}).Where("status = 0 and id in ?", expiredOrderIDs).Updates(map[string]interface{}{
 		"status":            -1,
 		"end_time":          time.Now().Unix(),
 		"price_id_for_lock": gorm.Expr("NULL"),
 	}); result.Error != nil {
-		return errors.New("设置订单过期失败")
+		return nil, errors.New("设置订单过期失败")
+	}
+	if err := AddOrderEvents(tx, expiredOrders, -1, models.OrderEventActorScheduler, "订单超时"); err != nil {
+		return nil, err
 	}
 
-	return nil
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.New("设置订单过期提交失败, " + err.Error())
+	}
+
+	var resultOrders []models.Order
+	if result := db.DB.Preload("Product").Where("status = -1 and id in ?", expiredOrderIDs).Find(&resultOrders); result.Error != nil {
+		return nil, errors.New("查询过期订单失败")
+	}
+
+	return resultOrders, nil
+}
+
+// 获取即将过期需要提醒的订单
+func GetOrdersToRemind() ([]models.Order, error) {
+	remindBefore := config.GetSiteConfig().OrderRemindBeforeExpire
+	if remindBefore <= 0 {
+		return nil, nil
+	}
+
+	var orders []models.Order
+	now := time.Now().Unix()
+	if result := db.DB.Where("status = 0 and remind_time = 0 and end_time > ? and end_time < ?", now, now+int64(remindBefore.Seconds())).Find(&orders); result.Error != nil {
+		return nil, errors.New("查询待提醒订单失败")
+	}
+	return orders, nil
+}
+func SetOrderReminded(orderID uuid.UUID) {
+	db.DB.Model(&models.Order{}).Where("id = ?", orderID).Update("remind_time", time.Now().Unix())
 }
 
-// 强行关闭订单
-func ReleaseOrders(toReleaseOrderIDsInput []uuid.UUID) error {
+// 强行关闭订单,actor为操作者,admin或buyer
+func ReleaseOrders(toReleaseOrderIDsInput []uuid.UUID, actor string) error {
+	_, err := releaseOrders(toReleaseOrderIDsInput, actor)
+	return err
+}
+
+// 关闭订单并返回实际关闭的数量,已不是待支付状态的订单跳过
+func releaseOrders(toReleaseOrderIDsInput []uuid.UUID, actor string) (int, error) {
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
 	// 如果不判斷訂單已過期會導致後面的解鎖項目出問題，商品項目售出會解鎖重新出售，錢包會無故解鎖
 	var toReleaseOrders []models.Order
-	if result := db.DB.Where("status = 0 and id in ?", toReleaseOrderIDsInput).Find(&toReleaseOrders); result.Error != nil {
-		return errors.New("查询订单失败")
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("status = 0 and id in ?", toReleaseOrderIDsInput).Find(&toReleaseOrders); result.Error != nil {
+		return 0, errors.New("查询订单失败")
 	}
 	var toReleaseOrderIDs []uuid.UUID
 	for _, toReleaseOrders := range toReleaseOrders {
 		toReleaseOrderIDs = append(toReleaseOrderIDs, toReleaseOrders.ID)
 	}
 	if len(toReleaseOrderIDs) == 0 {
-		return nil
+		return 0, nil
 	}
 
-	tx := db.DB.Begin()
-	defer tx.Rollback()
 	// 设置订单失效
-	if result := db.DB.Model(&models.Order{}).Where("id in ?", toReleaseOrderIDs).Updates(map[string]interface{}{
+	if result := tx.Model(&models.Order{}).Where("id in ?", toReleaseOrderIDs).Updates(map[string]interface{}{
 		"status":            -2,
 		"end_time":          time.Now().Unix(),
 		"price_id_for_lock": gorm.Expr("NULL"),
 	}); result.Error != nil {
-		return errors.New("设置订单关闭失败")
+		return 0, errors.New("设置订单关闭失败")
+	}
+	if err := AddOrderEvents(tx, toReleaseOrders, -2, actor, "关闭订单"); err != nil {
+		return 0, err
 	}
 
 	// 解锁钱包,只需更新status为0的钱包
 	var toReleaseWalletIDs []uuid.UUID
 	for _, toReleaseOrder := range toReleaseOrders {
-		toReleaseWalletIDs = append(toReleaseWalletIDs, toReleaseOrder.WalletID)
+		if toReleaseOrder.WalletID != nil {
+			toReleaseWalletIDs = append(toReleaseWalletIDs, *toReleaseOrder.WalletID)
+		}
 	}
 
 	if result := tx.Model(&models.Wallet{}).Where("status = 0 and id in ?", toReleaseWalletIDs).Updates(map[string]interface{}{
 		"status": 1,
 	}); result.Error != nil {
-		return errors.New("解锁钱包失败")
+		return 0, errors.New("解锁钱包失败")
 	}
 
 	// 解锁商品项目,取消绑定订单
@@ -171,16 +553,18 @@ func ReleaseOrders(toReleaseOrderIDsInput []uuid.UUID) error {
 		"order_id":      gorm.Expr("NULL"),
 		"end_lock_time": gorm.Expr("NULL"),
 	}); result.Error != nil {
-		return errors.New("解锁商品项目失败")
+		return 0, errors.New("解锁商品项目失败")
 	}
 	if err := tx.Commit().Error; err != nil {
-		return errors.New("清理过期订单提交失败, " + err.Error())
+		return 0, errors.New("清理过期订单提交失败, " + err.Error())
 	}
 
 	// 更新商品库存
 	var productIDs []uuid.UUID
 	for _, expiredOrder := range toReleaseOrders {
-		productIDs = append(productIDs, expiredOrder.ProductID)
+		if expiredOrder.ProductID != nil {
+			productIDs = append(productIDs, *expiredOrder.ProductID)
+		}
 	}
 	UpdateProductInStockCount(productIDs)
 
@@ -193,7 +577,7 @@ func ReleaseOrders(toReleaseOrderIDsInput []uuid.UUID) error {
 		tg_bot.Bot.Request(deleteConfig)
 	}
 
-	return nil
+	return len(toReleaseOrderIDs), nil
 }
 
 func OrderPaidPrice(order models.Order, options ...interface{}) decimal.Decimal {
@@ -216,15 +600,9 @@ func OrderPaidPrice(order models.Order, options ...interface{}) decimal.Decimal
 	return result
 }
 
+// 订单完成后立即发货,发送失败的由定时任务按发货消息重试
 func OrderCallbackMultiple(successOrderIDs []uuid.UUID) error {
-	var successOrders []models.Order
-	db.DB.Preload("Product").Preload("ProductItem").Where("id in ?", successOrderIDs).Find(&successOrders)
-	for _, successOrder := range successOrders {
-		// 发消息
-		SendOrderCallBack(successOrder.TGChatID, int(successOrder.TGMsgID), successOrder, successOrder.Product, successOrder.ProductItem)
-	}
-
-	return nil
+	return DeliverOrders(successOrderIDs)
 }
 func SetOrderTGMsgID(orderID uuid.UUID, tgMsgID int64) {
 	db.DB.Model(&models.Order{}).Where("id = ?", orderID).Update("tg_msg_id", tgMsgID)
@@ -234,14 +612,15 @@ func GetOrderIncomeByTimestampRange(startTimestamp int64, endTimestamp int64) (d
 	var orders []models.Order
 	filterParams := make(map[string]interface{})
 	filterParams["timestamp_range"] = fmt.Sprintf("%d,%d", startTimestamp, endTimestamp)
-	query := models.ApplyFilters(db.DB, filterParams).Where("status=1")
+	// 余额支付的订单在充值时已经计入收入,部分退款的订单扣除已退金额
+	query := models.ApplyFilters(db.DB, filterParams).Where("status in (1,3) and network <> ?", config.BalancePaymentMethod)
 	if result := query.Find(&orders); result.Error != nil {
 		return decimal.Decimal{}, errors.New("获取订单错误")
 	}
 
 	orderPriceSum := decimal.Zero
 	for _, order := range orders {
-		convertedPrice, err := config.ConvertCurrencyPrice(order.Price, config.Currency(order.Currency), config.CNY)
+		convertedPrice, err := config.ConvertCurrencyPrice(order.Price.Sub(order.RefundedPrice), config.Currency(order.Currency), config.CNY)
 		if err != nil {
 			return decimal.Decimal{}, errors.New("获取汇率失败")
 		}
@@ -252,32 +631,141 @@ func GetOrderIncomeByTimestampRange(startTimestamp int64, endTimestamp int64) (d
 }
 func GetPaidOrdersByCustomer(tgChatID int64) ([]models.Order, error) {
 	var orders []models.Order
-	if result := db.DB.Preload("Product").Preload("ProductItem").Where("status = 1 and tg_chat_id = ?", tgChatID).Order("create_time desc").Limit(10).Find(&orders); result.Error != nil {
+	if result := db.DB.Preload("Product").Preload("ProductItem").Where("status in (1,3) and cate = 0 and tg_chat_id = ?", tgChatID).Order("create_time desc").Limit(10).Find(&orders); result.Error != nil {
 		return orders, errors.New("获取订单错误")
 	}
 
 	return orders, nil
 }
-func GetPaidOrderByCustomerByID(orderID uuid.UUID) (models.Order, error) {
+func GetPendingOrdersByCustomer(tgChatID int64) ([]models.Order, error) {
+	var orders []models.Order
+	if result := db.DB.Preload("Product").Where("status = 0 and tg_chat_id = ?", tgChatID).Order("create_time desc").Find(&orders); result.Error != nil {
+		return orders, errors.New("获取订单错误")
+	}
+
+	return orders, nil
+}
+
+func GetPendingOrderByCustomerByID(orderID uuid.UUID, tgChatID int64) (models.Order, error) {
+	var order models.Order
+	if result := db.DB.Where("id = ? and tg_chat_id = ? and status = 0", orderID, tgChatID).Find(&order); result.Error != nil {
+		return order, errors.New("获取订单错误")
+	} else if result.RowsAffected == 0 {
+		return order, errors.New("订单不是待支付状态")
+	}
+	return order, nil
+}
+
+// 用户取消自己的待支付订单
+func CancelOrderByCustomer(orderID uuid.UUID, tgChatID int64) error {
+	var order models.Order
+	if result := db.DB.Where("id = ? and tg_chat_id = ?", orderID, tgChatID).Find(&order); result.Error != nil {
+		return errors.New("获取订单错误")
+	} else if result.RowsAffected == 0 {
+		return errors.New("没有该订单")
+	}
+	if order.Status != 0 {
+		return errors.New("订单不是待支付状态")
+	}
+	// 查询后订单可能已付款或超时,以实际关闭的数量为准
+	if count, err := releaseOrders([]uuid.UUID{order.ID}, models.OrderEventActorBuyer); err != nil {
+		return err
+	} else if count == 0 {
+		return errors.New("订单不是待支付状态")
+	}
+	return nil
+}
+
+// 用户自己的已支付或部分退款订单,全部退款的订单不再显示发货内容
+func GetPaidOrderByCustomerByID(orderID uuid.UUID, tgChatID int64) (models.Order, error) {
 	var orders models.Order
-	if result := db.DB.Preload("Product").Preload("ProductItem").Where("id = ?", orderID).Find(&orders); result.Error != nil {
+	if result := db.DB.Preload("Product").Preload("ProductItem").Where("id = ? and status in (1,3) and cate = 0 and tg_chat_id = ?", orderID, tgChatID).Find(&orders); result.Error != nil {
 		return orders, errors.New("获取订单错误")
 	} else if result.RowsAffected == 0 {
 		return orders, errors.New("没有该订单")
 	}
 	return orders, nil
 }
-func SendOrderCallBack(chatID int64, toDeleteMsgID int, order models.Order, product models.Product, productItem models.ProductItem) {
-	msgText := config.OrderCallbackMsg(map[string]interface{}{
+func SendOrderCallBack(chatID int64, toDeleteMsgID int, order models.Order, product models.Product, productItem models.ProductItem) error {
+	// 发货接口生成的内容没有商品项目,按商品项目内容展示,兼容已有模板
+	if productItem.ID == uuid.Nil && order.DeliveryContent != "" {
+		productItem.Content = order.DeliveryContent
+	}
+	language := GetUserLanguage(chatID)
+	TranslateProduct(language, &product)
+	msgText := config.OrderCallbackMsg(language, map[string]interface{}{
 		"Order":       order,
 		"Product":     product,
 		"ProductItem": productItem,
+		"Inputs":      order.InputEntries(product.InputFields),
 	})
 	//newMsg := tgbotapi.NewEditMessageText(chatID, msgID, msgText)
+	if productItem.IsFile() {
+		if err := sendProductItemFile(chatID, productItem, msgText); err != nil {
+			return err
+		}
+	} else {
+		msg := tgbotapi.NewMessage(chatID, msgText)
+		if _, err := tg_bot.Bot.Send(msg); err != nil {
+			return err
+		}
+	}
+
+	if toDeleteMsgID != 0 {
+		tg_bot.DeleteMsg(chatID, toDeleteMsgID)
+	}
+	return nil
+}
+
+// 文件商品项目以文件发送,发货消息作为文件说明,超过说明长度上限时先单独发送消息
+func sendProductItemFile(chatID int64, productItem models.ProductItem, msgText string) error {
+	fileData, err := blob_store.Store.Get(productItem.FileKey)
+	if err != nil {
+		return errors.New("读取商品文件失败")
+	}
+	document := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: productItem.Content, Bytes: fileData})
+	if utf8.RuneCountInString(msgText) <= documentCaptionMaxLength {
+		document.Caption = msgText
+	} else if _, err := tg_bot.Bot.Send(tgbotapi.NewMessage(chatID, msgText)); err != nil {
+		return err
+	}
+	if _, err := tg_bot.Bot.Send(document); err != nil {
+		return err
+	}
+	return nil
+}
+func SendPreOrderCallBack(chatID int64, toDeleteMsgID int, order models.Order, product models.Product) error {
+	language := GetUserLanguage(chatID)
+	TranslateProduct(language, &product)
+	msgText := config.PreOrderCallbackMsg(language, map[string]interface{}{
+		"Order":   order,
+		"Product": product,
+		"Inputs":  order.InputEntries(product.InputFields),
+	})
 	msg := tgbotapi.NewMessage(chatID, msgText)
-	tg_bot.Bot.Send(msg)
+	if _, err := tg_bot.Bot.Send(msg); err != nil {
+		return err
+	}
 
 	if toDeleteMsgID != 0 {
 		tg_bot.DeleteMsg(chatID, toDeleteMsgID)
 	}
+	return nil
+}
+func SendDepositCallBack(chatID int64, toDeleteMsgID int, order models.Order) error {
+	user, _ := GetUserByTGChatID(chatID)
+	msgText := config.DepositCallbackMsg(GetUserLanguage(chatID), map[string]interface{}{
+		"Order":           order,
+		"User":            user,
+		"BalanceCurrency": config.BalanceCurrency,
+	})
+	msg := tgbotapi.NewMessage(chatID, msgText)
+	if _, err := tg_bot.Bot.Send(msg); err != nil {
+		return err
+	}
+
+	if toDeleteMsgID != 0 {
+		tg_bot.DeleteMsg(chatID, toDeleteMsgID)
+	}
+	return nil
 }
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gorm.io/gorm"
+)
+
+// 记录订单状态变更,应在变更订单状态的事务中调用,oldStatus为空表示创建订单
+func AddOrderEvent(tx *gorm.DB, orderID uuid.UUID, oldStatus *int, newStatus int, actor string, transferID *uuid.UUID, message string) error {
+	orderEvent := models.NewOrderEvent(orderID, oldStatus, newStatus, actor, transferID, message)
+	if err := tx.Create(orderEvent).Error; err != nil {
+		return errors.New("记录订单事件失败")
+	}
+	return nil
+}
+
+// 批量记录订单状态变更,用于批量过期或关闭
+func AddOrderEvents(tx *gorm.DB, orders []models.Order, newStatus int, actor string, message string) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	var orderEvents []models.OrderEvent
+	for _, order := range orders {
+		oldStatus := order.Status
+		orderEvents = append(orderEvents, *models.NewOrderEvent(order.ID, &oldStatus, newStatus, actor, nil, message))
+	}
+	if err := tx.Create(&orderEvents).Error; err != nil {
+		return errors.New("记录订单事件失败")
+	}
+	return nil
+}
+
+// 获取订单详情,包括交易记录和状态变更记录
+func GetOrderDetail(orderID uuid.UUID) (models.Order, []models.Transfer, []models.OrderEvent, error) {
+	var order models.Order
+	if result := db.DB.Where("id = ?", orderID).Find(&order); result.Error != nil {
+		return order, nil, nil, errors.New("获取订单错误")
+	} else if result.RowsAffected == 0 {
+		return order, nil, nil, errors.New("没有该订单")
+	}
+
+	var transfers []models.Transfer
+	if result := db.DB.Where("order_id = ?", orderID).Order((&models.Transfer{}).DefaultOrder()).Find(&transfers); result.Error != nil {
+		return order, nil, nil, errors.New("获取交易错误")
+	}
+
+	var orderEvents []models.OrderEvent
+	if result := db.DB.Where("order_id = ?", orderID).Order((&models.OrderEvent{}).DefaultOrder()).Find(&orderEvents); result.Error != nil {
+		return order, nil, nil, errors.New("获取订单事件错误")
+	}
+	return order, transfers, orderEvents, nil
+}
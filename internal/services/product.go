@@ -3,15 +3,25 @@ package services
 import (
 	"errors"
 	"github.com/google/uuid"
+	"gopay/internal/exts/config"
 	"gopay/internal/exts/db"
 	"gopay/internal/models"
+	"gorm.io/gorm"
+	"net/url"
+	"strings"
 )
 
 type ProductService struct {
 }
 
-func GetProductsByCustomer(pagination *Pagination) error {
+// categoryID为空时获取没有分类的商品
+func GetProductsByCustomer(pagination *Pagination, categoryID *uuid.UUID) error {
 	query := db.DB.Where("status = 1")
+	if categoryID != nil {
+		query = query.Where("category_id = ?", *categoryID)
+	} else {
+		query = query.Where("category_id is null")
+	}
 	query = query.Order((&models.Product{}).DefaultOrder())
 
 	err := Paginate[models.Product](pagination, query)
@@ -20,14 +30,91 @@ func GetProductsByCustomer(pagination *Pagination) error {
 	}
 	return nil
 }
+
+// LIKE中的通配符转义
+var productSearchEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
+// 按名称和描述搜索上架商品,包括翻译,不包括隐藏分类中的商品,keyword为空时返回全部上架商品
+func SearchProductsByCustomer(pagination *Pagination, keyword string) error {
+	query := db.DB.Where("status = 1")
+	if keyword = strings.TrimSpace(keyword); keyword != "" {
+		// 转义通配符,按包含关键词匹配,不区分大小写
+		pattern := "%" + productSearchEscaper.Replace(strings.ToLower(keyword)) + "%"
+		// 同时匹配各语言翻译的名称和描述
+		translationQuery := db.DB.Model(&models.ProductTranslation{}).Select("product_id").
+			Where("LOWER(name) LIKE ? ESCAPE '\\' or LOWER(description) LIKE ? ESCAPE '\\'", pattern, pattern)
+		query = query.Where("(LOWER(name) LIKE ? ESCAPE '\\' or LOWER(description) LIKE ? ESCAPE '\\' or id in (?))", pattern, pattern, translationQuery)
+	}
+
+	tree, err := loadCategoryTree()
+	if err != nil {
+		return err
+	}
+	var hiddenCategoryIDs []uuid.UUID
+	for categoryID := range tree.categories {
+		if !tree.isVisible(categoryID) {
+			hiddenCategoryIDs = append(hiddenCategoryIDs, categoryID)
+		}
+	}
+	if len(hiddenCategoryIDs) > 0 {
+		query = query.Where("(category_id is null or category_id not in ?)", hiddenCategoryIDs)
+	}
+	query = query.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order((&models.ProductVariant{}).DefaultOrder())
+	}).Order((&models.Product{}).DefaultOrder())
+
+	return Paginate[models.Product](pagination, query)
+}
+
 func GetProductByIDByCustomer(productID uuid.UUID) (models.Product, error) {
 	var product models.Product
-	if err := db.DB.Where("id=? and status = 1", productID).First(&product).Error; err != nil {
+	if err := db.DB.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order((&models.ProductVariant{}).DefaultOrder())
+	}).Preload("Media", func(db *gorm.DB) *gorm.DB {
+		return db.Order((&models.ProductMedia{}).DefaultOrder())
+	}).Where("id=? and status = 1", productID).First(&product).Error; err != nil {
 		return product, err
 	}
 	return product, nil
 }
 
+func GetProductByID(productID uuid.UUID) (models.Product, error) {
+	var product models.Product
+	if result := db.DB.Where("id = ?", productID).Find(&product); result.Error != nil {
+		return product, errors.New("获取商品错误")
+	} else if result.RowsAffected == 0 {
+		return product, errors.New("没有该商品")
+	}
+	return product, nil
+}
+
+// 校验商品发货方式,调用发货接口的商品必须设置http(s)地址,且已设置签名密钥
+func ValidateProductDelivery(deliveryType int, webhookURL string) error {
+	switch deliveryType {
+	case models.ProductDeliveryTypeItem:
+		return nil
+	case models.ProductDeliveryTypeWebhook:
+		if config.SiteConfig.WebhookSecret == "" {
+			return errors.New("请先在设置中填写发货接口签名密钥")
+		}
+		parsedURL, err := url.Parse(webhookURL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return errors.New("发货接口地址格式错误")
+		}
+		return nil
+	}
+	return errors.New("发货方式错误")
+}
+
+// 是否有调用发货接口的商品,有则不能清空签名密钥
+func HasWebhookDeliveryProduct() (bool, error) {
+	var count int64
+	if result := db.DB.Model(&models.Product{}).Where("delivery_type = ?", models.ProductDeliveryTypeWebhook).Count(&count); result.Error != nil {
+		return false, errors.New("获取商品错误")
+	}
+	return count > 0, nil
+}
+
 func CreateProduct(product *models.Product) error {
 	result := db.DB.Create(&product)
 	if result.Error != nil {
@@ -79,6 +166,12 @@ func UpdateProduct(productID uuid.UUID, updateMap map[string]interface{}) error
 //}
 
 func UpdateProductInStockCount(productIDs []uuid.UUID) error {
+	// 记录更新前的库存,用于判断是否需要发送库存提醒
+	var beforeStockEntries []StockEntry
+	if len(productIDs) > 0 {
+		beforeStockEntries, _ = getStockEntries(productIDs)
+	}
+
 	//// 查询数量
 	//var inStockCount int64
 	//if err := db.DB.Model(&models.ProductItem{}).Where("product_id=? and status=0", productID).Count(&inStockCount).Error; err != nil {
@@ -103,5 +196,20 @@ func UpdateProductInStockCount(productIDs []uuid.UUID) error {
 		return result.Error
 	}
 
+	// 有规格的商品,规格库存单独统计,商品库存为各规格之和
+	result = db.DB.Exec(`
+			UPDATE product_variant 
+			SET in_stock_count = (
+				SELECT COUNT(*)
+				FROM product_item
+				WHERE product_item.variant_id = product_variant.id AND product_item.status = 1
+			)
+			WHERE product_id IN ?;
+		`, productIDs)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	notifyStockAlert(productIDs, beforeStockEntries)
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"gopay/internal/exts/db"
 	"gopay/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
@@ -13,21 +14,77 @@ func CreateProductItems(productItems []models.ProductItem) error {
 	if err := db.DB.Create(&productItems).Error; err != nil {
 		return err
 	}
+	if len(productItems) == 0 {
+		return nil
+	}
+	return afterProductItemsCreated(productItems[0].ProductID)
+}
+
+// 新增商品项目后,给等待补货的订单发货并更新库存
+func afterProductItemsCreated(productID uuid.UUID) error {
+	// 先给等待补货的已付款订单发货
+	fulfilledOrderIDs, err := FulfillAwaitStockOrders(productID)
+	if err != nil {
+		return err
+	}
 
 	//更新库存数据
-	if len(productItems) > 0 {
-		if err := UpdateProductInStockCount([]uuid.UUID{productItems[0].ProductID}); err != nil {
-			return err
-		}
+	if err := UpdateProductInStockCount([]uuid.UUID{productID}); err != nil {
+		return err
 	}
+
+	DeliverOrders(fulfilledOrderIDs)
 	return nil
 }
 
+// 按付款顺序给等待补货的订单绑定商品项目,返回已绑定的订单ID,由调用者发货
+func FulfillAwaitStockOrders(productID uuid.UUID) ([]uuid.UUID, error) {
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	var awaitStockOrders []models.Order
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("status = 1 and cate = 0 and await_stock = ? and product_id = ?", true, productID).Order("end_time asc, create_time asc").Find(&awaitStockOrders); result.Error != nil {
+		return nil, errors.New("查询等待补货订单失败")
+	}
+
+	var fulfilledOrderIDs []uuid.UUID
+	for i := range awaitStockOrders {
+		order := &awaitStockOrders[i]
+		bound, err := bindFreeProductItem(tx, order)
+		if err != nil {
+			return nil, err
+		}
+		if !bound {
+			// 有规格时其他规格的订单可能还有库存
+			continue
+		}
+		if result := tx.Model(&models.Order{}).Where("id = ?", order.ID).Update("await_stock", false); result.Error != nil {
+			return nil, errors.New("更新订单失败")
+		}
+		if err := AddOrderEvent(tx, order.ID, &order.Status, order.Status, models.OrderEventActorAdmin, nil, "补货发货"); err != nil {
+			return nil, err
+		}
+		if err := RequeueDeliveryOutbox(tx, order.ID); err != nil {
+			return nil, err
+		}
+		fulfilledOrderIDs = append(fulfilledOrderIDs, order.ID)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.New("提交失败, " + err.Error())
+	}
+	return fulfilledOrderIDs, nil
+}
+
 func DeleteProductItems(productItemIDs []uuid.UUID) error {
+	var fileItems []models.ProductItem
+	db.DB.Select("id", "file_key").Where("id in ? and file_key <> ?", productItemIDs, "").Find(&fileItems)
+
 	result := db.DB.Model(&models.ProductItem{}).Delete("id in ?", productItemIDs)
 	if result.RowsAffected == 0 {
 		return errors.New("not_found")
 	}
+	deleteProductItemFiles(fileItems)
 	return nil
 }
 func ClearExpireProductItem() error {
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gorm.io/gorm"
+)
+
+// 每批从数据库读取的行数
+var productItemExportBatchSize = 1000
+
+// 导出筛选的状态名称对应的商品项目状态
+var productItemExportStatuses = map[string]int{
+	"unsold":   1,
+	"locked":   0,
+	"sold":     -1,
+	"refunded": -2,
+}
+
+type ProductItemExportFilter struct {
+	ProductID *uuid.UUID
+	VariantID *uuid.UUID
+	Statuses  []string // 为空则导出全部状态
+	// 时间范围,秒级时间戳,为0则不限制;只导出已售出时按订单完成时间筛选,否则按创建时间筛选
+	StartTime int64
+	EndTime   int64
+}
+
+// 导出的一行,已售出和锁定的商品项目带有订单和买家信息
+type ProductItemExportRow struct {
+	ID          uuid.UUID                   `json:"id"`
+	ProductID   uuid.UUID                   `json:"product_id"`
+	ProductName string                      `json:"product_name"`
+	VariantID   *uuid.UUID                  `json:"variant_id"`
+	Status      string                      `json:"status"` // unsold、locked、sold、refunded
+	CreateTime  int64                       `json:"create_time"`
+	Content     string                      `json:"content"` // 文件商品项目为文件名
+	IsFile      bool                        `json:"is_file"`
+	Fields      models.ProductItemFieldList `json:"fields"`
+
+	OrderID     *uuid.UUID `json:"order_id"`
+	OrderStatus *int       `json:"order_status"`
+	SoldTime    int64      `json:"sold_time"` // 订单完成时间
+	Price       string     `json:"price"`
+	Currency    string     `json:"currency"`
+	Network     string     `json:"network"`
+	VariantName string     `json:"variant_name"`
+	TGChatID    int64      `json:"tg_chat_id"`
+	TGUsername  string     `json:"tg_username"`
+}
+
+func (t ProductItemExportFilter) query() (*gorm.DB, error) {
+	query := db.DB.Model(&models.ProductItem{})
+	if t.ProductID != nil {
+		query = query.Where("product_id = ?", *t.ProductID)
+	}
+	if t.VariantID != nil {
+		query = query.Where("variant_id = ?", *t.VariantID)
+	}
+	var statuses []int
+	for _, name := range t.Statuses {
+		status, ok := productItemExportStatuses[name]
+		if !ok {
+			return nil, errors.New("状态错误: " + name)
+		}
+		statuses = append(statuses, status)
+	}
+	if len(statuses) > 0 {
+		query = query.Where("status in ?", statuses)
+	}
+	if t.StartTime < 0 || t.EndTime < 0 || (t.EndTime > 0 && t.StartTime > t.EndTime) {
+		return nil, errors.New("时间范围错误")
+	}
+
+	if len(statuses) == 1 && statuses[0] == -1 {
+		// 已售出按订单完成时间筛选
+		if t.StartTime > 0 || t.EndTime > 0 {
+			orderQuery := db.DB.Model(&models.Order{}).Select("id")
+			if t.StartTime > 0 {
+				orderQuery = orderQuery.Where("end_time >= ?", t.StartTime)
+			}
+			if t.EndTime > 0 {
+				orderQuery = orderQuery.Where("end_time <= ?", t.EndTime)
+			}
+			query = query.Where("order_id in (?)", orderQuery)
+		}
+	} else {
+		if t.StartTime > 0 {
+			query = query.Where("create_time >= ?", t.StartTime)
+		}
+		if t.EndTime > 0 {
+			query = query.Where("create_time <= ?", t.EndTime)
+		}
+	}
+	return query, nil
+}
+
+// 按筛选条件分批读取商品项目,每行调用一次write,write返回错误时停止导出
+func ExportProductItems(filter ProductItemExportFilter, write func(row ProductItemExportRow) error) error {
+	query, err := filter.query()
+	if err != nil {
+		return err
+	}
+
+	productNames := make(map[uuid.UUID]string)
+	var writeErr error
+	var productItems []models.ProductItem
+	result := query.Preload("Order").FindInBatches(&productItems, productItemExportBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, productItem := range productItems {
+			productName, ok := productNames[productItem.ProductID]
+			if !ok {
+				var product models.Product
+				if err := db.DB.Select("name").Where("id = ?", productItem.ProductID).Limit(1).Find(&product).Error; err != nil {
+					return err
+				}
+				productName = product.Name
+				productNames[productItem.ProductID] = productName
+			}
+			if writeErr = write(newProductItemExportRow(productItem, productName)); writeErr != nil {
+				return writeErr
+			}
+		}
+		return nil
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if result.Error != nil {
+		return errors.New("查询商品项目失败")
+	}
+	return nil
+}
+
+func newProductItemExportRow(productItem models.ProductItem, productName string) ProductItemExportRow {
+	row := ProductItemExportRow{
+		ID:          productItem.ID,
+		ProductID:   productItem.ProductID,
+		ProductName: productName,
+		VariantID:   productItem.VariantID,
+		Status:      productItemExportStatusName(productItem.Status),
+		CreateTime:  productItem.CreateTime,
+		Content:     productItem.Content,
+		IsFile:      productItem.IsFile(),
+		Fields:      productItem.Fields,
+		OrderID:     productItem.OrderID,
+	}
+	if order := productItem.Order; order != nil {
+		orderStatus := order.Status
+		row.OrderStatus = &orderStatus
+		row.SoldTime = order.EndTime
+		row.Price = order.Price.String()
+		row.Currency = order.Currency
+		row.Network = order.Network
+		row.VariantName = order.VariantName
+		row.TGChatID = order.TGChatID
+		row.TGUsername = order.TGUsername
+	}
+	return row
+}
+
+// 导出的状态使用与筛选条件相同的名称
+func productItemExportStatusName(status int) string {
+	for name, value := range productItemExportStatuses {
+		if value == status {
+			return name
+		}
+	}
+	return "unknown"
+}
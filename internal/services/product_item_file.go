@@ -0,0 +1,137 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gopay/internal/exts/blob_store"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"io"
+	"path"
+	"strings"
+)
+
+// Telegram机器人发送文件的大小上限
+var productItemFileMaxSize int64 = 50 << 20
+var productItemZipMaxFiles = 1000
+
+// Telegram文件说明的长度上限
+var documentCaptionMaxLength = 1024
+
+type ProductItemFile struct {
+	Name string
+	Data []byte
+}
+
+// 一次上传的文件解压后的总大小上限,文件逐个保存,内存中最多只有一个文件
+var productItemUploadMaxTotalSize int64 = 1 << 30
+
+// 逐个保存上传的文件,全部保存后一次创建文件商品项目,失败时调用Abort删除已保存的文件
+type FileProductItemWriter struct {
+	productID    uuid.UUID
+	variantID    *uuid.UUID
+	productItems []models.ProductItem
+	totalSize    int64
+}
+
+func NewFileProductItemWriter(productID uuid.UUID, variantID *uuid.UUID) *FileProductItemWriter {
+	return &FileProductItemWriter{productID: productID, variantID: variantID}
+}
+
+// 读取并保存一个文件,按单个文件和剩余总大小的上限读取,不信任文件头中的大小
+func (w *FileProductItemWriter) Add(name string, r io.Reader) error {
+	maxSize := min(productItemFileMaxSize, productItemUploadMaxTotalSize-w.totalSize)
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败", name)
+	}
+	if int64(len(data)) > maxSize {
+		if maxSize < productItemFileMaxSize {
+			return fmt.Errorf("文件总大小不能超过%dMB", productItemUploadMaxTotalSize>>20)
+		}
+		return fmt.Errorf("文件 %s 超过50MB", name)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("文件 %s 为空", name)
+	}
+
+	fileKey := fmt.Sprintf("product_item/%s/%s", w.productID, uuid.New())
+	if err := blob_store.Store.Put(fileKey, data); err != nil {
+		return errors.New("保存文件失败")
+	}
+	productItem := models.NewFileProductItem(name, fileKey, int64(len(data)), w.productID)
+	productItem.VariantID = w.variantID
+	w.productItems = append(w.productItems, *productItem)
+	w.totalSize += int64(len(data))
+	return nil
+}
+
+// 解压zip并逐个保存,每个文件作为一个商品项目,忽略目录和系统生成的隐藏文件
+func (w *FileProductItemWriter) AddZip(r io.ReaderAt, size int64) error {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return errors.New("zip文件格式错误")
+	}
+
+	count := 0
+	for _, zipFile := range reader.File {
+		name := path.Base(zipFile.Name)
+		if zipFile.FileInfo().IsDir() || strings.HasPrefix(zipFile.Name, "__MACOSX/") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if count >= productItemZipMaxFiles {
+			return fmt.Errorf("zip内文件数量不能超过%d个", productItemZipMaxFiles)
+		}
+		if zipFile.UncompressedSize64 > uint64(productItemFileMaxSize) {
+			return fmt.Errorf("文件 %s 超过50MB", name)
+		}
+
+		rc, err := zipFile.Open()
+		if err != nil {
+			return fmt.Errorf("解压 %s 失败", name)
+		}
+		err = w.Add(name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		count++
+	}
+	if count == 0 {
+		return errors.New("zip内没有文件")
+	}
+	return nil
+}
+
+func (w *FileProductItemWriter) Count() int {
+	return len(w.productItems)
+}
+
+// 创建已保存文件的商品项目,数据库写入失败时删除已保存的文件
+func (w *FileProductItemWriter) Commit() error {
+	if len(w.productItems) == 0 {
+		return errors.New("没有文件")
+	}
+	if err := db.DB.Create(&w.productItems).Error; err != nil {
+		w.Abort()
+		return errors.New("创建商品项目失败")
+	}
+	return afterProductItemsCreated(w.productID)
+}
+
+// 删除已保存但未创建商品项目的文件
+func (w *FileProductItemWriter) Abort() {
+	deleteProductItemFiles(w.productItems)
+	w.productItems = nil
+	w.totalSize = 0
+}
+
+func deleteProductItemFiles(productItems []models.ProductItem) {
+	for _, productItem := range productItems {
+		if productItem.IsFile() {
+			blob_store.Store.Delete(productItem.FileKey)
+		}
+	}
+}
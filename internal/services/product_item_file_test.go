@@ -0,0 +1,89 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/blob_store"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testZip(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		fileWriter, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileWriter.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func countBlobFiles(t *testing.T, dir string) int {
+	t.Helper()
+	count := 0
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+func TestFileProductItemWriterTotalSize(t *testing.T) {
+	setupTestDB(t)
+	blobDir := t.TempDir()
+	blob_store.Store = blob_store.NewLocalStore(blobDir)
+	oldMaxTotalSize := productItemUploadMaxTotalSize
+	productItemUploadMaxTotalSize = 1000
+	t.Cleanup(func() { productItemUploadMaxTotalSize = oldMaxTotalSize })
+
+	// 按实际解压的字节计算总大小,超出后删除已保存的文件
+	writer := NewFileProductItemWriter(uuid.New(), nil)
+	content := strings.Repeat("a", 400)
+	zipReader := testZip(t, map[string]string{"1.txt": content, "2.txt": content, "3.txt": content})
+	if err := writer.AddZip(zipReader, zipReader.Size()); err == nil {
+		t.Fatal("解压后总大小超出上限时应返回错误")
+	}
+	writer.Abort()
+	if count := countBlobFiles(t, blobDir); count != 0 {
+		t.Fatalf("剩余 %d 个文件, 应全部删除", count)
+	}
+
+	product := models.NewProduct("文件商品", "", "CNY", decimal.NewFromInt(1))
+	if err := db.DB.Create(product).Error; err != nil {
+		t.Fatal(err)
+	}
+	writer = NewFileProductItemWriter(product.ID, nil)
+	zipReader = testZip(t, map[string]string{"1.txt": content, "__MACOSX/._1.txt": content, "dir/.hidden": content})
+	if err := writer.AddZip(zipReader, zipReader.Size()); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Add("2.txt", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Add("3.txt", strings.NewReader(content)); err == nil {
+		t.Fatal("总大小超出上限时应返回错误")
+	}
+	if err := writer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.DB.Model(&models.ProductItem{}).Where("product_id = ?", product.ID).Count(&count)
+	if count != 2 || countBlobFiles(t, blobDir) != 2 {
+		t.Fatalf("商品项目 %d 个, 应为 2 个", count)
+	}
+}
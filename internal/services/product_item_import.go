@@ -0,0 +1,395 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gopay/internal/utils/xlsx"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 每批查重和写入的行数
+var productItemImportBatchSize = 1000
+
+// 最多返回的错误行数和预览行数
+var productItemImportMaxErrors = 1000
+var productItemImportPreviewSize = 20
+
+// 未映射列时,多列内容用该分隔符连接
+var productItemColumnSeparator = "----"
+
+// 同时只允许一个导入任务,避免并发导入时查重失效
+var productItemImportLock sync.Mutex
+
+// 导入文件的行读取器,line为文件中的行号,没有更多行时返回io.EOF
+// 需要释放资源的读取器同时实现io.Closer,导入结束时关闭
+type ProductItemRowReader interface {
+	Read() (line int, cells []string, err error)
+}
+
+// 单行格式错误,跳过该行继续导入
+type productItemRowError struct {
+	msg string
+}
+
+func (e *productItemRowError) Error() string {
+	return e.msg
+}
+
+type textRowReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// 每行为一个商品项目
+func NewTextRowReader(r io.Reader) ProductItemRowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	return &textRowReader{scanner: scanner}
+}
+
+func (t *textRowReader) Read() (int, []string, error) {
+	if !t.scanner.Scan() {
+		if err := t.scanner.Err(); err != nil {
+			return t.line + 1, nil, fmt.Errorf("读取第%d行失败, 单行不能超过1MB", t.line+1)
+		}
+		return t.line, nil, io.EOF
+	}
+	t.line++
+	return t.line, []string{strings.TrimSuffix(t.scanner.Text(), "\r")}, nil
+}
+
+type csvRowReader struct {
+	reader *csv.Reader
+}
+
+// delimiter为0时使用逗号
+func NewCSVRowReader(r io.Reader, delimiter rune) ProductItemRowReader {
+	bufReader := bufio.NewReader(r)
+	// 跳过Excel导出csv时带的BOM
+	if bom, err := bufReader.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		bufReader.Discard(3)
+	}
+	reader := csv.NewReader(bufReader)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if delimiter != 0 {
+		reader.Comma = delimiter
+	}
+	return &csvRowReader{reader: reader}
+}
+
+func (t *csvRowReader) Read() (int, []string, error) {
+	record, err := t.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return parseErr.StartLine, nil, &productItemRowError{msg: "csv格式错误"}
+		}
+		return 0, nil, err
+	}
+	line, _ := t.reader.FieldPos(0)
+	return line, record, nil
+}
+
+type xlsxRowReader struct {
+	reader *xlsx.Reader
+}
+
+func NewXLSXRowReader(r io.ReaderAt, size int64) (ProductItemRowReader, error) {
+	reader, err := xlsx.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxRowReader{reader: reader}, nil
+}
+
+func (t *xlsxRowReader) Read() (int, []string, error) {
+	return t.reader.Read()
+}
+
+func (t *xlsxRowReader) Close() error {
+	return t.reader.Close()
+}
+
+// 列映射,Column为列号(从1开始)、Excel列字母或表头名称
+type ProductItemImportColumn struct {
+	Label  string `json:"label"`
+	Column string `json:"column"`
+}
+
+type ProductItemImportOptions struct {
+	ProductID uuid.UUID
+	VariantID *uuid.UUID
+	HasHeader bool                      // 第一行为表头,不导入
+	Columns   []ProductItemImportColumn // 为空则整行作为内容
+	DryRun    bool                      // 只检查不写入
+}
+
+type ProductItemImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type ProductItemImportPreview struct {
+	Line    int                         `json:"line"`
+	Content string                      `json:"content"`
+	Fields  models.ProductItemFieldList `json:"fields"`
+}
+
+type ProductItemImportResult struct {
+	DryRun     bool                       `json:"dry_run"`
+	Total      int                        `json:"total"`      // 非空行数
+	Imported   int                        `json:"imported"`   // 导入数量,预览时为可导入的数量
+	Duplicated int                        `json:"duplicated"` // 与文件中其他行或已有商品项目重复
+	Failed     int                        `json:"failed"`
+	Errors     []ProductItemImportError   `json:"errors"` // 最多返回前1000条
+	Preview    []ProductItemImportPreview `json:"preview"`
+}
+
+func (t *ProductItemImportResult) addError(line int, msg string) {
+	if len(t.Errors) < productItemImportMaxErrors {
+		t.Errors = append(t.Errors, ProductItemImportError{Line: line, Error: msg})
+	}
+}
+
+type productItemImportRow struct {
+	line        int
+	productItem models.ProductItem
+}
+
+// 按行读取并导入商品项目,与文件中前面的行或该商品已有的项目(包括已售出)内容相同的跳过
+func ImportProductItems(rows ProductItemRowReader, options ProductItemImportOptions) (*ProductItemImportResult, error) {
+	// 提前返回时也要关闭
+	if closer, ok := rows.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if err := CheckProductItemVariant(options.ProductID, options.VariantID); err != nil {
+		return nil, err
+	}
+	productItemImportLock.Lock()
+	defer productItemImportLock.Unlock()
+
+	if err := backfillProductItemContentHash(options.ProductID); err != nil {
+		return nil, err
+	}
+
+	var header []string
+	if options.HasHeader {
+		_, cells, err := rows.Read()
+		if err == io.EOF {
+			return nil, errors.New("文件为空")
+		} else if err != nil {
+			return nil, errors.New("读取表头失败")
+		}
+		header = cells
+	}
+	columnIndexes, err := resolveImportColumns(options.Columns, header)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProductItemImportResult{DryRun: options.DryRun}
+	err = importProductItemRows(rows, columnIndexes, options, result)
+	// 中途出错时已写入的部分同样需要更新库存
+	if !options.DryRun && result.Imported > 0 {
+		if afterErr := afterProductItemsCreated(options.ProductID); err == nil {
+			err = afterErr
+		}
+	}
+	return result, err
+}
+
+func importProductItemRows(rows ProductItemRowReader, columnIndexes []int, options ProductItemImportOptions, result *ProductItemImportResult) error {
+	seenLines := make(map[string]int)
+	var batch []productItemImportRow
+	for {
+		line, cells, err := rows.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			var rowErr *productItemRowError
+			if !errors.As(err, &rowErr) {
+				return err
+			}
+			result.Total++
+			result.Failed++
+			result.addError(line, rowErr.msg)
+			continue
+		}
+
+		productItem, ok, err := buildImportProductItem(cells, columnIndexes, options)
+		if !ok {
+			continue
+		}
+		result.Total++
+		if err != nil {
+			result.Failed++
+			result.addError(line, err.Error())
+			continue
+		}
+		if firstLine, ok := seenLines[productItem.ContentHash]; ok {
+			result.Duplicated++
+			result.addError(line, fmt.Sprintf("与第%d行重复", firstLine))
+			continue
+		}
+		seenLines[productItem.ContentHash] = line
+
+		batch = append(batch, productItemImportRow{line: line, productItem: productItem})
+		if len(batch) >= productItemImportBatchSize {
+			if err := importProductItemBatch(batch, options, result); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	return importProductItemBatch(batch, options, result)
+}
+
+// 解析列映射,返回每个字段对应的列序号
+func resolveImportColumns(columns []ProductItemImportColumn, header []string) ([]int, error) {
+	var columnIndexes []int
+	for _, column := range columns {
+		if strings.TrimSpace(column.Label) == "" {
+			return nil, errors.New("字段名称不能为空")
+		}
+		index, ok := resolveImportColumn(strings.TrimSpace(column.Column), header)
+		if !ok {
+			return nil, fmt.Errorf("找不到字段 %s 对应的列 %s", column.Label, column.Column)
+		}
+		columnIndexes = append(columnIndexes, index)
+	}
+	return columnIndexes, nil
+}
+
+func resolveImportColumn(column string, header []string) (int, bool) {
+	for i, name := range header {
+		if strings.TrimSpace(name) == column {
+			return i, true
+		}
+	}
+	if index, err := strconv.Atoi(column); err == nil {
+		return index - 1, index > 0
+	}
+	return xlsx.ColumnIndex(column)
+}
+
+// 空行返回ok为false,映射的列为空时返回错误
+func buildImportProductItem(cells []string, columnIndexes []int, options ProductItemImportOptions) (models.ProductItem, bool, error) {
+	var values []string
+	for _, cell := range cells {
+		if value := strings.TrimSpace(cell); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return models.ProductItem{}, false, nil
+	}
+
+	productItem := models.NewProductItem(strings.Join(values, productItemColumnSeparator), options.ProductID)
+	productItem.VariantID = options.VariantID
+	if len(columnIndexes) > 0 {
+		values = nil
+		for i, index := range columnIndexes {
+			value := ""
+			if index < len(cells) {
+				value = strings.TrimSpace(cells[index])
+			}
+			if value == "" {
+				return models.ProductItem{}, true, fmt.Errorf("%s为空", options.Columns[i].Label)
+			}
+			values = append(values, value)
+			productItem.Fields = append(productItem.Fields, models.ProductItemField{Label: options.Columns[i].Label, Value: value})
+		}
+		productItem.Content = strings.Join(values, productItemColumnSeparator)
+	}
+	productItem.ContentHash = models.ProductItemContentHash(productItem.Content)
+	return *productItem, true, nil
+}
+
+// 与已有商品项目查重后写入一批
+func importProductItemBatch(batch []productItemImportRow, options ProductItemImportOptions, result *ProductItemImportResult) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	var hashes []string
+	for _, row := range batch {
+		hashes = append(hashes, row.productItem.ContentHash)
+	}
+	var existItems []models.ProductItem
+	if err := db.DB.Select("content_hash, status").Where("product_id = ? and content_hash in ?", options.ProductID, hashes).Find(&existItems).Error; err != nil {
+		return errors.New("查询已有商品项目失败")
+	}
+	existStatus := make(map[string]int)
+	for _, existItem := range existItems {
+		existStatus[existItem.ContentHash] = existItem.Status
+	}
+
+	var productItems []models.ProductItem
+	for _, row := range batch {
+		if status, ok := existStatus[row.productItem.ContentHash]; ok {
+			result.Duplicated++
+			result.addError(row.line, fmt.Sprintf("与已有商品项目重复(%s)", productItemStatusName(status)))
+			continue
+		}
+		if len(result.Preview) < productItemImportPreviewSize {
+			result.Preview = append(result.Preview, ProductItemImportPreview{Line: row.line, Content: row.productItem.Content, Fields: row.productItem.Fields})
+		}
+		productItems = append(productItems, row.productItem)
+	}
+	if len(productItems) == 0 {
+		return nil
+	}
+	if !options.DryRun {
+		if err := db.DB.CreateInBatches(&productItems, 500).Error; err != nil {
+			return fmt.Errorf("第%d行之后的商品项目写入失败", batch[0].line)
+		}
+	}
+	result.Imported += len(productItems)
+	return nil
+}
+
+func productItemStatusName(status int) string {
+	switch status {
+	case 1:
+		return "未出售"
+	case 0:
+		return "待支付"
+	case -1:
+		return "已出售"
+	case -2:
+		return "退款作废"
+	}
+	return "未知状态"
+}
+
+// 给添加去重前创建的文本商品项目补充内容哈希
+func backfillProductItemContentHash(productID uuid.UUID) error {
+	for {
+		var productItems []models.ProductItem
+		if err := db.DB.Select("id, content").Where("product_id = ? and (content_hash = '' or content_hash is null) and (file_key = '' or file_key is null)", productID).Limit(productItemImportBatchSize).Find(&productItems).Error; err != nil {
+			return errors.New("查询商品项目失败")
+		}
+		if len(productItems) == 0 {
+			return nil
+		}
+
+		tx := db.DB.Begin()
+		for _, productItem := range productItems {
+			if err := tx.Model(&models.ProductItem{}).Where("id = ?", productItem.ID).Update("content_hash", models.ProductItemContentHash(productItem.Content)).Error; err != nil {
+				tx.Rollback()
+				return errors.New("更新商品项目失败")
+			}
+		}
+		if err := tx.Commit().Error; err != nil {
+			return errors.New("更新商品项目失败")
+		}
+	}
+}
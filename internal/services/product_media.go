@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gopay/internal/exts/blob_store"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"path"
+	"strings"
+)
+
+// Telegram相册最多10个,图片上传上限10MB,视频上传上限50MB
+var productMediaMaxCount = 10
+var productPhotoMaxSize int64 = 10 << 20
+var productVideoMaxSize int64 = 50 << 20
+
+// 根据扩展名判断媒体类型
+func productMediaType(fileName string) (string, error) {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".jpg", ".jpeg", ".png", ".webp":
+		return models.ProductMediaTypePhoto, nil
+	case ".mp4":
+		return models.ProductMediaTypeVideo, nil
+	}
+	return "", fmt.Errorf("不支持的文件格式: %s,图片支持jpg/png/webp,视频支持mp4", fileName)
+}
+
+// 保存商品图片或视频,可以是多张图片或一个视频
+func CreateProductMedia(productID uuid.UUID, priority int64, files []ProductItemFile) error {
+	if len(files) == 0 {
+		return errors.New("没有文件")
+	}
+	if _, err := GetProductByID(productID); err != nil {
+		return err
+	}
+	var existMediaList []models.ProductMedia
+	if err := db.DB.Where("product_id = ?", productID).Find(&existMediaList).Error; err != nil {
+		return errors.New("获取商品媒体失败")
+	}
+	if len(existMediaList)+len(files) > productMediaMaxCount {
+		return fmt.Errorf("每个商品最多%d个图片或视频", productMediaMaxCount)
+	}
+	videoCount := 0
+	for _, media := range existMediaList {
+		if media.Type == models.ProductMediaTypeVideo {
+			videoCount++
+		}
+	}
+
+	var mediaList []models.ProductMedia
+	for _, file := range files {
+		mediaType, err := productMediaType(file.Name)
+		if err != nil {
+			deleteProductMediaFiles(mediaList)
+			return err
+		}
+		if len(file.Data) == 0 {
+			deleteProductMediaFiles(mediaList)
+			return fmt.Errorf("文件 %s 为空", file.Name)
+		}
+		if mediaType == models.ProductMediaTypePhoto && int64(len(file.Data)) > productPhotoMaxSize {
+			deleteProductMediaFiles(mediaList)
+			return fmt.Errorf("图片 %s 超过10MB", file.Name)
+		}
+		if mediaType == models.ProductMediaTypeVideo {
+			if int64(len(file.Data)) > productVideoMaxSize {
+				deleteProductMediaFiles(mediaList)
+				return fmt.Errorf("视频 %s 超过50MB", file.Name)
+			}
+			if videoCount++; videoCount > 1 {
+				deleteProductMediaFiles(mediaList)
+				return errors.New("每个商品只能有一个视频")
+			}
+		}
+
+		fileKey := fmt.Sprintf("product_media/%s/%s", productID, uuid.New())
+		if err := blob_store.Store.Put(fileKey, file.Data); err != nil {
+			deleteProductMediaFiles(mediaList)
+			return errors.New("保存文件失败")
+		}
+		mediaList = append(mediaList, *models.NewProductMedia(mediaType, file.Name, fileKey, int64(len(file.Data)), priority, productID))
+	}
+
+	if err := db.DB.Create(&mediaList).Error; err != nil {
+		deleteProductMediaFiles(mediaList)
+		return errors.New("保存商品媒体失败")
+	}
+	return nil
+}
+
+func UpdateProductMedia(mediaID uuid.UUID, updateMap map[string]interface{}) error {
+	result := db.DB.Model(&models.ProductMedia{}).Where("id = ?", mediaID).Updates(updateMap)
+	if result.Error != nil {
+		return errors.New("更新失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("not_found")
+	}
+	return nil
+}
+
+// 首次上传到Telegram后记录file_id,之后直接使用file_id发送
+func SetProductMediaFileID(mediaID uuid.UUID, fileID string) error {
+	return db.DB.Model(&models.ProductMedia{}).Where("id = ?", mediaID).Update("tg_file_id", fileID).Error
+}
+
+func GetProductMediaData(media models.ProductMedia) ([]byte, error) {
+	data, err := blob_store.Store.Get(media.FileKey)
+	if err != nil {
+		return nil, errors.New("读取商品媒体失败")
+	}
+	return data, nil
+}
+
+func DeleteProductMedia(mediaIDs []uuid.UUID) error {
+	var mediaList []models.ProductMedia
+	if err := db.DB.Where("id in ?", mediaIDs).Find(&mediaList).Error; err != nil {
+		return errors.New("获取商品媒体失败")
+	}
+	if len(mediaList) == 0 {
+		return errors.New("not_found")
+	}
+	if err := db.DB.Where("id in ?", mediaIDs).Delete(&models.ProductMedia{}).Error; err != nil {
+		return errors.New("删除失败")
+	}
+	deleteProductMediaFiles(mediaList)
+	return nil
+}
+
+func deleteProductMediaFiles(mediaList []models.ProductMedia) {
+	for _, media := range mediaList {
+		blob_store.Store.Delete(media.FileKey)
+	}
+}
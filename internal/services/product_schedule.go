@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/exts/tg_bot"
+	"gopay/internal/models"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// 计入特价可售数量的订单状态:待支付、已支付、部分退款
+var saleOrderStatuses = []int{0, 1, 3}
+
+// 正在生效的限时特价
+type ProductSale struct {
+	Price         decimal.Decimal
+	OriginalPrice decimal.Decimal
+	EndTime       int64 // 为0则不限结束时间
+	Limited       bool  // 是否限制特价可售数量
+	Remaining     uint  // 特价剩余可售数量,Limited为true时有效
+}
+
+// 距离特价结束的剩余时间,如"2天3小时",按用户的语言显示
+func (t ProductSale) Countdown(language string) string {
+	seconds := t.EndTime - time.Now().Unix()
+	if t.EndTime == 0 || seconds <= 0 {
+		return ""
+	}
+	days, hours, minutes := seconds/86400, seconds%86400/3600, seconds%3600/60
+	if days > 0 {
+		return config.Tf(language, "%d天%d小时", days, hours)
+	} else if hours > 0 {
+		return config.Tf(language, "%d小时%d分钟", hours, minutes)
+	}
+	return config.Tf(language, "%d分钟", minutes+1)
+}
+
+// 获取商品或规格当前生效的特价,不在特价时间内或特价已售完时返回nil
+func GetProductSale(product models.Product, variant *models.ProductVariant) (*ProductSale, error) {
+	return getProductSale(db.DB, product, variant)
+}
+
+func getProductSale(tx *gorm.DB, product models.Product, variant *models.ProductVariant) (*ProductSale, error) {
+	salePrice, originalPrice := product.SalePrice, product.Price
+	if variant != nil {
+		salePrice, originalPrice = variant.SalePrice, variant.Price
+	}
+	if salePrice == nil || !product.InSaleTime(time.Now().Unix()) {
+		return nil, nil
+	}
+
+	sale := &ProductSale{Price: *salePrice, OriginalPrice: originalPrice, EndTime: product.SaleEndTime}
+	if product.SaleLimit > 0 {
+		// 特价开始后以特价创建的有效订单,超时或关闭的订单不计入
+		var soldCount int64
+		if err := tx.Model(&models.Order{}).Where("product_id = ? and on_sale = ? and status in ? and create_time >= ?", product.ID, true, saleOrderStatuses, product.SaleStartTime).Count(&soldCount).Error; err != nil {
+			return nil, errors.New("查询特价销量失败")
+		}
+		if uint(soldCount) >= product.SaleLimit {
+			return nil, nil
+		}
+		sale.Limited = true
+		sale.Remaining = product.SaleLimit - uint(soldCount)
+	}
+	return sale, nil
+}
+
+// 下单时生效的基础价格,返回是否为特价;特价限量时需先锁定商品,避免并发下单超出可售数量
+func getOrderBasePrice(tx *gorm.DB, product models.Product, variant *models.ProductVariant) (decimal.Decimal, bool, error) {
+	price := product.Price
+	if variant != nil {
+		price = variant.Price
+	}
+	sale, err := getProductSale(tx, product, variant)
+	if err != nil {
+		return price, false, err
+	}
+	if sale != nil {
+		return sale.Price, true, nil
+	}
+	return price, false, nil
+}
+
+type ProductSchedule struct {
+	PublishTime   *int64
+	UnpublishTime *int64
+	SalePrice     *decimal.Decimal
+	SaleStartTime int64
+	SaleEndTime   int64
+	SaleLimit     uint
+}
+
+// 设置商品的定时上下架和限时特价,为空的项目会被清除
+func SetProductSchedule(productID uuid.UUID, schedule ProductSchedule) error {
+	if schedule.SalePrice != nil && !schedule.SalePrice.IsPositive() {
+		return errors.New("特价必须大于0")
+	}
+	if schedule.SaleStartTime < 0 || schedule.SaleEndTime < 0 || (schedule.SaleEndTime > 0 && schedule.SaleEndTime <= schedule.SaleStartTime) {
+		return errors.New("特价时间错误")
+	}
+	if schedule.PublishTime != nil && schedule.UnpublishTime != nil && *schedule.PublishTime == *schedule.UnpublishTime {
+		return errors.New("上架时间和下架时间不能相同")
+	}
+
+	result := db.DB.Model(&models.Product{}).Where("id = ?", productID).Updates(map[string]interface{}{
+		"publish_time":    schedule.PublishTime,
+		"unpublish_time":  schedule.UnpublishTime,
+		"sale_price":      schedule.SalePrice,
+		"sale_start_time": schedule.SaleStartTime,
+		"sale_end_time":   schedule.SaleEndTime,
+		"sale_limit":      schedule.SaleLimit,
+	})
+	if result.Error != nil {
+		return errors.New("设置失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("商品不存在")
+	}
+	return nil
+}
+
+// 应用到达时间的定时上下架,上架和下架时间都已到达时以较晚的为准
+func ApplyProductPublishSchedule() error {
+	now := time.Now().Unix()
+	var products []models.Product
+	if err := db.DB.Where("publish_time <= ? or unpublish_time <= ?", now, now).Find(&products).Error; err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, product := range products {
+		publish := product.PublishTime != nil && *product.PublishTime <= now
+		unpublish := product.UnpublishTime != nil && *product.UnpublishTime <= now
+		status := 0
+		if publish && (!unpublish || *product.PublishTime > *product.UnpublishTime) {
+			status = 1
+		}
+
+		// 条件带上原来的时间,管理员在此期间修改了设置时不覆盖
+		query := db.DB.Model(&models.Product{}).Where("id = ?", product.ID)
+		updateMap := map[string]interface{}{"status": status}
+		if publish {
+			query = query.Where("publish_time = ?", *product.PublishTime)
+			updateMap["publish_time"] = nil
+		}
+		if unpublish {
+			query = query.Where("unpublish_time = ?", *product.UnpublishTime)
+			updateMap["unpublish_time"] = nil
+		}
+		result := query.Updates(updateMap)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || status == product.Status {
+			continue
+		}
+		if status == 1 {
+			lines = append(lines, fmt.Sprintf("%s 已定时上架", product.Name))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s 已定时下架", product.Name))
+		}
+	}
+	if len(lines) > 0 {
+		go tg_bot.SendAdmin("定时上下架\n" + strings.Join(lines, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/models"
+	"testing"
+	"time"
+)
+
+func TestGetProductSaleRemaining(t *testing.T) {
+	setupTestDB(t)
+	now := time.Now().Unix()
+	salePrice := decimal.NewFromInt(8)
+	product := models.Product{ID: uuid.New(), Price: decimal.NewFromInt(10), SalePrice: &salePrice, SaleStartTime: now - 3600, SaleLimit: 3}
+
+	// 特价开始后以特价创建的待支付、已支付、部分退款订单计入
+	for _, status := range []int{1, 3, -1, -2, 2} {
+		createTestOrder(t, &models.Order{Status: status, OnSale: true, ProductID: &product.ID})
+	}
+	createTestOrder(t, &models.Order{Status: 1, ProductID: &product.ID})
+	createTestOrder(t, &models.Order{Status: 1, OnSale: true, ProductID: &product.ID, CreateTime: now - 7200})
+
+	sale, err := GetProductSale(product, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sale == nil || !sale.Limited || sale.Remaining != 1 || !sale.Price.Equal(salePrice) {
+		t.Fatalf("特价 %+v, 应剩余 1 件", sale)
+	}
+
+	// 售完后恢复原价
+	createTestOrder(t, &models.Order{Status: 0, OnSale: true, ProductID: &product.ID})
+	if sale, err := GetProductSale(product, nil); err != nil || sale != nil {
+		t.Fatalf("特价已售完, 返回 %+v %v", sale, err)
+	}
+
+	// 不限量时不统计剩余数量
+	product.SaleLimit = 0
+	if sale, err := GetProductSale(product, nil); err != nil || sale == nil || sale.Limited {
+		t.Fatalf("不限量特价 %+v %v", sale, err)
+	}
+}
+
+func TestGetProductSaleTime(t *testing.T) {
+	setupTestDB(t)
+	now := time.Now().Unix()
+	salePrice := decimal.NewFromInt(8)
+	variantSalePrice := decimal.NewFromInt(4)
+	variant := &models.ProductVariant{ID: uuid.New(), Price: decimal.NewFromInt(5), SalePrice: &variantSalePrice}
+
+	// 有规格时使用规格的特价
+	product := models.Product{ID: uuid.New(), Price: decimal.NewFromInt(10), SalePrice: &salePrice, SaleEndTime: now + 3600}
+	if sale, err := GetProductSale(product, variant); err != nil || sale == nil || !sale.Price.Equal(variantSalePrice) || !sale.OriginalPrice.Equal(variant.Price) {
+		t.Fatalf("规格特价 %+v %v", sale, err)
+	}
+
+	for _, saleTime := range [][2]int64{{now + 60, 0}, {now - 7200, now - 3600}} {
+		product.SaleStartTime, product.SaleEndTime = saleTime[0], saleTime[1]
+		if sale, err := GetProductSale(product, nil); err != nil || sale != nil {
+			t.Fatalf("不在特价时间 %v 内, 返回 %+v %v", saleTime, sale, err)
+		}
+	}
+}
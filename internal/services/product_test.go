@@ -0,0 +1,40 @@
+package services
+
+import (
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"testing"
+)
+
+func TestValidateProductDeliveryWebhookSecret(t *testing.T) {
+	setupTestDB(t)
+	oldSecret := config.SiteConfig.WebhookSecret
+	t.Cleanup(func() { config.SiteConfig.WebhookSecret = oldSecret })
+
+	// 没有签名密钥时不能设置为调用发货接口
+	config.SiteConfig.WebhookSecret = ""
+	if err := ValidateProductDelivery(models.ProductDeliveryTypeWebhook, "https://example.com/deliver"); err == nil {
+		t.Fatal("没有签名密钥时应返回错误")
+	}
+	if err := ValidateProductDelivery(models.ProductDeliveryTypeItem, ""); err != nil {
+		t.Fatal(err)
+	}
+	config.SiteConfig.WebhookSecret = "secret"
+	if err := ValidateProductDelivery(models.ProductDeliveryTypeWebhook, "https://example.com/deliver"); err != nil {
+		t.Fatal(err)
+	}
+
+	if has, err := HasWebhookDeliveryProduct(); err != nil || has {
+		t.Fatalf("返回 %v %v, 应没有调用发货接口的商品", has, err)
+	}
+	product := models.NewProduct("接口商品", "", "CNY", decimal.NewFromInt(1))
+	product.DeliveryType = models.ProductDeliveryTypeWebhook
+	if err := db.DB.Create(product).Error; err != nil {
+		t.Fatal(err)
+	}
+	if has, err := HasWebhookDeliveryProduct(); err != nil || !has {
+		t.Fatalf("返回 %v %v, 应有调用发货接口的商品", has, err)
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// 设置商品某种语言的名称和描述,已有该语言的翻译时覆盖
+func SetProductTranslation(productID uuid.UUID, language string, name string, description string) (*models.ProductTranslation, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if !config.IsLanguageAvailable(language) {
+		return nil, errors.New("语言不存在")
+	}
+	if _, err := GetProductByID(productID); err != nil {
+		return nil, err
+	}
+
+	productTranslation := models.NewProductTranslation(productID, language, name, description)
+	if err := db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "language"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description"}),
+	}).Create(productTranslation).Error; err != nil {
+		return nil, errors.New("保存翻译失败")
+	}
+	// 覆盖已有翻译时返回已有的记录
+	var savedTranslation models.ProductTranslation
+	if err := db.DB.Where("product_id = ? and language = ?", productID, language).First(&savedTranslation).Error; err != nil {
+		return nil, errors.New("获取翻译失败")
+	}
+	return &savedTranslation, nil
+}
+
+func DeleteProductTranslations(ids []uuid.UUID) error {
+	result := db.DB.Where("id in ?", ids).Delete(&models.ProductTranslation{})
+	if result.Error != nil {
+		return errors.New("删除翻译失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("not_found")
+	}
+	return nil
+}
+
+// 使用指定语言的翻译替换商品名称和描述,没有翻译的保持原样
+func TranslateProducts(language string, products []models.Product) {
+	if len(products) == 0 {
+		return
+	}
+	productIDs := make([]uuid.UUID, 0, len(products))
+	for _, product := range products {
+		productIDs = append(productIDs, product.ID)
+	}
+	var productTranslations []models.ProductTranslation
+	if err := db.DB.Where("product_id in ? and language = ?", productIDs, language).Find(&productTranslations).Error; err != nil {
+		return
+	}
+
+	translations := make(map[uuid.UUID]models.ProductTranslation)
+	for _, productTranslation := range productTranslations {
+		translations[productTranslation.ProductID] = productTranslation
+	}
+	for i := range products {
+		translation, ok := translations[products[i].ID]
+		if !ok {
+			continue
+		}
+		if translation.Name != "" {
+			products[i].Name = translation.Name
+		}
+		if translation.Description != "" {
+			products[i].Description = translation.Description
+		}
+	}
+}
+
+func TranslateProduct(language string, product *models.Product) {
+	products := []models.Product{*product}
+	TranslateProducts(language, products)
+	*product = products[0]
+}
+
+// 翻译分页中的商品
+func TranslatePaginationProducts(language string, pagination *Pagination) {
+	products := make([]models.Product, 0, len(pagination.Items))
+	for _, item := range pagination.Items {
+		products = append(products, item.(models.Product))
+	}
+	TranslateProducts(language, products)
+	for i, product := range products {
+		pagination.Items[i] = product
+	}
+}
+
+// 翻译订单中的商品
+func TranslateOrderProducts(language string, orders []models.Order) {
+	products := make([]models.Product, 0, len(orders))
+	for _, order := range orders {
+		products = append(products, order.Product)
+	}
+	TranslateProducts(language, products)
+	for i := range orders {
+		orders[i].Product = products[i]
+	}
+}
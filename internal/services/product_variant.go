@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+)
+
+func GetProductVariants(productID uuid.UUID) ([]models.ProductVariant, error) {
+	var productVariants []models.ProductVariant
+	if result := db.DB.Where("product_id = ?", productID).Order((&models.ProductVariant{}).DefaultOrder()).Find(&productVariants); result.Error != nil {
+		return nil, errors.New("获取商品规格失败")
+	}
+	return productVariants, nil
+}
+
+// 获取上架商品的规格,同时返回商品
+func GetProductVariantByIDByCustomer(variantID uuid.UUID) (models.ProductVariant, error) {
+	var productVariant models.ProductVariant
+	if result := db.DB.Preload("Product").Where("id = ?", variantID).Find(&productVariant); result.Error != nil {
+		return productVariant, errors.New("获取商品规格失败")
+	} else if result.RowsAffected == 0 || productVariant.Product.Status != 1 {
+		return productVariant, errors.New("商品规格不存在")
+	}
+	return productVariant, nil
+}
+
+// 下单时的规格,有规格的商品必须选择规格,没有规格的商品不能传规格
+func getOrderVariant(productID uuid.UUID, variantID *uuid.UUID) (*models.ProductVariant, error) {
+	if variantID == nil {
+		var variantCount int64
+		if result := db.DB.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Count(&variantCount); result.Error != nil {
+			return nil, errors.New("获取商品规格失败")
+		}
+		if variantCount > 0 {
+			return nil, errors.New("请选择商品规格")
+		}
+		return nil, nil
+	}
+
+	var productVariant models.ProductVariant
+	if result := db.DB.Where("id = ? and product_id = ?", *variantID, productID).Find(&productVariant); result.Error != nil {
+		return nil, errors.New("获取商品规格失败")
+	} else if result.RowsAffected == 0 {
+		return nil, errors.New("商品规格不存在")
+	}
+	return &productVariant, nil
+}
+
+// 添加商品项目时校验规格,有规格的商品项目必须属于其中一个规格
+func CheckProductItemVariant(productID uuid.UUID, variantID *uuid.UUID) error {
+	_, err := getOrderVariant(productID, variantID)
+	return err
+}
+
+func CreateProductVariant(productVariant *models.ProductVariant) error {
+	if _, err := GetProductByID(productVariant.ProductID); err != nil {
+		return err
+	}
+
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	// 商品第一次添加规格时,已有的无规格库存归入该规格,避免无法售出
+	if result := tx.Create(productVariant); result.Error != nil {
+		return errors.New("创建商品规格失败")
+	}
+	if result := tx.Model(&models.ProductItem{}).Where("product_id = ? and variant_id is null and status in (0,1)", productVariant.ProductID).Update("variant_id", productVariant.ID); result.Error != nil {
+		return errors.New("更新商品项目失败")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.New("提交失败, " + err.Error())
+	}
+	return UpdateProductInStockCount([]uuid.UUID{productVariant.ProductID})
+}
+
+func UpdateProductVariant(variantID uuid.UUID, updateMap map[string]interface{}) error {
+	result := db.DB.Model(&models.ProductVariant{}).Where("id = ?", variantID).Updates(updateMap)
+	if result.RowsAffected == 0 {
+		return errors.New("not_found")
+	}
+	return nil
+}
+
+// 删除规格,未售出的商品项目一并删除,已售出的保留在订单中
+func DeleteProductVariants(variantIDs []uuid.UUID) error {
+	var productIDs []uuid.UUID
+	if result := db.DB.Model(&models.ProductVariant{}).Where("id in ?", variantIDs).Distinct().Pluck("product_id", &productIDs); result.Error != nil {
+		return errors.New("获取商品规格失败")
+	} else if len(productIDs) == 0 {
+		return errors.New("not_found")
+	}
+
+	// 待支付和等待补货的订单需要该规格的项目,处理完成后才能删除
+	var lockedItemCount, awaitStockOrderCount int64
+	db.DB.Model(&models.ProductItem{}).Where("variant_id in ? and status = 0", variantIDs).Count(&lockedItemCount)
+	db.DB.Model(&models.Order{}).Where("variant_id in ? and status = 1 and await_stock = ?", variantIDs, true).Count(&awaitStockOrderCount)
+	if lockedItemCount > 0 {
+		return errors.New("规格有待支付订单,请稍后再删除")
+	}
+	if awaitStockOrderCount > 0 {
+		return errors.New("规格有等待补货的订单,请补货或退款后再删除")
+	}
+
+	var unsoldItems []models.ProductItem
+	if result := db.DB.Select("id", "file_key").Where("variant_id in ? and status = 1", variantIDs).Find(&unsoldItems); result.Error != nil {
+		return errors.New("获取商品项目失败")
+	}
+
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	if result := tx.Where("variant_id in ? and status = 1", variantIDs).Delete(&models.ProductItem{}); result.Error != nil {
+		return errors.New("删除商品项目失败")
+	}
+	if result := tx.Model(&models.ProductItem{}).Where("variant_id in ?", variantIDs).Update("variant_id", nil); result.Error != nil {
+		return errors.New("更新商品项目失败")
+	}
+	if result := tx.Model(&models.Order{}).Where("variant_id in ?", variantIDs).Update("variant_id", nil); result.Error != nil {
+		return errors.New("更新订单失败")
+	}
+	if result := tx.Where("id in ?", variantIDs).Delete(&models.ProductVariant{}); result.Error != nil {
+		return errors.New("删除商品规格失败")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.New("提交失败, " + err.Error())
+	}
+	deleteProductItemFiles(unsoldItems)
+	return UpdateProductInStockCount(productIDs)
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"gopay/internal/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 计入限购数量的订单状态:待支付、已支付、部分退款
+var purchaseLimitOrderStatuses = []int{0, 1, 3}
+
+// 超出限购数量,机器人以弹窗提示用户
+type PurchaseLimitError struct {
+	*TextError
+}
+
+func IsPurchaseLimitError(err error) bool {
+	var limitErr *PurchaseLimitError
+	return errors.As(err, &limitErr)
+}
+
+// 限购周期的开始时间,永久限购返回0
+func purchaseLimitPeriodStart(period int, now time.Time) int64 {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case models.PurchaseLimitPeriodDay:
+		return today.Unix()
+	case models.PurchaseLimitPeriodWeek:
+		// 每周从周一开始
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7).Unix()
+	}
+	return 0
+}
+
+// 超出用户限购的提示,每个周期使用完整的句子便于翻译
+func purchaseLimitFormat(period int) string {
+	switch period {
+	case models.PurchaseLimitPeriodDay:
+		return "该商品每人每天限购%d件, 你已购买%d件(包括待支付订单)"
+	case models.PurchaseLimitPeriodWeek:
+		return "该商品每人每周限购%d件, 你已购买%d件(包括待支付订单)"
+	}
+	return "该商品每人限购%d件, 你已购买%d件(包括待支付订单)"
+}
+
+func ValidatePurchaseLimitPeriod(period int) error {
+	if period != models.PurchaseLimitPeriodLifetime && period != models.PurchaseLimitPeriodDay && period != models.PurchaseLimitPeriodWeek {
+		return errors.New("限购周期错误")
+	}
+	return nil
+}
+
+// 检查用户限购和每日限量,待支付的订单同样计入,需在锁定商品后调用
+func checkPurchaseLimit(tx *gorm.DB, product models.Product, tgChatID int64) error {
+	now := time.Now()
+	if product.UserPurchaseLimit > 0 {
+		var count int64
+		if err := tx.Model(&models.Order{}).Where("product_id = ? and tg_chat_id = ? and status in ? and create_time >= ?",
+			product.ID, tgChatID, purchaseLimitOrderStatuses, purchaseLimitPeriodStart(product.UserPurchaseLimitPeriod, now)).Count(&count).Error; err != nil {
+			return errors.New("查询购买记录失败")
+		}
+		if count >= int64(product.UserPurchaseLimit) {
+			return &PurchaseLimitError{newTextError(purchaseLimitFormat(product.UserPurchaseLimitPeriod), product.UserPurchaseLimit, count)}
+		}
+	}
+	if product.DailyPurchaseLimit > 0 {
+		var count int64
+		if err := tx.Model(&models.Order{}).Where("product_id = ? and status in ? and create_time >= ?",
+			product.ID, purchaseLimitOrderStatuses, purchaseLimitPeriodStart(models.PurchaseLimitPeriodDay, now)).Count(&count).Error; err != nil {
+			return errors.New("查询购买记录失败")
+		}
+		if count >= int64(product.DailyPurchaseLimit) {
+			return &PurchaseLimitError{newTextError("该商品每天限量%d件, 今日已售完, 请明天再来", product.DailyPurchaseLimit)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"github.com/google/uuid"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"testing"
+	"time"
+)
+
+func TestPurchaseLimitPeriodStart(t *testing.T) {
+	location := time.FixedZone("UTC+8", 8*3600)
+	date := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		period int
+		now    string
+		start  string
+	}{
+		{models.PurchaseLimitPeriodDay, "2026-10-21 00:00", "2026-10-21 00:00"},
+		{models.PurchaseLimitPeriodDay, "2026-10-21 23:59", "2026-10-21 00:00"},
+		// 每周从周一开始,周日仍属于上周一开始的周期
+		{models.PurchaseLimitPeriodWeek, "2026-10-19 00:00", "2026-10-19 00:00"},
+		{models.PurchaseLimitPeriodWeek, "2026-10-21 13:00", "2026-10-19 00:00"},
+		{models.PurchaseLimitPeriodWeek, "2026-10-25 23:59", "2026-10-19 00:00"},
+		{models.PurchaseLimitPeriodWeek, "2026-10-26 00:01", "2026-10-26 00:00"},
+	}
+	for _, test := range tests {
+		if start := purchaseLimitPeriodStart(test.period, date(test.now)); start != date(test.start).Unix() {
+			t.Errorf("周期 %d 时间 %s 的开始时间为 %s, 应为 %s", test.period, test.now, time.Unix(start, 0).In(location), test.start)
+		}
+	}
+	if start := purchaseLimitPeriodStart(models.PurchaseLimitPeriodLifetime, date("2026-10-21 13:00")); start != 0 {
+		t.Errorf("永久限购的开始时间为 %d, 应为 0", start)
+	}
+}
+
+func TestCheckPurchaseLimitOrderStatuses(t *testing.T) {
+	setupTestDB(t)
+	product := models.Product{ID: uuid.New(), UserPurchaseLimit: 2, UserPurchaseLimitPeriod: models.PurchaseLimitPeriodLifetime}
+
+	// 全部退款、超时和关闭的订单不计入
+	for _, status := range []int{2, 2, -1, -2} {
+		createTestOrder(t, &models.Order{Status: status, ProductID: &product.ID, TGChatID: 1})
+	}
+	if err := checkPurchaseLimit(db.DB, product, 1); err != nil {
+		t.Fatalf("不应超出限购: %v", err)
+	}
+
+	// 部分退款的订单计入
+	createTestOrder(t, &models.Order{Status: 3, ProductID: &product.ID, TGChatID: 1})
+	if err := checkPurchaseLimit(db.DB, product, 1); err != nil {
+		t.Fatalf("不应超出限购: %v", err)
+	}
+	createTestOrder(t, &models.Order{Status: 0, ProductID: &product.ID, TGChatID: 1})
+	if err := checkPurchaseLimit(db.DB, product, 1); !IsPurchaseLimitError(err) {
+		t.Fatalf("应超出限购, 返回 %v", err)
+	}
+
+	// 其他用户不受影响
+	if err := checkPurchaseLimit(db.DB, product, 2); err != nil {
+		t.Fatalf("不应超出限购: %v", err)
+	}
+}
+
+func TestCheckDailyPurchaseLimit(t *testing.T) {
+	setupTestDB(t)
+	product := models.Product{ID: uuid.New(), DailyPurchaseLimit: 2}
+
+	// 昨天的订单不计入每日限量
+	yesterday := time.Now().AddDate(0, 0, -1).Unix()
+	createTestOrder(t, &models.Order{Status: 1, ProductID: &product.ID, TGChatID: 1, CreateTime: yesterday})
+	createTestOrder(t, &models.Order{Status: 1, ProductID: &product.ID, TGChatID: 2})
+	if err := checkPurchaseLimit(db.DB, product, 3); err != nil {
+		t.Fatalf("不应超出每日限量: %v", err)
+	}
+	createTestOrder(t, &models.Order{Status: 3, ProductID: &product.ID, TGChatID: 3})
+	if err := checkPurchaseLimit(db.DB, product, 4); !IsPurchaseLimitError(err) {
+		t.Fatalf("应超出每日限量, 返回 %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/exts/tg_bot"
+	"gopay/internal/models"
+	"gopay/internal/utils/crypto_api"
+	"gopay/internal/utils/crypto_api/tron"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// 订单可退款金额,已完成订单的超额支付已存入余额,只能退订单金额部分
+func refundableAmount(order models.Order) decimal.Decimal {
+	return refundBase(order).Sub(order.RefundedPrice)
+}
+
+func refundBase(order models.Order) decimal.Decimal {
+	if order.Status == 1 || order.Status == 2 || order.Status == 3 {
+		return decimal.Min(order.PaidPrice, order.Price)
+	}
+	return order.PaidPrice
+}
+
+// 订单付款交易的付款地址,多个不同地址时需要管理员指定
+func orderSenderAddress(orderID uuid.UUID) (string, error) {
+	var transfers []models.Transfer
+	if result := db.DB.Where("order_id = ? and price > 0", orderID).Find(&transfers); result.Error != nil {
+		return "", errors.New("查询订单交易失败")
+	}
+	var address string
+	for _, transfer := range transfers {
+		if address != "" && address != transfer.FromAddress {
+			return "", errors.New("订单有多个付款地址,请指定退款地址")
+		}
+		address = transfer.FromAddress
+	}
+	if address == "" {
+		return "", errors.New("没有找到付款交易,请指定退款地址")
+	}
+	return address, nil
+}
+
+// 创建待确认的退款,amount为订单货币金额,toAddress为空时使用付款地址
+// cate 1.链上原路退回 2.退回余额; itemAction 0.保留 1.退回库存 2.作废
+func CreateRefund(orderID uuid.UUID, cate int, amount decimal.Decimal, toAddress string, itemAction int, remark string) (*models.Refund, error) {
+	if cate != 1 && cate != 2 {
+		return nil, errors.New("退款方式错误")
+	}
+	if itemAction < 0 || itemAction > 2 {
+		return nil, errors.New("商品项目处理方式错误")
+	}
+	if !amount.GreaterThan(decimal.Zero) {
+		return nil, errors.New("退款金额必须大于0")
+	}
+
+	var order models.Order
+	if result := db.DB.Where("id = ?", orderID).Find(&order); result.Error != nil {
+		return nil, errors.New("获取订单错误")
+	} else if result.RowsAffected == 0 {
+		return nil, errors.New("没有该订单")
+	}
+	if order.Cate != 0 {
+		return nil, errors.New("充值订单不支持退款,请调整用户余额")
+	}
+	if order.Status == 0 {
+		return nil, errors.New("订单待支付,请先关闭订单")
+	}
+	if amount.GreaterThan(refundableAmount(order)) {
+		return nil, fmt.Errorf("退款金额超过可退金额 %s %s", refundableAmount(order), order.Currency)
+	}
+	if itemAction != 0 && order.Status != 1 && order.Status != 3 {
+		return nil, errors.New("订单未完成,没有可处理的商品项目")
+	}
+
+	var pendingCount int64
+	if err := db.DB.Model(&models.Refund{}).Where("order_id = ? and status in ?", orderID, []int{0, 2, 3}).Count(&pendingCount).Error; err != nil {
+		return nil, errors.New("查询退款失败")
+	}
+	if pendingCount > 0 {
+		return nil, errors.New("订单有未完成的退款,请先确认或取消")
+	}
+
+	if cate == 1 {
+		if order.Network == config.BalancePaymentMethod {
+			return nil, errors.New("余额支付的订单只能退回余额")
+		}
+		if config.Network(order.Network) != config.TRON {
+			return nil, errors.New("该主网不支持链上退款")
+		}
+		if toAddress == "" {
+			address, err := orderSenderAddress(order.ID)
+			if err != nil {
+				return nil, err
+			}
+			toAddress = address
+		}
+		client := tron.New(config.SiteConfig.TronGridApiKey)
+		if !client.ValidateAddress(toAddress) {
+			return nil, errors.New("退款地址格式错误")
+		}
+		var walletCount int64
+		if err := db.DB.Model(&models.Wallet{}).Where("address = ?", toAddress).Count(&walletCount).Error; err != nil {
+			return nil, errors.New("查询钱包失败")
+		}
+		if walletCount > 0 {
+			return nil, errors.New("退款地址不能是收款钱包")
+		}
+	} else {
+		toAddress = ""
+	}
+
+	refund := models.NewRefund(order.ID, cate, order.Currency, order.Network, amount, toAddress, itemAction, remark)
+	if err := db.DB.Create(refund).Error; err != nil {
+		return nil, errors.New("创建退款失败")
+	}
+	return refund, nil
+}
+
+// 取消未发送的退款
+func CancelRefund(refundID uuid.UUID) error {
+	if result := db.DB.Model(&models.Refund{}).Where("id = ? and status in ?", refundID, []int{0, 2}).Update("status", -1); result.Error != nil {
+		return errors.New("更新退款失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("退款不是待确认或发送失败状态")
+	}
+	return nil
+}
+
+// 确认并执行退款,链上退款需要再次输入退款地址,发送前检查钱包余额,发送失败可再次确认
+func ConfirmRefund(refundID uuid.UUID, confirmAddress string) (*models.Refund, error) {
+	var refund models.Refund
+	if result := db.DB.Where("id = ?", refundID).Find(&refund); result.Error != nil {
+		return nil, errors.New("获取退款错误")
+	} else if result.RowsAffected == 0 {
+		return nil, errors.New("没有该退款")
+	}
+	if refund.Status != 0 && refund.Status != 2 {
+		return nil, errors.New("退款不是待确认或发送失败状态")
+	}
+
+	if refund.Cate == 1 {
+		if confirmAddress != refund.ToAddress {
+			return nil, errors.New("确认地址与退款地址不一致")
+		}
+		txID, err := sendRefund(refund)
+		if err != nil {
+			return nil, err
+		}
+		refund.TxID = txID
+	}
+
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	var order models.Order
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", refund.OrderID).Find(&order); result.Error != nil {
+		return nil, errors.New("获取订单错误")
+	}
+	// 链上已发送的退款必须入账,只有退回余额时才检查可退金额
+	if refund.Cate == 2 && refund.Amount.GreaterThan(refundableAmount(order)) {
+		return nil, errors.New("退款金额超过可退金额")
+	}
+	if err := applyRefund(tx, &refund, &order); err != nil {
+		recordSentRefundError(refund, err)
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		err = errors.New("提交失败, " + err.Error())
+		recordSentRefundError(refund, err)
+		return nil, err
+	}
+
+	if refund.ItemAction == 1 && order.ProductID != nil {
+		UpdateProductInStockCount([]uuid.UUID{*order.ProductID})
+	}
+
+	order.Product = models.Product{}
+	if order.ProductID != nil {
+		db.DB.Where("id = ?", *order.ProductID).Find(&order.Product)
+	}
+	SendRefundNotify(order, refund)
+	return &refund, nil
+}
+
+// 链上退款已发送但入账失败时,在事务外记录交易ID和错误,退款保持发送中,由管理员核对交易后处理
+func recordSentRefundError(refund models.Refund, err error) {
+	if refund.Cate != 1 {
+		return
+	}
+	db.DB.Model(&models.Refund{}).Where("id = ?", refund.ID).Updates(map[string]interface{}{
+		"tx_id":      refund.TxID,
+		"last_error": "已发送但记录失败: " + err.Error(),
+	})
+}
+
+// 发送链上退款,失败时记录错误,已标记为发送中的退款改为发送失败
+func sendRefund(refund models.Refund) (string, error) {
+	txID, sending, err := doSendRefund(refund)
+	if err != nil {
+		fromStatuses := []int{0, 2}
+		if sending {
+			fromStatuses = []int{3}
+		}
+		db.DB.Model(&models.Refund{}).Where("id = ? and status in ?", refund.ID, fromStatuses).Updates(map[string]interface{}{
+			"status":     2,
+			"last_error": err.Error(),
+		})
+	}
+	return txID, err
+}
+
+// 检查余额后从订单收款钱包发送链上退款,发送前先标记为发送中,防止重复确认导致重复发送
+// sending表示是否已由本次调用标记为发送中
+func doSendRefund(refund models.Refund) (txID string, sending bool, err error) {
+	var order models.Order
+	if result := db.DB.Preload("Wallet").Where("id = ?", refund.OrderID).Find(&order); result.Error != nil || result.RowsAffected == 0 {
+		return "", false, errors.New("获取订单错误")
+	}
+	if order.WalletID == nil || order.Wallet.PrivateKey == nil || *order.Wallet.PrivateKey == "" {
+		return "", false, errors.New("收款钱包没有私钥,无法发送退款")
+	}
+	if order.RefundedPrice.Add(refund.Amount).GreaterThan(refundBase(order)) {
+		return "", false, errors.New("退款金额超过可退金额")
+	}
+
+	client := tron.New(config.SiteConfig.TronGridApiKey)
+	balance, err := client.GetBalance(order.Wallet.Address)
+	if err != nil {
+		return "", false, err
+	}
+	if balance[refund.Currency].LessThan(refund.Amount) {
+		return "", false, fmt.Errorf("钱包余额不足,当前 %s %s", balance[refund.Currency], refund.Currency)
+	}
+	if config.Currency(refund.Currency) != config.TRX && !balance[string(config.TRX)].GreaterThan(decimal.Zero) {
+		return "", false, errors.New("钱包没有TRX支付手续费")
+	}
+
+	if result := db.DB.Model(&models.Refund{}).Where("id = ? and status in ?", refund.ID, []int{0, 2}).Updates(map[string]interface{}{
+		"status":     3,
+		"last_error": "",
+	}); result.Error != nil {
+		return "", false, errors.New("更新退款失败")
+	} else if result.RowsAffected == 0 {
+		return "", false, errors.New("退款正在处理中")
+	}
+
+	account := crypto_api.Account{Address: order.Wallet.Address, PrivateKey: *order.Wallet.PrivateKey}
+	switch config.Currency(refund.Currency) {
+	case config.TRX:
+		txID, err = client.SendTRX(account, refund.ToAddress, refund.Amount)
+	case config.USDT:
+		txID, err = client.SendUSDT(account, refund.ToAddress, refund.Amount)
+	default:
+		err = errors.New("不支持的退款货币")
+	}
+	return txID, true, err
+}
+
+// 退款入账:更新订单已退金额和状态,处理商品项目,退回余额,记录订单事件
+func applyRefund(tx *gorm.DB, refund *models.Refund, order *models.Order) error {
+	// 链上退款已由本次确认标记为发送中,退回余额的退款在此抢占,防止重复入账
+	fromStatuses := []int{0, 2}
+	if refund.Cate == 1 {
+		fromStatuses = []int{3}
+	}
+	refund.Status = 1
+	refund.ConfirmTime = time.Now().Unix()
+	if result := tx.Model(&models.Refund{}).Where("id = ? and status in ?", refund.ID, fromStatuses).Updates(map[string]interface{}{
+		"status":       refund.Status,
+		"confirm_time": refund.ConfirmTime,
+		"tx_id":        refund.TxID,
+		"last_error":   "",
+	}); result.Error != nil {
+		return errors.New("更新退款失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("退款正在处理中")
+	}
+
+	oldStatus := order.Status
+	// 可退金额按退款前的状态计算,过期或关闭的订单退还已付款项后状态不变,不计入收入和已购数量
+	base := refundBase(*order)
+	order.RefundedPrice = order.RefundedPrice.Add(refund.Amount)
+	if oldStatus == 1 || oldStatus == 2 || oldStatus == 3 {
+		order.Status = 3
+		if !order.RefundedPrice.LessThan(base) {
+			order.Status = 2
+		}
+	}
+	// 预订订单退款后不再等待补货
+	order.AwaitStock = false
+	if result := tx.Model(&models.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"refunded_price": order.RefundedPrice,
+		"status":         order.Status,
+		"await_stock":    false,
+	}); result.Error != nil {
+		return errors.New("更新订单失败")
+	}
+
+	switch refund.ItemAction {
+	case 1:
+		if result := tx.Model(&models.ProductItem{}).Where("order_id = ? and status = -1", order.ID).Updates(map[string]interface{}{
+			"status":   1,
+			"order_id": nil,
+		}); result.Error != nil {
+			return errors.New("商品项目退回库存失败")
+		}
+	case 2:
+		if result := tx.Model(&models.ProductItem{}).Where("order_id = ? and status = -1", order.ID).Update("status", -2); result.Error != nil {
+			return errors.New("商品项目作废失败")
+		}
+	}
+
+	eventMessage := fmt.Sprintf("退款 %s %s 到 %s, 交易 %s", refund.Amount, refund.Currency, refund.ToAddress, refund.TxID)
+	if refund.Cate == 2 {
+		convertedAmount, err := config.ConvertCurrencyPrice(refund.Amount, config.Currency(refund.Currency), config.BalanceCurrency)
+		if err != nil {
+			return errors.New("获取汇率失败")
+		}
+		convertedAmount = convertedAmount.RoundFloor(2)
+		remark := fmt.Sprintf("订单退款 %s %s", refund.Amount, refund.Currency)
+		if _, err := ChangeUserBalance(tx, order.TGChatID, order.TGUsername, convertedAmount, 2, &order.ID, remark); err != nil {
+			return err
+		}
+		eventMessage = fmt.Sprintf("退款 %s %s 到余额", refund.Amount, refund.Currency)
+	}
+	return AddOrderEvent(tx, order.ID, &oldStatus, order.Status, models.OrderEventActorAdmin, nil, eventMessage)
+}
+
+func SendRefundNotify(order models.Order, refund models.Refund) error {
+	language := GetUserLanguage(order.TGChatID)
+	product := order.Product
+	TranslateProduct(language, &product)
+	msgText := config.RefundNotifyMsg(language, map[string]interface{}{
+		"Order":   order,
+		"Product": product,
+		"Refund":  refund,
+	})
+	msg := tgbotapi.NewMessage(order.TGChatID, msgText)
+	_, err := tg_bot.Bot.Send(msg)
+	return err
+}
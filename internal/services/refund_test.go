@@ -0,0 +1,111 @@
+package services
+
+import (
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"strconv"
+	"testing"
+)
+
+func confirmTestRefund(t *testing.T, order *models.Order, amount string) {
+	t.Helper()
+	refund := models.NewRefund(order.ID, 1, order.Currency, order.Network, decimal.RequireFromString(amount), "TTestAddress", 0, "")
+	refund.Status = 3
+	refund.TxID = "txid"
+	if err := db.DB.Create(refund).Error; err != nil {
+		t.Fatal(err)
+	}
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+	if err := applyRefund(tx, refund, order); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertTestOrder(t *testing.T, order models.Order, status int, refundedPrice string) {
+	t.Helper()
+	var saved models.Order
+	if err := db.DB.Where("id = ?", order.ID).First(&saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != status || !saved.RefundedPrice.Equal(decimal.RequireFromString(refundedPrice)) {
+		t.Fatalf("订单状态 %d 已退款 %s, 应为 %d %s", saved.Status, saved.RefundedPrice, status, refundedPrice)
+	}
+}
+
+func TestApplyRefundPaidOrder(t *testing.T) {
+	setupTestDB(t)
+	order := &models.Order{Status: 1, Price: decimal.NewFromInt(10), PaidPrice: decimal.NewFromInt(10)}
+	createTestOrder(t, order)
+
+	confirmTestRefund(t, order, "4")
+	assertTestOrder(t, *order, 3, "4")
+	if amount := refundableAmount(*order); !amount.Equal(decimal.NewFromInt(6)) {
+		t.Fatalf("可退金额 %s, 应为 6", amount)
+	}
+
+	confirmTestRefund(t, order, "6")
+	assertTestOrder(t, *order, 2, "10")
+}
+
+func TestApplyRefundOverpaidOrder(t *testing.T) {
+	setupTestDB(t)
+	// 超额支付的部分已入余额,退完订单金额即为全部退款
+	order := &models.Order{Status: 1, Price: decimal.NewFromInt(10), PaidPrice: decimal.NewFromInt(12)}
+	createTestOrder(t, order)
+
+	confirmTestRefund(t, order, "10")
+	assertTestOrder(t, *order, 2, "10")
+}
+
+func TestApplyRefundExpiredOrder(t *testing.T) {
+	for _, status := range []int{-1, -2} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			setupTestDB(t)
+			// 部分付款后过期或关闭的订单,退款只记录已退金额,状态不变
+			order := &models.Order{Status: status, Price: decimal.NewFromInt(10), PaidPrice: decimal.NewFromInt(5)}
+			createTestOrder(t, order)
+
+			confirmTestRefund(t, order, "2")
+			assertTestOrder(t, *order, status, "2")
+			if amount := refundableAmount(*order); !amount.Equal(decimal.NewFromInt(3)) {
+				t.Fatalf("可退金额 %s, 应为 3", amount)
+			}
+
+			confirmTestRefund(t, order, "3")
+			assertTestOrder(t, *order, status, "5")
+		})
+	}
+}
+
+func TestAssignTransferToRefundedOrder(t *testing.T) {
+	for _, status := range []int{1, 2, 3, -2} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			setupTestDB(t)
+			order := &models.Order{Status: status, Price: decimal.NewFromInt(10), PaidPrice: decimal.NewFromInt(10)}
+			createTestOrder(t, order)
+			transfer := models.NewTransfer("tx", config.Currency(order.Currency), config.Network(order.Network), "from", "to", decimal.NewFromInt(10), order.CreateTime)
+			transfer.Status = 2
+			if err := db.DB.Create(transfer).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := AssignTransferToOrder(transfer.ID, order.ID); err == nil {
+				t.Fatal("不能分配给已完成、已退款或关闭的订单")
+			}
+			assertTestOrder(t, *order, status, "0")
+			var saved models.Transfer
+			if err := db.DB.Where("id = ?", transfer.ID).First(&saved).Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved.Status != 2 || saved.OrderID != nil {
+				t.Fatalf("交易状态 %d, 不应绑定订单", saved.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// 订阅到货通知,重复订阅返回false
+func AddRestockSubscription(productID uuid.UUID, tgChatID int64, tgUsername string) (bool, error) {
+	restockSubscription := models.NewRestockSubscription(productID, tgChatID, tgUsername)
+	result := db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "tg_chat_id"}},
+		DoNothing: true,
+	}).Create(restockSubscription)
+	if result.Error != nil {
+		return false, errors.New("订阅失败")
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func GetRestockSubscriptions(productID uuid.UUID) ([]models.RestockSubscription, error) {
+	var restockSubscriptions []models.RestockSubscription
+	if result := db.DB.Where("product_id = ?", productID).Order("create_time asc").Find(&restockSubscriptions); result.Error != nil {
+		return nil, errors.New("获取到货通知订阅失败")
+	}
+	return restockSubscriptions, nil
+}
+
+func DeleteRestockSubscriptions(restockSubscriptionIDs []uuid.UUID) error {
+	if len(restockSubscriptionIDs) == 0 {
+		return nil
+	}
+	if result := db.DB.Where("id in ?", restockSubscriptionIDs).Delete(&models.RestockSubscription{}); result.Error != nil {
+		return errors.New("删除到货通知订阅失败")
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"fmt"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 每个测试使用独立的内存sqlite数据库,汇率使用固定汇率
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	config.SiteConfig = &config.SiteConfigStruct{
+		WalletType:            1,
+		OrderExpireDuration:   time.Minute * 10,
+		EnableFixExchangeRate: true,
+		FixedExchangeRate:     `{"USDT":"7","TRX":"0.7"}`,
+	}
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	testDB, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.AutoMigrate(&models.Order{}, &models.Transfer{}, &models.Wallet{}, &models.User{}, &models.BalanceLog{},
+		&models.Product{}, &models.ProductVariant{}, &models.ProductItem{},
+		&models.OrderEvent{}, &models.DeliveryOutbox{}, &models.Refund{}); err != nil {
+		t.Fatal(err)
+	}
+	db.DB = testDB
+	t.Cleanup(func() {
+		if sqlDB, err := testDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+func createTestOrder(t *testing.T, order *models.Order) {
+	t.Helper()
+	if order.Currency == "" {
+		order.Currency = string(config.USDT)
+	}
+	if order.Network == "" {
+		order.Network = string(config.TRON)
+	}
+	if err := db.DB.Create(order).Error; err != nil {
+		t.Fatal(err)
+	}
+}
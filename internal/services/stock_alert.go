@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"gopay/internal/exts/cache"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/exts/tg_bot"
+	"gopay/internal/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// Telegram消息的长度上限
+var messageTextMaxLength = 4096
+
+const (
+	stockLevelNormal = 0
+	stockLevelLow    = 1
+	stockLevelOut    = 2
+)
+
+// 在售商品或规格的库存,有规格的商品按规格统计
+type StockEntry struct {
+	ProductID    uuid.UUID  `json:"product_id"`
+	VariantID    *uuid.UUID `json:"variant_id"`
+	Name         string     `json:"name"`
+	InStockCount uint       `json:"in_stock_count"`
+	Threshold    uint       `json:"threshold"`
+}
+
+func (t StockEntry) key() string {
+	if t.VariantID != nil {
+		return t.VariantID.String()
+	}
+	return t.ProductID.String()
+}
+
+func (t StockEntry) level() int {
+	if t.InStockCount == 0 {
+		return stockLevelOut
+	} else if t.InStockCount < t.Threshold {
+		return stockLevelLow
+	}
+	return stockLevelNormal
+}
+
+// 获取在售的库存发货商品的库存,productIDs为空则获取全部
+func getStockEntries(productIDs []uuid.UUID) ([]StockEntry, error) {
+	var products []models.Product
+	query := db.DB.Preload("Variants").Where("status = 1 and delivery_type = ?", models.ProductDeliveryTypeItem)
+	if productIDs != nil {
+		query = query.Where("id in ?", productIDs)
+	}
+	if err := query.Order((&models.Product{}).DefaultOrder()).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	var stockEntries []StockEntry
+	for _, product := range products {
+		if len(product.Variants) == 0 {
+			stockEntries = append(stockEntries, StockEntry{
+				ProductID:    product.ID,
+				Name:         product.Name,
+				InStockCount: product.InStockCount,
+				Threshold:    product.LowStockThreshold,
+			})
+			continue
+		}
+		for _, variant := range product.Variants {
+			variantID := variant.ID
+			stockEntries = append(stockEntries, StockEntry{
+				ProductID:    product.ID,
+				VariantID:    &variantID,
+				Name:         product.Name + " - " + variant.Name,
+				InStockCount: variant.InStockCount,
+				Threshold:    product.LowStockThreshold,
+			})
+		}
+	}
+	return stockEntries, nil
+}
+
+// 对比更新库存前后的数量,库存降到阈值以下或售罄时提醒管理员,同一商品同一级别的提醒在间隔内只发送一次
+func notifyStockAlert(productIDs []uuid.UUID, beforeEntries []StockEntry) {
+	if len(beforeEntries) == 0 {
+		return
+	}
+	afterEntries, err := getStockEntries(productIDs)
+	if err != nil {
+		return
+	}
+	beforeLevels := make(map[string]int)
+	for _, entry := range beforeEntries {
+		beforeLevels[entry.key()] = entry.level()
+	}
+
+	var lines []string
+	for _, entry := range afterEntries {
+		beforeLevel, ok := beforeLevels[entry.key()]
+		if !ok || entry.level() <= beforeLevel {
+			continue
+		}
+		if !cache.Cache.Add(fmt.Sprintf("stock_alert_%s_%d", entry.key(), entry.level()), true, config.GetStockAlertInterval()) {
+			continue
+		}
+		if entry.level() == stockLevelOut {
+			lines = append(lines, fmt.Sprintf("%s 已售罄", entry.Name))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s 库存不足, 剩余: %d, 提醒阈值: %d", entry.Name, entry.InStockCount, entry.Threshold))
+		}
+	}
+	if len(lines) > 0 {
+		go tg_bot.SendAdmin("库存提醒\n" + strings.Join(lines, "\n"))
+	}
+}
+
+// 库存汇总,库存不足和售罄的排在前面
+func GetStockSummary() ([]StockEntry, error) {
+	stockEntries, err := getStockEntries(nil)
+	if err != nil {
+		return nil, err
+	}
+	var result []StockEntry
+	for _, level := range []int{stockLevelOut, stockLevelLow, stockLevelNormal} {
+		for _, entry := range stockEntries {
+			if entry.level() == level {
+				result = append(result, entry)
+			}
+		}
+	}
+	return result, nil
+}
+
+func StockSummaryText(stockEntries []StockEntry) string {
+	var outLines, lowLines, normalLines []string
+	for _, entry := range stockEntries {
+		switch entry.level() {
+		case stockLevelOut:
+			outLines = append(outLines, entry.Name)
+		case stockLevelLow:
+			lowLines = append(lowLines, fmt.Sprintf("%s: %d (阈值%d)", entry.Name, entry.InStockCount, entry.Threshold))
+		default:
+			normalLines = append(normalLines, fmt.Sprintf("%s: %d", entry.Name, entry.InStockCount))
+		}
+	}
+
+	text := "每日库存汇总"
+	if len(stockEntries) == 0 {
+		return text + "\n没有在售商品"
+	}
+	if len(outLines) > 0 {
+		text += fmt.Sprintf("\n\n已售罄(%d):\n%s", len(outLines), strings.Join(outLines, "\n"))
+	}
+	if len(lowLines) > 0 {
+		text += fmt.Sprintf("\n\n库存不足(%d):\n%s", len(lowLines), strings.Join(lowLines, "\n"))
+	}
+	if len(normalLines) > 0 {
+		text += fmt.Sprintf("\n\n库存充足(%d):\n%s", len(normalLines), strings.Join(normalLines, "\n"))
+	}
+	return text
+}
+
+// 发送库存汇总给管理员,超过消息长度上限时按行拆分发送
+func SendStockSummary() error {
+	stockEntries, err := GetStockSummary()
+	if err != nil {
+		return err
+	}
+	chunk := ""
+	for _, line := range strings.Split(StockSummaryText(stockEntries), "\n") {
+		if chunk != "" && utf8.RuneCountInString(chunk)+1+utf8.RuneCountInString(line) > messageTextMaxLength {
+			tg_bot.SendAdmin(chunk)
+			chunk = ""
+		}
+		if chunk != "" {
+			chunk += "\n"
+		}
+		chunk += line
+	}
+	if strings.TrimSpace(chunk) != "" {
+		tg_bot.SendAdmin(chunk)
+	}
+	return nil
+}
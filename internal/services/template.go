@@ -0,0 +1,382 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TemplateFile struct {
+	Name       string `json:"name"`
+	Language   string `json:"language"`
+	Inherited  bool   `json:"inherited"` // 该语言没有此模板,使用基础语言的模板
+	UpdateTime int64  `json:"update_time"`
+	Content    string `json:"content,omitempty"`
+}
+
+// 保存模板时写文件和重新加载需要串行
+var templateSaveLock sync.Mutex
+
+func checkTemplateName(language string, name string) (string, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		language = config.BaseLanguage
+	}
+	if !config.IsLanguageAvailable(language) {
+		return "", errors.New("语言不存在")
+	}
+	if !config.IsTemplateName(name) {
+		return "", errors.New("模板不存在")
+	}
+	return language, nil
+}
+
+// 读取模板文件,其他语言没有该模板时读取基础语言的
+func readTemplateFile(language string, name string) (*TemplateFile, error) {
+	templateFile := &TemplateFile{Name: name, Language: language}
+	path := config.GetTemplatePath(language, name)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) && language != config.BaseLanguage {
+		templateFile.Inherited = true
+		path = config.GetTemplatePath(config.BaseLanguage, name)
+		info, err = os.Stat(path)
+	}
+	if err != nil {
+		return nil, errors.New("读取模板失败")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("读取模板失败")
+	}
+	templateFile.UpdateTime = info.ModTime().Unix()
+	templateFile.Content = string(content)
+	return templateFile, nil
+}
+
+// 某种语言的全部模板,不包含内容
+func GetTemplates(language string) ([]TemplateFile, error) {
+	var templateFiles []TemplateFile
+	for _, name := range config.GetTemplateNames() {
+		checkedLanguage, err := checkTemplateName(language, name)
+		if err != nil {
+			return nil, err
+		}
+		templateFile, err := readTemplateFile(checkedLanguage, name)
+		if err != nil {
+			return nil, err
+		}
+		templateFile.Content = ""
+		templateFiles = append(templateFiles, *templateFile)
+	}
+	return templateFiles, nil
+}
+
+func GetTemplate(language string, name string) (*TemplateFile, error) {
+	language, err := checkTemplateName(language, name)
+	if err != nil {
+		return nil, err
+	}
+	return readTemplateFile(language, name)
+}
+
+// 使用示例数据渲染模板,content为空时渲染当前的模板
+func PreviewTemplate(language string, name string, content string) (string, error) {
+	language, err := checkTemplateName(language, name)
+	if err != nil {
+		return "", err
+	}
+	if content == "" {
+		templateFile, err := readTemplateFile(language, name)
+		if err != nil {
+			return "", err
+		}
+		content = templateFile.Content
+	}
+	msgText, err := config.RenderTemplate(language, name, content, templatePreviewData(language, name))
+	if err != nil {
+		return "", fmt.Errorf("模板错误: %v", err)
+	}
+	return msgText, nil
+}
+
+// 校验后保存模板并重新加载,同时记录版本;首次修改时先记录修改前的模板
+func SaveTemplate(language string, name string, content string, remark string) (*models.TemplateVersion, error) {
+	language, err := checkTemplateName(language, name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, errors.New("模板内容不能为空")
+	}
+	if _, err := PreviewTemplate(language, name, content); err != nil {
+		return nil, err
+	}
+
+	templateSaveLock.Lock()
+	defer templateSaveLock.Unlock()
+	oldTemplateFile, err := readTemplateFile(language, name)
+	if err != nil {
+		return nil, err
+	}
+	if !oldTemplateFile.Inherited {
+		var count int64
+		if err := db.DB.Model(&models.TemplateVersion{}).Where("language = ? and name = ?", language, name).Count(&count).Error; err != nil {
+			return nil, errors.New("获取模板版本失败")
+		}
+		if count == 0 {
+			if err := db.DB.Create(models.NewTemplateVersion(language, name, oldTemplateFile.Content, "修改前的模板")).Error; err != nil {
+				return nil, errors.New("保存模板版本失败")
+			}
+		}
+	}
+
+	path := config.GetTemplatePath(language, name)
+	if err := writeTemplateFile(path, content); err != nil {
+		return nil, errors.New("写入模板失败")
+	}
+	if err := config.ReloadTemplates(); err != nil {
+		// 恢复原来的模板,继承基础语言的模板时删除新建的文件
+		if oldTemplateFile.Inherited {
+			os.Remove(path)
+		} else {
+			writeTemplateFile(path, oldTemplateFile.Content)
+		}
+		config.ReloadTemplates()
+		return nil, fmt.Errorf("加载模板失败: %v", err)
+	}
+
+	templateVersion := models.NewTemplateVersion(language, name, content, remark)
+	if err := db.DB.Create(templateVersion).Error; err != nil {
+		return nil, errors.New("模板已保存,但保存模板版本失败")
+	}
+	return templateVersion, nil
+}
+
+// 先写临时文件再替换,避免重新加载时读到写了一半的模板
+func writeTemplateFile(path string, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// 把模板恢复为某个版本的内容,恢复也会记录为新版本
+func RollbackTemplate(versionID uuid.UUID) (*models.TemplateVersion, error) {
+	var templateVersion models.TemplateVersion
+	if err := db.DB.Where("id = ?", versionID).First(&templateVersion).Error; err != nil {
+		return nil, errors.New("模板版本不存在")
+	}
+	remark := fmt.Sprintf("回滚到 %s 的版本", time.Unix(templateVersion.CreateTime, 0).Format("2006-01-02 15:04:05"))
+	return SaveTemplate(templateVersion.Language, templateVersion.Name, templateVersion.Content, remark)
+}
+
+// 预览使用的示例数据,与机器人发送消息时传入模板的数据一致
+func templatePreviewData(language string, name string) map[string]interface{} {
+	now := time.Now().Unix()
+	categoryID := uuid.New()
+	product := models.Product{
+		ID:           uuid.New(),
+		Name:         "示例商品",
+		Description:  "这是示例商品的描述",
+		Status:       1,
+		CreateTime:   now,
+		InStockCount: 10,
+		CategoryID:   &categoryID,
+		Currency:     string(config.CNY),
+		Price:        decimal.NewFromInt(100),
+		InputFields: models.InputFieldList{
+			{Key: "account", Label: "充值账号", Type: "text", Required: true},
+		},
+		UserPurchaseLimit:       2,
+		UserPurchaseLimitPeriod: models.PurchaseLimitPeriodDay,
+	}
+	variant := models.ProductVariant{
+		ID:           uuid.New(),
+		Name:         "月卡",
+		Price:        decimal.NewFromInt(30),
+		InStockCount: 5,
+		ProductID:    product.ID,
+	}
+	inputData := models.JSONField{"account": "example@example.com"}
+	order := models.Order{
+		ID:                uuid.New(),
+		Status:            1,
+		CreateTime:        now - 600,
+		EndTime:           now,
+		Currency:          string(config.USDT),
+		Network:           string(config.TRON),
+		Price:             decimal.RequireFromString("14.0001"),
+		PaidPrice:         decimal.RequireFromString("14.0001"),
+		BaseCurrency:      product.Currency,
+		BaseCurrencyPrice: product.Price,
+		WalletAddress:     "TXYZexampleWalletAddress0000000000",
+		ProductID:         &product.ID,
+		Product:           product,
+		VariantID:         &variant.ID,
+		VariantName:       variant.Name,
+		TGUsername:        "example",
+		TGChatID:          123456789,
+		InputData:         &inputData,
+	}
+	productItem := models.ProductItem{
+		ID:        uuid.New(),
+		Status:    -1,
+		Content:   "示例卡密 XXXX-XXXX-XXXX",
+		ProductID: product.ID,
+		OrderID:   &order.ID,
+	}
+	user := models.User{
+		ID:         uuid.New(),
+		CreateTime: now,
+		TGChatID:   order.TGChatID,
+		TGUsername: order.TGUsername,
+		Balance:    decimal.NewFromInt(50),
+		Language:   language,
+	}
+
+	switch name {
+	case "product_list.tpl":
+		return map[string]interface{}{
+			"Category": &models.Category{ID: categoryID, Name: "示例分类", Icon: "📦", Status: 1},
+		}
+	case "product_detail.tpl":
+		salePrice := decimal.NewFromInt(80)
+		return map[string]interface{}{
+			"Product": product,
+			"Sale": &ProductSale{
+				Price:         salePrice,
+				OriginalPrice: product.Price,
+				EndTime:       now + 86400 + 3600,
+				Limited:       true,
+				Remaining:     3,
+			},
+			"Language": language,
+		}
+	case "pay_order.tpl":
+		pendingOrder := order
+		pendingOrder.Status = 0
+		pendingOrder.PaidPrice = decimal.Zero
+		pendingOrder.EndTime = now + 1800
+		return map[string]interface{}{
+			"Order":     pendingOrder,
+			"Checked":   true,
+			"CheckTime": now,
+		}
+	case "order_callback.tpl":
+		return map[string]interface{}{
+			"Order":       order,
+			"Product":     product,
+			"ProductItem": productItem,
+			"Inputs":      order.InputEntries(product.InputFields),
+		}
+	case "pre_order_callback.tpl":
+		return map[string]interface{}{
+			"Order":   order,
+			"Product": product,
+			"Inputs":  order.InputEntries(product.InputFields),
+		}
+	case "balance.tpl":
+		return map[string]interface{}{
+			"User":            user,
+			"BalanceCurrency": config.BalanceCurrency,
+		}
+	case "deposit_callback.tpl":
+		depositOrder := order
+		depositOrder.Cate = 1
+		depositOrder.ProductID = nil
+		depositOrder.Product = models.Product{}
+		depositOrder.VariantID = nil
+		depositOrder.VariantName = ""
+		return map[string]interface{}{
+			"Order":           depositOrder,
+			"User":            user,
+			"BalanceCurrency": config.BalanceCurrency,
+		}
+	case "order_expired.tpl":
+		expiredOrder := order
+		expiredOrder.Status = -1
+		return map[string]interface{}{
+			"Order":   expiredOrder,
+			"Product": product,
+		}
+	case "order_remind.tpl":
+		pendingOrder := order
+		pendingOrder.Status = 0
+		pendingOrder.EndTime = now + 300
+		return map[string]interface{}{
+			"Order": pendingOrder,
+		}
+	case "pending_order_list.tpl":
+		pendingOrder := order
+		pendingOrder.Status = 0
+		pendingOrder.EndTime = now + 1800
+		return map[string]interface{}{
+			"Orders":           []models.Order{pendingOrder},
+			"MaxPendingOrders": config.GetMaxPendingOrders(),
+		}
+	case "restock_notify.tpl":
+		return map[string]interface{}{
+			"Product": product,
+		}
+	case "refund_notify.tpl":
+		return map[string]interface{}{
+			"Order":   order,
+			"Product": product,
+			"Refund": models.Refund{
+				ID:          uuid.New(),
+				Status:      1,
+				Cate:        1,
+				CreateTime:  now,
+				ConfirmTime: now,
+				Currency:    order.Currency,
+				Network:     order.Network,
+				Amount:      order.Price,
+				ToAddress:   order.WalletAddress,
+				TxID:        "exampletxid0000000000000000000000",
+				Remark:      "示例退款备注",
+				OrderID:     order.ID,
+			},
+		}
+	case "input_field_prompt.tpl":
+		return map[string]interface{}{
+			"Product":     product,
+			"VariantName": variant.Name,
+			"Field":       product.InputFields[0],
+			"Step":        1,
+			"Total":       len(product.InputFields),
+			"Error":       "",
+		}
+	case "input_field_confirm.tpl":
+		return map[string]interface{}{
+			"Product":       product,
+			"VariantName":   variant.Name,
+			"Inputs":        order.InputEntries(product.InputFields),
+			"PaymentMethod": fmt.Sprintf("%s-%s", order.Currency, order.Network),
+		}
+	case "product_share.tpl":
+		return map[string]interface{}{
+			"Product": product,
+			"Price":   product.Price.String(),
+			"OnSale":  false,
+		}
+	case "product_search.tpl":
+		return map[string]interface{}{
+			"Keyword": "示例",
+			"Total":   int64(1),
+		}
+	}
+	return map[string]interface{}{}
+}
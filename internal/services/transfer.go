@@ -1 +1,468 @@
 package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gopay/internal/utils/crypto_api/tron"
+	"gopay/internal/utils/functions"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sync"
+	"time"
+)
+
+// 定时扫描和用户主动查询都会处理链上交易,串行处理防止同一笔交易重复入库
+var processTransfersLock = &sync.Mutex{}
+
+// 交易绑定到订单后结算订单,必须在事务中调用,且交易要先在事务中创建,不然查已付价格查不到
+// 已付金额大于等于订单价格则订单完成,解锁钱包,出库商品项目,结算余额,否则只更新已付金额
+// 同一个订单重复结算结果一致,actor和transferID用于记录订单事件
+func SettleOrderPayment(tx *gorm.DB, order *models.Order, paidTime int64, actor string, transferID *uuid.UUID) error {
+	orderPaidPrice := OrderPaidPrice(*order, tx)
+	if orderPaidPrice.LessThan(order.Price) {
+		if err := AddOrderEvent(tx, order.ID, &order.Status, order.Status, actor, transferID, fmt.Sprintf("部分付款 %s/%s %s", orderPaidPrice, order.Price, order.Currency)); err != nil {
+			return err
+		}
+
+		// 更新订单已付金额
+		order.PaidPrice = orderPaidPrice
+		if result := tx.Model(&models.Order{}).Where("id=?", order.ID).Updates(map[string]interface{}{
+			"paid_price": orderPaidPrice,
+		}); result.Error != nil {
+			return errors.New("更新订单已付金额失败")
+		}
+		// 充值订单部分付款也先入账
+		if order.Cate == 1 {
+			if err := SettleOrderBalance(tx, order); err != nil {
+				return fmt.Errorf("结算余额失败, %v", err)
+			}
+		}
+		return nil
+	}
+
+	// 解锁任意金额钱包，只有未超时订单才解锁钱包，因为超时订单也能完成，防止区块链延迟
+	// 要放在订单状态更新前判断
+	if order.Status == 0 && order.WalletType == 1 && order.WalletID != nil {
+		if result := tx.Model(&models.Wallet{}).Where("id=? and status=0", order.WalletID).Updates(map[string]interface{}{
+			"status": 1,
+		}); result.Error != nil {
+			return errors.New("解锁钱包失败")
+		}
+	}
+
+	if order.Status != 1 {
+		oldStatus := order.Status
+		if err := AddOrderEvent(tx, order.ID, &oldStatus, 1, actor, transferID, fmt.Sprintf("付款完成 %s/%s %s", orderPaidPrice, order.Price, order.Currency)); err != nil {
+			return err
+		}
+	}
+
+	// 更新订单完成
+	order.Status = 1
+	order.EndTime = paidTime
+	order.PaidPrice = orderPaidPrice
+	order.PriceIDForLock = nil
+	if result := tx.Model(&models.Order{}).Where("id=?", order.ID).Updates(map[string]interface{}{
+		"status":            1,
+		"end_time":          paidTime,
+		"paid_price":        orderPaidPrice,
+		"price_id_for_lock": gorm.Expr("NULL"),
+	}); result.Error != nil {
+		return errors.New("更新订单完成失败")
+	}
+
+	if order.Cate == 0 {
+		if err := markOrderProductItemSold(tx, order); err != nil {
+			return err
+		}
+	}
+
+	// 充值订单入账余额,超额支付部分存入余额
+	if err := SettleOrderBalance(tx, order); err != nil {
+		return fmt.Errorf("结算余额失败, %v", err)
+	}
+
+	if err := AddDeliveryOutbox(tx, order.ID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 标记订单的商品项目为已售出
+// 超时后才到账的订单,商品项目可能已经被解锁,预订订单没有商品项目,此时重新取一个空闲项目,没有库存则等待补货
+func markOrderProductItemSold(tx *gorm.DB, order *models.Order) error {
+	if result := tx.Model(&models.ProductItem{}).Where("order_id = ?", order.ID).Updates(map[string]interface{}{
+		"status":        -1,
+		"end_lock_time": gorm.Expr("NULL"),
+	}); result.Error != nil {
+		return errors.New("更新商品项目失败")
+	}
+
+	var count int64
+	if err := tx.Model(&models.ProductItem{}).Where("order_id = ?", order.ID).Count(&count).Error; err != nil {
+		return errors.New("查询商品项目失败")
+	}
+	if count > 0 || order.ProductID == nil {
+		return nil
+	}
+	// 调用发货接口的商品没有商品项目
+	var product models.Product
+	if result := tx.Where("id = ?", order.ProductID).Find(&product); result.Error != nil {
+		return errors.New("查询商品失败")
+	}
+	if product.IsWebhookDelivery() {
+		return nil
+	}
+
+	bound, err := bindFreeProductItem(tx, order)
+	if err != nil {
+		return err
+	}
+	if awaitStock := !bound; awaitStock != order.AwaitStock {
+		order.AwaitStock = awaitStock
+		if result := tx.Model(&models.Order{}).Where("id=?", order.ID).Update("await_stock", order.AwaitStock); result.Error != nil {
+			return errors.New("更新订单失败")
+		}
+	}
+	return nil
+}
+
+// 给已付款的订单绑定一个空闲商品项目并标记为已售出,没有库存返回false
+func bindFreeProductItem(tx *gorm.DB, order *models.Order) (bool, error) {
+	var productItem models.ProductItem
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id=? and status=1", order.ProductID)
+	if order.VariantID != nil {
+		query = query.Where("variant_id = ?", *order.VariantID)
+	}
+	if result := query.Order("create_time asc").Limit(1).Find(&productItem); result.Error != nil {
+		return false, errors.New("获取商品项目失败")
+	} else if result.RowsAffected == 0 {
+		return false, nil
+	}
+	if result := tx.Model(&models.ProductItem{}).Where("id=?", productItem.ID).Updates(map[string]interface{}{
+		"status":        -1,
+		"order_id":      order.ID,
+		"end_lock_time": gorm.Expr("NULL"),
+	}); result.Error != nil {
+		return false, errors.New("更新商品项目失败")
+	}
+	return true, nil
+}
+
+// 将未匹配的入账交易手动分配给订单,订单结算完成后返回true
+func AssignTransferToOrder(transferID uuid.UUID, orderID uuid.UUID) (bool, error) {
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	var transfer models.Transfer
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? and status = 2", transferID).Find(&transfer); result.Error != nil {
+		return false, errors.New("查询交易失败")
+	} else if result.RowsAffected == 0 {
+		return false, errors.New("没有该待处理交易")
+	}
+	var wallet models.Wallet
+	if result := tx.Where("id = ?", transfer.WalletID).Find(&wallet); result.Error != nil {
+		return false, errors.New("查询钱包失败")
+	}
+
+	var order models.Order
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", orderID).Find(&order); result.Error != nil {
+		return false, errors.New("查询订单失败")
+	} else if result.RowsAffected == 0 {
+		return false, errors.New("没有该订单")
+	}
+	// 只能分配给待支付或超时的订单,已完成、已退款或关闭的订单再次结算会重复发货
+	if order.Status != 0 && order.Status != -1 {
+		return false, errors.New("只能分配给待支付或超时的订单")
+	}
+	if order.Network != transfer.Network || order.Currency != transfer.Currency {
+		return false, errors.New("交易与订单的主网或货币不一致")
+	}
+
+	// 交易分类,如果钱包为小数点钱包则为2,否则为1
+	cate := uint(1)
+	if wallet.Status == 2 {
+		cate = 2
+	}
+	if result := tx.Model(&models.Transfer{}).Where("id = ?", transfer.ID).Updates(map[string]interface{}{
+		"status":   3,
+		"cate":     cate,
+		"order_id": order.ID,
+	}); result.Error != nil {
+		return false, errors.New("更新交易失败")
+	}
+
+	if err := SettleOrderPayment(tx, &order, time.Now().Unix(), models.OrderEventActorAdmin, &transfer.ID); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, errors.New("提交失败, " + err.Error())
+	}
+
+	if order.Status == 1 && order.ProductID != nil {
+		UpdateProductInStockCount([]uuid.UUID{*order.ProductID})
+	}
+	return order.Status == 1, nil
+}
+
+// 将未匹配的入账交易标记为已退款或已忽略
+func ResolveTransfers(transferIDs []uuid.UUID, status int, remark string) error {
+	if status != 4 && status != 5 {
+		return errors.New("状态错误")
+	}
+	if result := db.DB.Model(&models.Transfer{}).Where("status = 2 and id in ?", transferIDs).Updates(map[string]interface{}{
+		"status": status,
+		"remark": remark,
+	}); result.Error != nil {
+		return errors.New("更新交易失败")
+	} else if result.RowsAffected == 0 {
+		return errors.New("没有待处理交易")
+	}
+	return nil
+}
+
+// 处理链上交易,匹配订单并结算,返回本次完成的订单ID,由调用者发货
+// actor为订单事件的操作者,定时扫描为scheduler,用户主动查询为buyer
+func ProcessTransfers(onChainTransfers []models.Transfer, actor string) ([]uuid.UUID, error) {
+	processTransfersLock.Lock()
+	defer processTransfersLock.Unlock()
+
+	// 所有交易的钱包地址
+	var onChainWalletAddresses []string
+	for _, transfersOnChain := range onChainTransfers {
+		onChainWalletAddresses = append(onChainWalletAddresses, transfersOnChain.FromAddress, transfersOnChain.ToAddress)
+	}
+
+	// 更新余额,不要使用tx的事务，因为会rollback
+	// 也不能单独使用db.DB.Exec，因为会未知的阻塞整个函数
+	// defer也不能放在defer tx.Rollback()的后面，否则会在tx未提交的过程中执行
+	// 也不能直接defer function1(var),这样获取到的参数是当时的变量
+	var relatedWalletsForUpdateBalance []models.Wallet
+	var toInsertTransfersForUpdateBalance []models.Transfer
+	defer func() {
+		UpdateWalletBalanceFromTransfers(relatedWalletsForUpdateBalance, toInsertTransfersForUpdateBalance)
+	}()
+
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	// 找出与交易相关的钱包
+	var relatedWallets []models.Wallet
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("address in ?", onChainWalletAddresses).Find(&relatedWallets)
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	var toInsertTransfers []models.Transfer
+	for _, wallet := range relatedWallets {
+		for _, onChainTransfer := range onChainTransfers {
+			if wallet.Address == onChainTransfer.FromAddress {
+				transferTemp := onChainTransfer
+				transferTemp.Price = transferTemp.Price.Neg()
+				transferTemp.WalletObj = wallet
+				transferTemp.WalletID = wallet.ID
+				toInsertTransfers = append(toInsertTransfers, transferTemp)
+			}
+			if wallet.Address == onChainTransfer.ToAddress {
+				transferTemp := onChainTransfer
+				transferTemp.WalletObj = wallet
+				transferTemp.WalletID = wallet.ID
+				toInsertTransfers = append(toInsertTransfers, transferTemp)
+			}
+		}
+	}
+
+	// 添加交易到数据库,因为API的查询问题可能会取到重复的交易记录，如果交易存在则从toInsertTransfers删除
+	// 一次查询减少消耗
+	// transfer表很大，如果该步很慢可以优化，首先查any，如果有重复，然后再in
+	var toInsertTransactionID []string
+	for _, toInsertTransfer := range toInsertTransfers {
+		toInsertTransactionID = append(toInsertTransactionID, toInsertTransfer.TransactionID)
+	}
+
+	//从数据库中取到重复的transfer id 列表
+	var duplicatedTransfers []models.Transfer
+	db.DB.Where("transaction_id in ?", toInsertTransactionID).Find(&duplicatedTransfers)
+	var duplicatedTransactionIDs []string
+	for _, duplicatedTransfer := range duplicatedTransfers {
+		duplicatedTransactionIDs = append(duplicatedTransactionIDs, duplicatedTransfer.TransactionID)
+	}
+
+	if len(duplicatedTransactionIDs) != 0 {
+		var removedDuplicatedTransfers []models.Transfer
+		for _, toInsertTransfer := range toInsertTransfers {
+			if !functions.SliceContainString(duplicatedTransactionIDs, toInsertTransfer.TransactionID) {
+				removedDuplicatedTransfers = append(removedDuplicatedTransfers, toInsertTransfer)
+			}
+		}
+		toInsertTransfers = removedDuplicatedTransfers
+	}
+
+	// 给更新余额的函数传参
+	relatedWalletsForUpdateBalance = relatedWallets
+	toInsertTransfersForUpdateBalance = toInsertTransfers
+
+	// 处理交易前,如果没有transfer，直接返回
+	if len(toInsertTransfers) == 0 {
+		return nil, nil
+	}
+
+	// 寻找订单，并绑定在transfer上
+	for i, toInsertTransfer := range toInsertTransfers {
+		if !toInsertTransfer.Price.GreaterThan(decimal.Zero) {
+			continue
+		}
+
+		// 即使订单状态已经超时，但是最后两分钟的时候有入账，超时之后检测出该笔交易 （假设说明：订单1超时后，订单2立刻发起，两个订单对应同一个钱包，订单1的最后两分钟有入账，并且超时后才检测出来，该笔交易归属订单的查询条件查询结果仍然是订单1，因为交易时间是在订单1的时间段内）
+		// 交易时间在订单时间段内，订单状态为超时或未付款，交易网络和货币匹配订单，订单绑定的钱包和交易的钱包一致
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("create_time < ? AND end_time > ? AND (status = ? OR status = ?) AND wallet_id = ? AND network=? AND currency = ?",
+			toInsertTransfer.CreateTime, toInsertTransfer.CreateTime, 0, -1, toInsertTransfer.WalletID, toInsertTransfer.Network, toInsertTransfer.Currency).Session(&gorm.Session{})
+
+		// gorm Find First 函数寻找目标,没找到会赋予0值而不是nil指针
+		//	绑定订单到交易上
+		var relatedOrder *models.Order
+		var result *gorm.DB
+		if toInsertTransfer.WalletObj.Status == 2 {
+			// 小数点尾数
+			result = query.Where("price=?", toInsertTransfer.Price).Find(&relatedOrder)
+		} else {
+			// 任意金额
+			result = query.Find(&relatedOrder)
+		}
+
+		// 查询有没有对应订单，如果有则挂载订单对象到transfer上以便后续操作
+		if result.RowsAffected > 0 {
+			toInsertTransfers[i].OrderObj = relatedOrder
+			toInsertTransfers[i].OrderID = &relatedOrder.ID
+		}
+
+		// 记载transfer分类，如果钱包类型为0(即任意金额钱包占用)则为1，如果为1(小数点钱包)则为2
+		if toInsertTransfers[i].OrderObj != nil {
+			if toInsertTransfers[i].WalletObj.Status == 0 {
+				toInsertTransfers[i].Cate = 1
+			} else if toInsertTransfers[i].WalletObj.Status == 2 {
+				toInsertTransfers[i].Cate = 2
+			}
+		}
+
+		// log动账
+		//my_log.LogInfo(fmt.Sprintf("钱包收入动账, 金额:%s %s 地址: %s 到 %s", toInsertTransfer.Price, toInsertTransfer.Currency, toInsertTransfer.FromAddress, toInsertTransfer.ToAddress))
+	}
+
+	// 删除没有挂载OrderObj的支出transfer,没有匹配到订单的收入transfer标记为待处理,由管理员手动分配
+	var toInsertTransfersTemp []models.Transfer
+	for _, toInsertTransfer := range toInsertTransfers {
+		if toInsertTransfer.OrderObj == nil {
+			if !toInsertTransfer.Price.GreaterThan(decimal.Zero) {
+				continue
+			}
+			toInsertTransfer.Status = 2
+		}
+		toInsertTransfersTemp = append(toInsertTransfersTemp, toInsertTransfer)
+	}
+	toInsertTransfers = toInsertTransfersTemp
+
+	if len(toInsertTransfers) == 0 {
+		return nil, nil
+	}
+
+	//tx := db.DB.Begin()
+	//defer tx.Rollback()
+
+	// 要先在事务中创建,不然后面查已付价格查不到
+	tx.Create(&toInsertTransfers)
+
+	// 更新订单信息，更新状态，结束时间，如果完成则更新状态
+	// 如果这里有多个transfer对应一个订单,则会走多次,实际上走一次就够了,因为获取已付金额函数是基于transfer获取的,transfer在签名的事务就已经更新完毕了,浪费性能但是概率小,无伤大雅
+	for _, transfer := range toInsertTransfers {
+		if transfer.OrderObj == nil {
+			continue
+		}
+		transferID := transfer.ID
+		if err := SettleOrderPayment(tx, transfer.OrderObj, transfer.CreateTime, actor, &transferID); err != nil {
+			return nil, errors.New(fmt.Sprintf("结算订单失败, Order: %s, Error: %v", transfer.OrderObj.ID, err))
+		}
+	}
+
+	// 回调
+	// 获取状态为已支付的订单id,去重并回调(1.因为有可能是固定金额没有一次付清，所以要判断是否已完成,2.因为有可能一次监听包含多个多同一订单的付款所以要去重)
+	var successOrderIDs []uuid.UUID
+	var successProductIDs []uuid.UUID
+	// 获取已完成订单ID列表
+	for _, toInsertTransfer := range toInsertTransfers {
+		if toInsertTransfer.OrderObj == nil || toInsertTransfer.OrderObj.Status != 1 {
+			continue
+		}
+		successOrderIDs = append(successOrderIDs, toInsertTransfer.OrderObj.ID)
+		if toInsertTransfer.OrderObj.ProductID != nil {
+			successProductIDs = append(successProductIDs, *toInsertTransfer.OrderObj.ProductID)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.New("提交失败, " + err.Error())
+	}
+
+	// 超时后到账的订单可能重新占用了商品项目,更新库存
+	if len(successProductIDs) > 0 {
+		UpdateProductInStockCount(successProductIDs)
+	}
+
+	return successOrderIDs, nil
+}
+
+// 获取用户要主动查询付款的订单,待支付订单需为支持主动查询的主网
+func GetOrderToCheckPayment(orderID uuid.UUID, tgChatID int64) (models.Order, error) {
+	var order models.Order
+	if result := db.DB.Where("id = ? and tg_chat_id = ?", orderID, tgChatID).Find(&order); result.Error != nil {
+		return order, errors.New("获取订单错误")
+	} else if result.RowsAffected == 0 {
+		return order, errors.New("没有该订单")
+	}
+	if order.Status == 0 && config.Network(order.Network) != config.TRON {
+		return order, errors.New("该主网不支持主动查询")
+	}
+	return order, nil
+}
+
+// 用户主动查询订单付款,订单由GetOrderToCheckPayment获取,只查询订单钱包在订单创建后收到的交易,与定时扫描共用处理流程
+// 返回最新的订单和本次完成的订单ID,由调用者发货
+func CheckOrderPayment(order models.Order) (*models.Order, []uuid.UUID, error) {
+	if order.Status != 0 {
+		return &order, nil, nil
+	}
+
+	var onChainTransfers []models.Transfer
+	switch config.Network(order.Network) {
+	case config.TRON:
+		client := tron.New(config.SiteConfig.TronGridApiKey)
+		transfers, err := client.GetAccountIncomingTransfers(order.WalletAddress, order.CreateTime)
+		if err != nil {
+			return nil, nil, errors.New("查询链上交易失败,请稍后再试")
+		}
+		onChainTransfers = transfers
+	default:
+		return nil, nil, errors.New("该主网不支持主动查询")
+	}
+
+	var successOrderIDs []uuid.UUID
+	if len(onChainTransfers) != 0 {
+		var err error
+		successOrderIDs, err = ProcessTransfers(onChainTransfers, models.OrderEventActorBuyer)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if result := db.DB.Where("id = ?", order.ID).Find(&order); result.Error != nil {
+		return nil, nil, errors.New("获取订单错误")
+	}
+	return &order, successOrderIDs, nil
+}
@@ -1,5 +1,17 @@
 package services
 
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
 //func RegisterUser(userName string) *models.User {
 //	var user *models.User
 //	db.DB.Create(&user)
@@ -40,3 +52,126 @@ func LoginUserWithoutPassword(userName string) {
 //	}
 //	return nil
 //}
+
+func GetUserByTGChatID(tgChatID int64) (models.User, error) {
+	var user models.User
+	if result := db.DB.Where("tg_chat_id = ?", tgChatID).Find(&user); result.Error != nil {
+		return user, errors.New("获取用户错误")
+	} else if result.RowsAffected == 0 {
+		// 没有记录的用户余额为0
+		user.TGChatID = tgChatID
+	}
+	return user, nil
+}
+
+// 锁定用户,同一用户的余额变动和下单依次处理,必须在事务中调用,用户不存在时自动创建
+func lockUser(tx *gorm.DB, tgChatID int64, tgUsername string) (models.User, error) {
+	var user models.User
+	if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("tg_chat_id = ?", tgChatID).Find(&user); result.Error != nil {
+		return user, errors.New("获取用户错误")
+	} else if result.RowsAffected == 0 {
+		user = *models.NewUser(tgChatID, tgUsername)
+		if err := tx.Create(&user).Error; err != nil {
+			return user, errors.New("创建用户失败")
+		}
+	}
+	return user, nil
+}
+
+// 变动用户余额并记录流水,必须在事务中调用,余额不足时返回错误
+// amount为正数则入账,负数则扣除,用户不存在时自动创建
+func ChangeUserBalance(tx *gorm.DB, tgChatID int64, tgUsername string, amount decimal.Decimal, cate int, orderID *uuid.UUID, remark string) (*models.User, error) {
+	user, err := lockUser(tx, tgChatID, tgUsername)
+	if err != nil {
+		return nil, err
+	}
+
+	newBalance := user.Balance.Add(amount)
+	if newBalance.LessThan(decimal.Zero) {
+		return nil, errors.New("余额不足")
+	}
+
+	updateMap := map[string]interface{}{
+		"balance": newBalance,
+	}
+	if tgUsername != "" {
+		updateMap["tg_username"] = tgUsername
+	}
+	if result := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(updateMap); result.Error != nil {
+		return nil, errors.New("更新余额失败")
+	} else if result.RowsAffected == 0 {
+		return nil, errors.New("更新余额失败")
+	}
+	user.Balance = newBalance
+
+	balanceLog := models.NewBalanceLog(cate, amount, newBalance, remark, user.ID, tgChatID, orderID)
+	if err := tx.Create(balanceLog).Error; err != nil {
+		return nil, errors.New("记录余额流水失败")
+	}
+
+	return &user, nil
+}
+
+// 管理员手动调整余额
+func AdjustUserBalance(tgChatID int64, amount decimal.Decimal, remark string) error {
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	if _, err := ChangeUserBalance(tx, tgChatID, "", amount, 5, nil, remark); err != nil {
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return errors.New("提交失败, " + err.Error())
+	}
+	return nil
+}
+
+// 结算订单应存入余额的金额,必须在锁定订单的事务中调用
+// 充值订单每笔付款都入账,订单超时或关闭后已付款项不会丢失;任意金额钱包超额支付的部分在订单完成时入账
+// 按订单已入账金额只入账差额,同一次监听中多笔交易对应同一订单时会重复调用,结果一致
+func SettleOrderBalance(tx *gorm.DB, order *models.Order) error {
+	var total decimal.Decimal
+	var cate int
+	var remark string
+	if order.Cate == 1 {
+		total = order.PaidPrice
+		cate = 3
+		remark = "余额充值"
+	} else if order.PaidPrice.GreaterThan(order.Price) {
+		total = order.PaidPrice.Sub(order.Price)
+		cate = 1
+		remark = "超额支付"
+	} else {
+		return nil
+	}
+
+	// 同一订单可能对应多个内存中的订单对象,以数据库中的已入账金额为准
+	var creditedPrice decimal.Decimal
+	if err := tx.Model(&models.Order{}).Select("credited_price").Where("id = ?", order.ID).Scan(&creditedPrice).Error; err != nil {
+		return errors.New("查询订单已入账金额失败")
+	}
+	order.CreditedPrice = creditedPrice
+	amount := total.Sub(creditedPrice)
+	if !amount.GreaterThan(decimal.Zero) {
+		return nil
+	}
+
+	convertedAmount, err := config.ConvertCurrencyPrice(amount, config.Currency(order.Currency), config.BalanceCurrency)
+	if err != nil {
+		return err
+	}
+	convertedAmount = convertedAmount.RoundFloor(2)
+	if !convertedAmount.GreaterThan(decimal.Zero) {
+		return nil
+	}
+
+	remark = fmt.Sprintf("%s %s %s", remark, amount, order.Currency)
+	if _, err := ChangeUserBalance(tx, order.TGChatID, order.TGUsername, convertedAmount, cate, &order.ID, remark); err != nil {
+		return err
+	}
+	if result := tx.Model(&models.Order{}).Where("id = ?", order.ID).Update("credited_price", total); result.Error != nil {
+		return errors.New("更新订单已入账金额失败")
+	}
+	order.CreditedPrice = total
+	return nil
+}
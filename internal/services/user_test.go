@@ -0,0 +1,109 @@
+package services
+
+import (
+	"github.com/shopspring/decimal"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"testing"
+	"time"
+)
+
+func assertTestBalance(t *testing.T, tgChatID int64, balance string, logCount int64) {
+	t.Helper()
+	user, err := GetUserByTGChatID(tgChatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := db.DB.Model(&models.BalanceLog{}).Where("tg_chat_id = ?", tgChatID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !user.Balance.Equal(decimal.RequireFromString(balance)) || count != logCount {
+		t.Fatalf("余额 %s 流水 %d 条, 应为 %s %d 条", user.Balance, count, balance, logCount)
+	}
+}
+
+func TestChangeUserBalance(t *testing.T) {
+	setupTestDB(t)
+
+	tx := db.DB.Begin()
+	if _, err := ChangeUserBalance(tx, 1, "buyer", decimal.NewFromInt(5), 5, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ChangeUserBalance(tx, 1, "", decimal.NewFromInt(-6), 4, nil, ""); err == nil {
+		t.Fatal("余额不足时应返回错误")
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	assertTestBalance(t, 1, "5", 1)
+
+	if err := AdjustUserBalance(1, decimal.NewFromInt(-5), ""); err != nil {
+		t.Fatal(err)
+	}
+	assertTestBalance(t, 1, "0", 2)
+	if err := AdjustUserBalance(1, decimal.RequireFromString("-0.01"), ""); err == nil {
+		t.Fatal("余额不足时应返回错误")
+	}
+	assertTestBalance(t, 1, "0", 2)
+}
+
+func TestSettleOrderBalanceIdempotent(t *testing.T) {
+	setupTestDB(t)
+	// 超额支付2 USDT,固定汇率7,入账14
+	order := &models.Order{Status: 1, TGChatID: 1, Price: decimal.NewFromInt(10), PaidPrice: decimal.NewFromInt(12)}
+	createTestOrder(t, order)
+	// 同一订单的另一个对象,已入账金额以数据库为准
+	staleOrder := *order
+
+	for _, settleOrder := range []*models.Order{order, order, &staleOrder} {
+		if err := SettleOrderBalance(db.DB, settleOrder); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertTestBalance(t, 1, "14", 1)
+}
+
+func addTestTransfer(t *testing.T, order *models.Order, price string) {
+	t.Helper()
+	transfer := models.NewTransfer("tx", config.Currency(order.Currency), config.Network(order.Network), "from", "to", decimal.RequireFromString(price), time.Now().Unix())
+	transfer.OrderID = &order.ID
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+	if err := tx.Create(transfer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := SettleOrderPayment(tx, order, transfer.CreateTime, models.OrderEventActorScheduler, &transfer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSettleDepositOrderPartialPayment(t *testing.T) {
+	setupTestDB(t)
+	order := &models.Order{Cate: 1, TGChatID: 1, Price: decimal.NewFromInt(10), EndTime: time.Now().Unix() + 60}
+	createTestOrder(t, order)
+
+	// 部分付款立即入账
+	addTestTransfer(t, order, "2")
+	addTestTransfer(t, order, "3")
+	assertTestBalance(t, 1, "35", 2)
+
+	// 超时后已入账的金额保留
+	db.DB.Model(&models.Order{}).Where("id = ?", order.ID).Update("end_time", time.Now().Unix()-1)
+	if _, err := ClearExpireOrder(); err != nil {
+		t.Fatal(err)
+	}
+	assertTestBalance(t, 1, "35", 2)
+
+	// 超时后付清,只入账差额
+	order.Status = -1
+	addTestTransfer(t, order, "5")
+	if order.Status != 1 {
+		t.Fatalf("订单状态 %d, 应为 1", order.Status)
+	}
+	assertTestBalance(t, 1, "70", 3)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gopay/internal/exts/config"
+	"gopay/internal/exts/db"
+	"gopay/internal/models"
+	"gopay/internal/utils/requests"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 发货接口请求签名,hex(HMAC-SHA256(密钥, 时间戳 + "." + 请求体))
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "." + string(body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 发货接口的订单数据,接口需以order_id去重,重试时会重复请求同一订单
+func webhookPayload(order models.Order) map[string]interface{} {
+	var inputData models.JSONField
+	if order.InputData != nil {
+		inputData = *order.InputData
+	}
+	return map[string]interface{}{
+		"order_id":            order.ID.String(),
+		"product_id":          order.Product.ID.String(),
+		"product_name":        order.Product.Name,
+		"price":               order.Price.String(),
+		"currency":            order.Currency,
+		"network":             order.Network,
+		"paid_price":          order.PaidPrice.String(),
+		"base_currency":       order.BaseCurrency,
+		"base_currency_price": order.BaseCurrencyPrice.String(),
+		"paid_time":           order.EndTime,
+		"tg_chat_id":          order.TGChatID,
+		"tg_username":         order.TGUsername,
+		"input_data":          inputData,
+	}
+}
+
+// 调用商品的发货接口获取发货内容,接口返回 {"content": "..."},状态码非200或内容为空视为失败
+func requestWebhookContent(order models.Order) (string, error) {
+	if order.Product.WebhookURL == "" {
+		return "", errors.New("商品没有设置发货接口")
+	}
+	if config.SiteConfig.WebhookSecret == "" {
+		return "", errors.New("没有设置发货接口签名密钥")
+	}
+
+	payload := webhookPayload(order)
+	// requests.Post使用json.Marshal序列化,map按key排序,与这里签名的请求体一致
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	timestamp := time.Now().Unix()
+	headers := config.Headers{
+		"X-Timestamp": strconv.FormatInt(timestamp, 10),
+		"X-Signature": SignWebhookPayload(config.SiteConfig.WebhookSecret, timestamp, body),
+	}
+
+	response, err := requests.Post(order.Product.WebhookURL, payload, headers)
+	if err != nil {
+		return "", fmt.Errorf("发货接口请求失败: %v", err)
+	}
+	var result struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return "", errors.New("发货接口返回格式错误")
+	}
+	if strings.TrimSpace(result.Content) == "" {
+		return "", errors.New("发货接口返回内容为空")
+	}
+	return result.Content, nil
+}
+
+// 获取订单的发货内容,已获取过的直接返回,首次获取成功后立即保存,防止重试时重复生成
+func fetchWebhookContent(order *models.Order) error {
+	if order.DeliveryContent != "" {
+		return nil
+	}
+	content, err := requestWebhookContent(*order)
+	if err != nil {
+		return err
+	}
+	if result := db.DB.Model(&models.Order{}).Where("id = ? and delivery_content = ?", order.ID, "").Update("delivery_content", content); result.Error != nil {
+		return errors.New("保存发货内容失败")
+	} else if result.RowsAffected == 0 {
+		// 已被其他调用者或管理员写入,以数据库为准
+		db.DB.Model(&models.Order{}).Select("delivery_content").Where("id = ?", order.ID).Scan(&order.DeliveryContent)
+		return nil
+	}
+	order.DeliveryContent = content
+	return nil
+}
+
+// 发货接口多次失败待人工处理的订单
+func GetWebhookResolutionQueue() ([]models.DeliveryOutbox, error) {
+	var deliveryOutboxes []models.DeliveryOutbox
+	if result := db.DB.Preload("Order").Preload("Order.Product").
+		Joins("join \"order\" on \"order\".id = delivery_outbox.order_id").
+		Joins("join product on product.id = \"order\".product_id").
+		Where("delivery_outbox.status = 2 and product.delivery_type = ? and \"order\".delivery_content = ?", models.ProductDeliveryTypeWebhook, "").
+		Order("delivery_outbox.create_time asc").Find(&deliveryOutboxes); result.Error != nil {
+		return nil, errors.New("查询待处理订单失败")
+	}
+	return deliveryOutboxes, nil
+}
+
+// 管理员手动填写发货接口订单的发货内容,并重新发货
+func ResolveWebhookDelivery(orderID uuid.UUID, content string) error {
+	if strings.TrimSpace(content) == "" {
+		return errors.New("发货内容不能为空")
+	}
+
+	tx := db.DB.Begin()
+	defer tx.Rollback()
+
+	var order models.Order
+	if result := tx.Preload("Product").Where("id = ?", orderID).Find(&order); result.Error != nil {
+		return errors.New("获取订单错误")
+	} else if result.RowsAffected == 0 {
+		return errors.New("没有该订单")
+	}
+	if order.Status != 1 || !order.Product.IsWebhookDelivery() {
+		return errors.New("订单不是已支付的接口发货订单")
+	}
+	if order.DeliveryContent != "" {
+		return errors.New("订单已有发货内容,请直接重新发送")
+	}
+
+	if result := tx.Model(&models.Order{}).Where("id = ?", order.ID).Update("delivery_content", content); result.Error != nil {
+		return errors.New("更新订单失败")
+	}
+	if err := AddOrderEvent(tx, order.ID, &order.Status, order.Status, models.OrderEventActorAdmin, nil, "手动填写发货内容"); err != nil {
+		return err
+	}
+	if err := RequeueDeliveryOutbox(tx, order.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.New("提交失败, " + err.Error())
+	}
+	return DeliverOrders([]uuid.UUID{order.ID})
+}
@@ -94,3 +94,39 @@ type TriggerSmartContractValue struct {
 	OwnerAddress    string `json:"owner_address"`
 	ContractAddress string `json:"contract_address"`
 }
+
+type accountTRC20TransactionsStruct struct {
+	Data []struct {
+		TransactionID string `json:"transaction_id"`
+		TokenInfo     struct {
+			Symbol   string `json:"symbol"`
+			Address  string `json:"address"`
+			Decimals int    `json:"decimals"`
+		} `json:"token_info"`
+		BlockTimestamp int64  `json:"block_timestamp"`
+		From           string `json:"from"`
+		To             string `json:"to"`
+		Type           string `json:"type"`
+		Value          string `json:"value"`
+	} `json:"data"`
+	Success bool `json:"success"`
+}
+
+type accountTransactionsStruct struct {
+	Data []struct {
+		Ret []struct {
+			ContractRet string `json:"contractRet"`
+		} `json:"ret"`
+		TxID           string `json:"txID"`
+		BlockTimestamp int64  `json:"block_timestamp"`
+		RawData        struct {
+			Contract []struct {
+				Parameter struct {
+					Value map[string]interface{} `json:"value"`
+				} `json:"parameter"`
+				Type string `json:"type"`
+			} `json:"contract"`
+		} `json:"raw_data"`
+	} `json:"data"`
+	Success bool `json:"success"`
+}
@@ -421,6 +421,76 @@ func (client *Tron) GetScheduleTransfers() ([]models.Transfer, error) {
 	return transactions, nil
 }
 
+// 查询地址收到的USDT和TRX转账,用于用户主动查询付款,不影响定时扫描的区块进度,minTimestamp为秒
+func (client *Tron) GetAccountIncomingTransfers(address string, minTimestamp int64) ([]models.Transfer, error) {
+	var transactions []models.Transfer
+
+	// USDT
+	url := fmt.Sprintf("%s/v1/accounts/%s/transactions/trc20?only_to=true&only_confirmed=true&limit=50&contract_address=%s&min_timestamp=%d", client.BaseURL, address, usdtContractAddress, minTimestamp*1000)
+	respByte, err := requests.Get(url, client.RequestsHeader)
+	if err != nil {
+		my_log.LogError(fmt.Sprintf("Request Err, Url:%s ,Error: %v", url, err))
+		return transactions, err
+	}
+	var trc20Data accountTRC20TransactionsStruct
+	if err = json.Unmarshal(respByte, &trc20Data); err != nil {
+		return transactions, err
+	}
+	if !trc20Data.Success {
+		return transactions, errors.New("查询USDT转账失败")
+	}
+	for _, item := range trc20Data.Data {
+		if item.Type != "Transfer" || item.TokenInfo.Address != usdtContractAddress || item.To != address {
+			continue
+		}
+		value, err := decimal.NewFromString(item.Value)
+		if err != nil {
+			continue
+		}
+		amount := value.Div(decimal.NewFromFloat(ratio))
+		transaction := models.NewTransfer(item.TransactionID, config.USDT, config.TRON, item.From, item.To, amount, item.BlockTimestamp/1000)
+		transactions = append(transactions, *transaction)
+	}
+
+	// TRX
+	url = fmt.Sprintf("%s/v1/accounts/%s/transactions?only_to=true&only_confirmed=true&limit=50&min_timestamp=%d", client.BaseURL, address, minTimestamp*1000)
+	respByte, err = requests.Get(url, client.RequestsHeader)
+	if err != nil {
+		my_log.LogError(fmt.Sprintf("Request Err, Url:%s ,Error: %v", url, err))
+		return transactions, err
+	}
+	var trxData accountTransactionsStruct
+	if err = json.Unmarshal(respByte, &trxData); err != nil {
+		return transactions, err
+	}
+	if !trxData.Success {
+		return transactions, errors.New("查询TRX转账失败")
+	}
+	for _, item := range trxData.Data {
+		if len(item.RawData.Contract) == 0 || item.RawData.Contract[0].Type != "TransferContract" {
+			continue
+		}
+		if len(item.Ret) != 0 && item.Ret[0].ContractRet != "SUCCESS" {
+			continue
+		}
+		var contractValue TransferAssetContractValue
+		if err := functions.MapToStruct(item.RawData.Contract[0].Parameter.Value, &contractValue); err != nil {
+			return transactions, errors.New("convert_err")
+		}
+		fromAddress := hexToBase58(contractValue.OwnerAddress)
+		toAddress := hexToBase58(contractValue.ToAddress)
+		if toAddress != address {
+			continue
+		}
+
+		amount := decimal.NewFromInt(contractValue.Amount).Div(decimal.NewFromFloat(ratio))
+		transaction := models.NewTransfer(item.TxID, config.TRX, config.TRON, fromAddress, toAddress, amount, item.BlockTimestamp/1000)
+		transactions = append(transactions, *transaction)
+	}
+
+	return transactions, nil
+}
+
 // 块的起终不返回最后一个块，即1-2只返回1
 func (client *Tron) getTransactionsByBlockRange(startBlockNum int64, endBlockNum int64) ([]models.Transfer, error) {
 	my_log.LogDebug(fmt.Sprintf("Tron block range: %d - %d", startBlockNum, endBlockNum))
@@ -82,7 +82,8 @@ func sendRequest(method string, url string, dataMap *map[string]interface{}, opt
 		}
 	}
 
-	my_log.LogDebug(fmt.Sprintf("%s: %s ,Data: %d", method, url, dataMap))
+	// 请求体可能包含买家输入等敏感内容,不记录
+	my_log.LogDebug(fmt.Sprintf("%s: %s", method, url))
 	for i := 0; i < 1; i++ {
 		resp, err = client.Do(req)
 		if err != nil {
@@ -95,19 +96,23 @@ func sendRequest(method string, url string, dataMap *map[string]interface{}, opt
 		}
 		break
 	}
+	// 超时重试用完后resp为空,直接返回超时错误
+	if err != nil {
+		return nil, err
+	}
 
 	//resp, err = client.Do(req)
 	//if err != nil {
 	//	return nil, err
 	//}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != 200 {
 		err = errors.New(fmt.Sprintf("状态码 %d", resp.StatusCode))
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
 		err = fmt.Errorf("status code: %d", resp.StatusCode)
 		return nil, err
@@ -6,11 +6,17 @@ func StartSchedule() {
 	go CheckTransactionSchedule()
 	go UpdateExchangeRateSchedule()
 	go ClearExpireSchedule()
+	go DeliverySchedule()
+	go StockSummarySchedule()
+	go ProductPublishSchedule()
 }
 
 var checkTransactionInterval = time.Second * 30
 var updateExchangeRateInterval = time.Second * 600
 var clearExpireInterval = time.Second * 35
+var deliveryInterval = time.Second * 20
+var stockSummaryInterval = time.Second * 60
+var productPublishInterval = time.Second * 30
 
 func ClearExpireSchedule() {
 	for {
@@ -35,3 +41,24 @@ func UpdateExchangeRateSchedule() {
 		time.Sleep(updateExchangeRateInterval)
 	}
 }
+
+func DeliverySchedule() {
+	for {
+		startDelivery()
+		time.Sleep(deliveryInterval)
+	}
+}
+
+func StockSummarySchedule() {
+	for {
+		sendStockSummary()
+		time.Sleep(stockSummaryInterval)
+	}
+}
+
+func ProductPublishSchedule() {
+	for {
+		applyProductPublish()
+		time.Sleep(productPublishInterval)
+	}
+}
@@ -0,0 +1,242 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 共享字符串表等xml文件解压后读取的大小上限,防止zip炸弹
+var xmlPartMaxSize int64 = 200 << 20
+
+// 按行流式读取xlsx第一个工作表,只读取单元格的值,不处理样式和公式
+type Reader struct {
+	sheetFile     io.ReadCloser
+	decoder       *xml.Decoder
+	sharedStrings []string
+}
+
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New("xlsx文件格式错误")
+	}
+	files := make(map[string]*zip.File)
+	for _, file := range zipReader.File {
+		files[file.Name] = file
+	}
+
+	sheetFile, ok := files[firstSheetPath(files)]
+	if !ok {
+		return nil, errors.New("xlsx文件中没有工作表")
+	}
+	var sharedStrings []string
+	if sharedStringsFile, ok := files["xl/sharedStrings.xml"]; ok {
+		if sharedStrings, err = readSharedStrings(sharedStringsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	rc, err := sheetFile.Open()
+	if err != nil {
+		return nil, errors.New("读取工作表失败")
+	}
+	return &Reader{
+		sheetFile:     rc,
+		decoder:       xml.NewDecoder(rc),
+		sharedStrings: sharedStrings,
+	}, nil
+}
+
+func (r *Reader) Close() error {
+	return r.sheetFile.Close()
+}
+
+// 读取下一行,返回Excel中的行号和按列排列的单元格值,没有更多行时返回io.EOF
+func (r *Reader) Read() (int, []string, error) {
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return 0, nil, io.EOF
+			}
+			return 0, nil, errors.New("工作表格式错误")
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		return r.readRow(start)
+	}
+}
+
+func (r *Reader) readRow(start xml.StartElement) (int, []string, error) {
+	rowNum, _ := strconv.Atoi(attr(start, "r"))
+	var cells []string
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return rowNum, nil, errors.New("工作表格式错误")
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			var cell struct {
+				Type  string `xml:"t,attr"`
+				Ref   string `xml:"r,attr"`
+				Value string `xml:"v"`
+				Text  string `xml:"is>t"`
+				Runs  []struct {
+					Text string `xml:"t"`
+				} `xml:"is>r"`
+			}
+			if err := r.decoder.DecodeElement(&cell, &t); err != nil {
+				return rowNum, nil, errors.New("工作表格式错误")
+			}
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(r.sharedStrings) {
+					return rowNum, nil, errors.New("共享字符串索引错误")
+				}
+				value = r.sharedStrings[index]
+			case "inlineStr":
+				value = cell.Text
+				for _, run := range cell.Runs {
+					value += run.Text
+				}
+			}
+			// 空单元格不会出现在文件中,按单元格位置补齐
+			column := len(cells)
+			if index, ok := ColumnIndex(strings.TrimRight(cell.Ref, "0123456789")); ok && index >= column {
+				column = index
+			}
+			for len(cells) < column {
+				cells = append(cells, "")
+			}
+			cells = append(cells, value)
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return rowNum, cells, nil
+			}
+		}
+	}
+}
+
+// Excel列字母转为从0开始的列序号,如A为0,AA为26
+func ColumnIndex(letters string) (int, bool) {
+	if letters == "" || len(letters) > 3 {
+		return 0, false
+	}
+	index := 0
+	for _, letter := range strings.ToUpper(letters) {
+		if letter < 'A' || letter > 'Z' {
+			return 0, false
+		}
+		index = index*26 + int(letter-'A') + 1
+	}
+	return index - 1, true
+}
+
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// 按workbook中的顺序找到第一个工作表,找不到时使用sheet1.xml
+func firstSheetPath(files map[string]*zip.File) string {
+	defaultPath := "xl/worksheets/sheet1.xml"
+	workbookFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		return defaultPath
+	}
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeZipXML(workbookFile, &workbook); err != nil || len(workbook.Sheets) == 0 {
+		return defaultPath
+	}
+	relsFile, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return defaultPath
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipXML(relsFile, &rels); err != nil {
+		return defaultPath
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return path.Join("xl", rel.Target)
+	}
+	return defaultPath
+}
+
+func decodeZipXML(file *zip.File, v interface{}) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, xmlPartMaxSize)).Decode(v)
+}
+
+// 读取共享字符串表,富文本的字符串合并各段文字
+func readSharedStrings(file *zip.File) ([]string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, errors.New("读取共享字符串失败")
+	}
+	defer rc.Close()
+
+	var sharedStrings []string
+	decoder := xml.NewDecoder(io.LimitReader(rc, xmlPartMaxSize))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return sharedStrings, nil
+		} else if err != nil {
+			return nil, errors.New("共享字符串格式错误")
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "si" {
+			continue
+		}
+		var si struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		}
+		if err := decoder.DecodeElement(&si, &start); err != nil {
+			return nil, errors.New("共享字符串格式错误")
+		}
+		text := si.Text
+		for _, run := range si.Runs {
+			text += run.Text
+		}
+		sharedStrings = append(sharedStrings, text)
+	}
+}
@@ -0,0 +1,4 @@
+当前余额: {{.User.Balance}} {{.BalanceCurrency}}
+
+超额支付和退款会自动存入余额,余额可直接购买商品
+请选择充值金额
\ No newline at end of file
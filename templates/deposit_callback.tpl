@@ -0,0 +1,4 @@
+充值完成
+完成时间:{{TimestampToDatetime .Order.EndTime}}
+支付金额:{{.Order.PaidPrice}} {{.Order.Currency}}-{{.Order.Network}}
+当前余额:{{.User.Balance}} {{.BalanceCurrency}}
\ No newline at end of file
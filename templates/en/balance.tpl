@@ -0,0 +1,4 @@
+Balance: {{.User.Balance}} {{.BalanceCurrency}}
+
+Overpayments and refunds are added to your balance automatically, and the balance can be used to buy products directly
+Please choose a top-up amount
\ No newline at end of file
@@ -0,0 +1,4 @@
+Top-up completed
+Completed at: {{TimestampToDatetime .Order.EndTime}}
+Paid: {{.Order.PaidPrice}} {{.Order.Currency}}-{{.Order.Network}}
+Balance: {{.User.Balance}} {{.BalanceCurrency}}
\ No newline at end of file
@@ -0,0 +1,6 @@
+Please confirm your order
+Product: {{.Product.Name}}{{if .VariantName}} {{.VariantName}}{{end}}
+Payment method: {{.PaymentMethod}}{{range .Inputs}}
+{{.Label}}: {{.Value}}{{end}}
+
+The order will be created after confirmation
\ No newline at end of file
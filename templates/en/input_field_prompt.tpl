@@ -0,0 +1,3 @@
+Buying {{.Product.Name}}{{if .VariantName}} {{.VariantName}}{{end}} requires the following information ({{.Step}}/{{.Total}})
+{{if .Error}}Invalid input: {{.Error}}
+{{end}}Please {{if eq .Field.Type "choice"}}choose{{else}}send{{end}} {{.Field.Label}}{{if eq .Field.Type "number"}} (number{{if .Field.Min}}, min {{.Field.Min}}{{end}}{{if .Field.Max}}, max {{.Field.Max}}{{end}}){{end}}{{if not .Field.Required}}, optional{{end}}
\ No newline at end of file
@@ -0,0 +1,7 @@
+Order completed
+Completed at: {{TimestampToDatetime .Order.EndTime}}
+Paid: {{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
+Product: {{.Product.Name}}{{if .Order.VariantName}} {{.Order.VariantName}}{{end}}
+{{if .ProductItem.IsFile}}File: {{.ProductItem.Content}} (attached, can be downloaded again in /paid_order){{else if .ProductItem.Fields}}Content:{{range .ProductItem.Fields}}
+{{.Label}}: {{.Value}}{{end}}{{else}}Content: {{.ProductItem.Content}}{{end}}{{range .Inputs}}
+{{.Label}}: {{.Value}}{{end}}
\ No newline at end of file
@@ -0,0 +1,6 @@
+Order expired
+{{if eq .Order.Cate 1}}Top-up amount: {{.Order.BaseCurrencyPrice}} {{.Order.BaseCurrency}}{{else}}Product: {{.Product.Name}}{{if .Order.VariantName}} {{.Order.VariantName}}{{end}}{{end}}
+Order amount: {{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
+Expired at: {{TimestampToDatetime .Order.EndTime}}
+
+Do not pay to the previous address. Please place a new order if you still want to buy
\ No newline at end of file
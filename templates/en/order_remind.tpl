@@ -0,0 +1,5 @@
+Order expiring soon
+Order amount: {{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
+Ends at: {{TimestampToDatetime .Order.EndTime}}
+
+If you have paid, please wait for the on-chain confirmation. Otherwise please complete the payment as soon as possible
\ No newline at end of file
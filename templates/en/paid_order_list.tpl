@@ -0,0 +1 @@
+Your paid orders
\ No newline at end of file
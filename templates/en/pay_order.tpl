@@ -0,0 +1,14 @@
+Address (tap to copy):
+<code>{{.Order.WalletAddress}}</code>
+Currency: {{.Order.Currency}}
+Network: {{.Order.Network}}
+Amount: {{.Order.Price}}
+
+Created at: {{TimestampToDatetime .Order.CreateTime}}
+Ends at: {{TimestampToDatetime .Order.EndTime}}
+
+Please pay the exact amount to the address above before the order ends, and make sure to use the right network
+Check that the address in the image matches the address in this message before paying{{if .Checked}}
+
+{{if eq .Order.Status 1}}Payment received, delivering now{{else if ne .Order.Status 0}}The order is no longer valid, do not pay{{else if .Order.PaidPrice.IsPositive}}Partial payment received: {{.Order.PaidPrice}} {{.Order.Currency}}, please pay the remaining amount{{else}}No payment detected yet. On-chain confirmation takes time, please try again later{{end}}
+Checked at: {{TimestampToDatetime .CheckTime}}{{end}}
\ No newline at end of file
@@ -0,0 +1,9 @@
+Pending orders ({{len .Orders}}/{{.MaxPendingOrders}})
+{{range .Orders}}
+{{if eq .Cate 1}}Top-up: {{.BaseCurrencyPrice}} {{.BaseCurrency}}{{else}}Product: {{.Product.Name}}{{if .VariantName}} {{.VariantName}}{{end}}{{end}}
+Order amount: {{.Price}} {{.Currency}}-{{.Network}}
+Expires at: {{TimestampToDatetime .EndTime}}
+{{else}}
+No pending orders
+{{end}}
+Do not cancel orders you have already paid. Payments to cancelled orders must be handled by the admin
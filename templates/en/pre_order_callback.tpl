@@ -0,0 +1,7 @@
+Pre-order paid
+Paid at: {{TimestampToDatetime .Order.EndTime}}
+Paid: {{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
+Product: {{.Product.Name}}{{if .Order.VariantName}} {{.Order.VariantName}}{{end}}{{range .Inputs}}
+{{.Label}}: {{.Value}}{{end}}
+
+The product is temporarily out of stock. Orders will be delivered automatically in payment order after restocking
\ No newline at end of file
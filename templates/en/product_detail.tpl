@@ -0,0 +1,14 @@
+Name: {{.Product.Name}}
+Details: {{.Product.Description}}
+{{if .Variant}}Option: {{.Variant.Name}}
+{{end}}{{if and .Product.Variants (not .Variant)}}Stock: {{if .Product.IsWebhookDelivery}}auto delivery{{else}}{{.Product.InStockCount}}{{end}}
+Please choose an option{{else}}{{if .Sale}}Flash sale: {{.Sale.Price}}{{.Product.Currency}} (was {{.Sale.OriginalPrice}}{{.Product.Currency}})
+{{if .Sale.EndTime}}Sale ends: {{TimestampToDatetime .Sale.EndTime}}{{with .Sale.Countdown $.Language}} ({{.}} left){{end}}
+{{end}}{{if .Sale.Limited}}Sale items left: {{.Sale.Remaining}}
+{{end}}{{else}}Price: {{.Product.Price}}{{.Product.Currency}}
+{{end}}{{if .Product.IsWebhookDelivery}}Stock: auto delivery{{else}}Stock: {{.Product.InStockCount}}{{if eq .Product.InStockCount 0}}{{if .Product.EnablePreOrder}}
+Out of stock. Pre-orders are delivered automatically in payment order after restocking{{else}}
+Out of stock. You can subscribe to restock notifications{{end}}{{end}}{{end}}{{if .Product.UserPurchaseLimit}}
+Limit: {{.Product.UserPurchaseLimit}} per person{{if eq .Product.UserPurchaseLimitPeriod 1}} per day{{else if eq .Product.UserPurchaseLimitPeriod 2}} per week{{end}}{{end}}{{if .Product.DailyPurchaseLimit}}
+Daily limit: {{.Product.DailyPurchaseLimit}}{{end}}
+Please choose a payment method to create the order{{end}}
\ No newline at end of file
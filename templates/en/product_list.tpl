@@ -0,0 +1 @@
+{{if .Category}}{{.Category.Icon}}{{.Category.Name}}{{else}}Products{{end}}
\ No newline at end of file
@@ -0,0 +1,2 @@
+Search: {{.Keyword}}
+{{if .Total}}Found {{.Total}} products{{else}}No matching products found{{end}}
\ No newline at end of file
@@ -0,0 +1,4 @@
+{{.Product.Name}}
+{{.Product.Description}}
+Price: {{.Price}}{{.Product.Currency}}{{if .OnSale}} (flash sale){{end}}
+Stock: {{if .Product.IsWebhookDelivery}}auto delivery{{else}}{{.Product.InStockCount}}{{end}}
\ No newline at end of file
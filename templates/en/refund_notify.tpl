@@ -0,0 +1,7 @@
+Order refunded
+{{if .Product.Name}}Product: {{.Product.Name}}{{if .Order.VariantName}} {{.Order.VariantName}}{{end}}
+{{end}}Order amount: {{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
+Refund amount: {{.Refund.Amount}} {{.Refund.Currency}}
+{{if eq .Refund.Cate 1}}Refund address: {{.Refund.ToAddress}}
+Transaction ID: {{.Refund.TxID}}{{else}}Refunded to your balance, see /balance{{end}}{{if .Refund.Remark}}
+Remark: {{.Refund.Remark}}{{end}}
\ No newline at end of file
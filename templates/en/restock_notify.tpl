@@ -0,0 +1,4 @@
+The product you subscribed to is back in stock
+Name: {{.Product.Name}}
+Price: {{.Product.Price}}{{.Product.Currency}}
+Stock: {{.Product.InStockCount}}
\ No newline at end of file
@@ -0,0 +1,6 @@
+Welcome
+Products /product_list
+Pending orders /orders
+Balance /balance
+Search products /search keyword
+Language /language
\ No newline at end of file
@@ -0,0 +1,6 @@
+请确认下单信息
+商品名称:{{.Product.Name}}{{if .VariantName}} {{.VariantName}}{{end}}
+支付方式:{{.PaymentMethod}}{{range .Inputs}}
+{{.Label}}:{{.Value}}{{end}}
+
+确认后创建订单
\ No newline at end of file
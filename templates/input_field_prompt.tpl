@@ -0,0 +1,3 @@
+购买 {{.Product.Name}}{{if .VariantName}} {{.VariantName}}{{end}} 需要填写以下信息 ({{.Step}}/{{.Total}})
+{{if .Error}}输入有误: {{.Error}}
+{{end}}请{{if eq .Field.Type "choice"}}选择{{else}}发送{{end}}{{.Field.Label}}{{if eq .Field.Type "number"}}(数字{{if .Field.Min}}，最小{{.Field.Min}}{{end}}{{if .Field.Max}}，最大{{.Field.Max}}{{end}}){{end}}{{if not .Field.Required}}，可跳过{{end}}
\ No newline at end of file
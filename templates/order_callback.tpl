@@ -1,5 +1,7 @@
 订单完成
 完成时间:{{TimestampToDatetime .Order.EndTime}}
 支付金额:{{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
-商品名称:{{.Product.Name}}
-购买内容:{{.ProductItem.Content}}
\ No newline at end of file
+商品名称:{{.Product.Name}}{{if .Order.VariantName}} {{.Order.VariantName}}{{end}}
+{{if .ProductItem.IsFile}}购买文件:{{.ProductItem.Content}}(见附件,可在 /paid_order 中重新下载){{else if .ProductItem.Fields}}购买内容:{{range .ProductItem.Fields}}
+{{.Label}}:{{.Value}}{{end}}{{else}}购买内容:{{.ProductItem.Content}}{{end}}{{range .Inputs}}
+{{.Label}}:{{.Value}}{{end}}
\ No newline at end of file
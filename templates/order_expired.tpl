@@ -0,0 +1,6 @@
+订单已过期
+{{if eq .Order.Cate 1}}充值金额:{{.Order.BaseCurrencyPrice}} {{.Order.BaseCurrency}}{{else}}商品名称:{{.Product.Name}}{{if .Order.VariantName}} {{.Order.VariantName}}{{end}}{{end}}
+订单金额:{{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
+过期时间:{{TimestampToDatetime .Order.EndTime}}
+
+请勿再向原地址付款，如需购买请重新下单
\ No newline at end of file
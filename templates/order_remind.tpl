@@ -0,0 +1,5 @@
+订单即将过期
+订单金额:{{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
+结束时间:{{TimestampToDatetime .Order.EndTime}}
+
+如已付款请耐心等待链上确认，未付款请尽快完成支付
\ No newline at end of file
@@ -1 +1 @@
-以下是商品列表
+以下是已付订单列表
\ No newline at end of file
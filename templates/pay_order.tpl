@@ -8,4 +8,7 @@
 结束时间:{{TimestampToDatetime .Order.EndTime}}
 
 请在规定时间内往上述地址付款指定金额，注意支付的主网类型
-支付前请核对图片中的地址和消息中的地址是否一致，确认一致后再进行付款
\ No newline at end of file
+支付前请核对图片中的地址和消息中的地址是否一致，确认一致后再进行付款{{if .Checked}}
+
+{{if eq .Order.Status 1}}已收到付款，正在发货{{else if ne .Order.Status 0}}订单已失效，请勿付款{{else if .Order.PaidPrice.IsPositive}}已收到部分付款:{{.Order.PaidPrice}} {{.Order.Currency}}，请补足剩余金额{{else}}暂未检测到付款，链上确认需要时间，请稍后再试{{end}}
+查询时间:{{TimestampToDatetime .CheckTime}}{{end}}
\ No newline at end of file
@@ -0,0 +1,9 @@
+待支付订单({{len .Orders}}/{{.MaxPendingOrders}})
+{{range .Orders}}
+{{if eq .Cate 1}}余额充值:{{.BaseCurrencyPrice}} {{.BaseCurrency}}{{else}}商品名称:{{.Product.Name}}{{if .VariantName}} {{.VariantName}}{{end}}{{end}}
+订单金额:{{.Price}} {{.Currency}}-{{.Network}}
+过期时间:{{TimestampToDatetime .EndTime}}
+{{else}}
+没有待支付订单
+{{end}}
+已付款的订单请勿取消，取消后到账需联系管理员处理
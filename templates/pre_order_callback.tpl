@@ -0,0 +1,7 @@
+预订付款成功
+付款时间:{{TimestampToDatetime .Order.EndTime}}
+支付金额:{{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
+商品名称:{{.Product.Name}}{{if .Order.VariantName}} {{.Order.VariantName}}{{end}}{{range .Inputs}}
+{{.Label}}:{{.Value}}{{end}}
+
+商品暂时缺货，补货后将按付款顺序自动发货，请耐心等待
\ No newline at end of file
@@ -1,4 +1,14 @@
 名称: {{.Product.Name}}
 详情: {{.Product.Description}}
-价格: {{.Product.Price}}{{.Product.Currency}}
-请选择付款方式以创建订单
\ No newline at end of file
+{{if .Variant}}规格: {{.Variant.Name}}
+{{end}}{{if and .Product.Variants (not .Variant)}}库存: {{if .Product.IsWebhookDelivery}}自动发货{{else}}{{.Product.InStockCount}}{{end}}
+请选择规格{{else}}{{if .Sale}}限时特价: {{.Sale.Price}}{{.Product.Currency}} (原价: {{.Sale.OriginalPrice}}{{.Product.Currency}})
+{{if .Sale.EndTime}}特价截止: {{TimestampToDatetime .Sale.EndTime}}{{with .Sale.Countdown $.Language}} (剩余{{.}}){{end}}
+{{end}}{{if .Sale.Limited}}特价剩余: {{.Sale.Remaining}}件
+{{end}}{{else}}价格: {{.Product.Price}}{{.Product.Currency}}
+{{end}}{{if .Product.IsWebhookDelivery}}库存: 自动发货{{else}}库存: {{.Product.InStockCount}}{{if eq .Product.InStockCount 0}}{{if .Product.EnablePreOrder}}
+暂时缺货，可预订，付款后补货时按付款顺序自动发货{{else}}
+暂时缺货，可订阅到货通知{{end}}{{end}}{{end}}{{if .Product.UserPurchaseLimit}}
+限购: 每人{{if eq .Product.UserPurchaseLimitPeriod 1}}每天{{else if eq .Product.UserPurchaseLimitPeriod 2}}每周{{end}}{{.Product.UserPurchaseLimit}}件{{end}}{{if .Product.DailyPurchaseLimit}}
+每日限量: {{.Product.DailyPurchaseLimit}}件{{end}}
+请选择付款方式以创建订单{{end}}
\ No newline at end of file
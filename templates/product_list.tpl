@@ -1 +1 @@
-以下是已付订单列表
+{{if .Category}}{{.Category.Icon}}{{.Category.Name}}{{else}}以下是商品列表{{end}}
\ No newline at end of file
@@ -0,0 +1,2 @@
+搜索: {{.Keyword}}
+{{if .Total}}共找到{{.Total}}个商品{{else}}没有找到相关商品{{end}}
\ No newline at end of file
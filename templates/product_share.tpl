@@ -0,0 +1,4 @@
+{{.Product.Name}}
+{{.Product.Description}}
+价格: {{.Price}}{{.Product.Currency}}{{if .OnSale}} (限时特价){{end}}
+库存: {{if .Product.IsWebhookDelivery}}自动发货{{else}}{{.Product.InStockCount}}{{end}}
\ No newline at end of file
@@ -0,0 +1,7 @@
+订单已退款
+{{if .Product.Name}}商品名称:{{.Product.Name}}{{if .Order.VariantName}} {{.Order.VariantName}}{{end}}
+{{end}}订单金额:{{.Order.Price}} {{.Order.Currency}}-{{.Order.Network}}
+退款金额:{{.Refund.Amount}} {{.Refund.Currency}}
+{{if eq .Refund.Cate 1}}退款地址:{{.Refund.ToAddress}}
+交易ID:{{.Refund.TxID}}{{else}}已退回余额，可在 /balance 中查看{{end}}{{if .Refund.Remark}}
+备注:{{.Refund.Remark}}{{end}}
\ No newline at end of file
@@ -0,0 +1,4 @@
+您订阅的商品已到货
+名称: {{.Product.Name}}
+价格: {{.Product.Price}}{{.Product.Currency}}
+库存: {{.Product.InStockCount}}
\ No newline at end of file
@@ -1,2 +1,6 @@
 欢迎
-查看商品列表 /product_list
\ No newline at end of file
+查看商品列表 /product_list
+待支付订单 /orders
+查看余额 /balance
+搜索商品 /search 关键词
+切换语言 /language
\ No newline at end of file